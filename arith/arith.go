@@ -0,0 +1,105 @@
+// Package arith implements the language's fixed-width integer arithmetic,
+// which can behave in one of several ways when a result overflows.
+package arith
+
+import (
+	"errors"
+	"math"
+)
+
+// Overflow says what happens when the result of an operation doesn't fit in
+// an int.
+type Overflow int
+
+// Definitions for the overflow behaviours.
+const (
+	// Wrap wraps the result around using two's complement arithmetic.
+	Wrap Overflow = iota
+	// Saturate clamps the result to the largest or smallest int.
+	Saturate
+	// Trap makes the operation fail with ErrOverflow.
+	Trap
+)
+
+// ErrOverflow is returned by the operations when a result overflows in Trap
+// mode.
+var ErrOverflow = errors.New("integer overflow")
+
+// Add adds two integers.
+func Add(mode Overflow, a, b int64) (int64, error) {
+	sum := a + b
+	if (a >= 0) == (b >= 0) && (sum >= 0) != (a >= 0) {
+		return overflow(mode, sum, a >= 0)
+	}
+	return sum, nil
+}
+
+// Sub subtracts b from a.
+func Sub(mode Overflow, a, b int64) (int64, error) {
+	diff := a - b
+	if (a >= 0) != (b >= 0) && (diff >= 0) != (a >= 0) {
+		return overflow(mode, diff, a >= 0)
+	}
+	return diff, nil
+}
+
+// Mul multiplies two integers.
+func Mul(mode Overflow, a, b int64) (int64, error) {
+	product := a * b
+	if a != 0 && (product/a != b || (a == -1 && b == math.MinInt64)) {
+		return overflow(mode, product, (a >= 0) == (b >= 0))
+	}
+	return product, nil
+}
+
+// Div divides a by b, truncating towards zero. The divisor must not be zero.
+func Div(mode Overflow, a, b int64) (int64, error) {
+	if a == math.MinInt64 && b == -1 {
+		return overflow(mode, a, true)
+	}
+	return a / b, nil
+}
+
+// Neg negates an integer.
+func Neg(mode Overflow, a int64) (int64, error) {
+	if a == math.MinInt64 {
+		return overflow(mode, a, true)
+	}
+	return -a, nil
+}
+
+// MaxChar is the largest value a char can hold. Chars are unsigned bytes, so
+// the smallest is zero.
+const MaxChar = 255
+
+// Char narrows an int to a char.
+func Char(mode Overflow, a int64) (int64, error) {
+	if a >= 0 && a <= MaxChar {
+		return a, nil
+	}
+	switch mode {
+	case Saturate:
+		if a < 0 {
+			return 0, nil
+		}
+		return MaxChar, nil
+	case Trap:
+		return 0, ErrOverflow
+	}
+	return a & MaxChar, nil
+}
+
+// overflow gives the result of an operation that overflowed, where wrapped is
+// the two's complement result and positive says which way it overflowed.
+func overflow(mode Overflow, wrapped int64, positive bool) (int64, error) {
+	switch mode {
+	case Saturate:
+		if positive {
+			return math.MaxInt64, nil
+		}
+		return math.MinInt64, nil
+	case Trap:
+		return 0, ErrOverflow
+	}
+	return wrapped, nil
+}
@@ -0,0 +1,67 @@
+package arith
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		op       func(Overflow) (int64, error)
+		wrap     int64
+		saturate int64
+	}{
+		{"max + 1", func(m Overflow) (int64, error) { return Add(m, math.MaxInt64, 1) }, math.MinInt64, math.MaxInt64},
+		{"min + -1", func(m Overflow) (int64, error) { return Add(m, math.MinInt64, -1) }, math.MaxInt64, math.MinInt64},
+		{"min - 1", func(m Overflow) (int64, error) { return Sub(m, math.MinInt64, 1) }, math.MaxInt64, math.MinInt64},
+		{"0 - min", func(m Overflow) (int64, error) { return Sub(m, 0, math.MinInt64) }, math.MinInt64, math.MaxInt64},
+		{"max * 2", func(m Overflow) (int64, error) { return Mul(m, math.MaxInt64, 2) }, -2, math.MaxInt64},
+		{"max * -2", func(m Overflow) (int64, error) { return Mul(m, math.MaxInt64, -2) }, 2, math.MinInt64},
+		{"-1 * min", func(m Overflow) (int64, error) { return Mul(m, -1, math.MinInt64) }, math.MinInt64, math.MaxInt64},
+		{"min / -1", func(m Overflow) (int64, error) { return Div(m, math.MinInt64, -1) }, math.MinInt64, math.MaxInt64},
+		{"-min", func(m Overflow) (int64, error) { return Neg(m, math.MinInt64) }, math.MinInt64, math.MaxInt64},
+		{"char 256", func(m Overflow) (int64, error) { return Char(m, 256) }, 0, MaxChar},
+		{"char -1", func(m Overflow) (int64, error) { return Char(m, -1) }, MaxChar, 0},
+	}
+	for _, test := range tests {
+		if val, err := test.op(Wrap); val != test.wrap || err != nil {
+			t.Error(
+				"For", test.name,
+				"expected", test.wrap,
+				"got", val, err,
+			)
+		}
+		if val, err := test.op(Saturate); val != test.saturate || err != nil {
+			t.Error(
+				"For", test.name,
+				"expected", test.saturate,
+				"got", val, err,
+			)
+		}
+		if _, err := test.op(Trap); err != ErrOverflow {
+			t.Error(
+				"For", test.name,
+				"expected", ErrOverflow,
+				"got", err,
+			)
+		}
+	}
+}
+
+func TestNoOverflow(t *testing.T) {
+	for _, mode := range []Overflow{Wrap, Saturate, Trap} {
+		a, _ := Add(mode, -5, 3)
+		s, _ := Sub(mode, math.MinInt64, -1)
+		m, _ := Mul(mode, -4, 6)
+		d, _ := Div(mode, -7, 2)
+		n, _ := Neg(mode, math.MaxInt64)
+		if a != -2 || s != math.MinInt64+1 || m != -24 || d != -3 || n != -math.MaxInt64 {
+			t.Error(
+				"For", mode,
+				"expected", -2, int64(math.MinInt64+1), -24, -3, -math.MaxInt64,
+				"got", a, s, m, d, n,
+			)
+		}
+	}
+}
@@ -3,7 +3,10 @@ package ast
 
 import (
 	"fmt"
+	"math/big"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/cmgn/compiler/token"
 )
@@ -38,6 +41,8 @@ const (
 // Node is the interface implemented by all syntax tree nodes.
 type Node interface {
 	SourceInfo() *token.SourceInformation
+	// Span gets the source span from the first token of the node to its last.
+	Span() token.SourceSpan
 	String() string
 }
 
@@ -64,6 +69,7 @@ type Type interface {
 // Empty represents an empty statement. The empty statement is used in2
 // cases such as "while (something);".
 type Empty struct {
+	triviaHolder
 	Source token.SourceInformation
 }
 
@@ -73,6 +79,12 @@ func (e *Empty) SourceInfo() *token.SourceInformation {
 	return &e.Source
 }
 
+// Span gets the source span of the empty statement, which is just its
+// semicolon.
+func (e *Empty) Span() token.SourceSpan {
+	return token.Span(e.Source, e.Source)
+}
+
 func (e *Empty) String() string {
 	return "Empty[]"
 }
@@ -81,6 +93,8 @@ func (e *Empty) statementNode() {}
 
 // ExpressionStatement represents an expression followed by a semicolon.
 type ExpressionStatement struct {
+	triviaHolder
+	End        token.SourceInformation
 	Expression Expression
 }
 
@@ -89,6 +103,12 @@ func (e *ExpressionStatement) SourceInfo() *token.SourceInformation {
 	return e.Expression.SourceInfo()
 }
 
+// Span gets the source span from the start of the expression to the
+// semicolon.
+func (e *ExpressionStatement) Span() token.SourceSpan {
+	return token.Span(e.Expression.Span().Start, e.End)
+}
+
 func (e *ExpressionStatement) String() string {
 	return "ExpressionStatement[" + e.Expression.String() + "]"
 }
@@ -97,7 +117,9 @@ func (e *ExpressionStatement) statementNode() {}
 
 // Assignment is an assignment statement.
 type Assignment struct {
+	triviaHolder
 	Source token.SourceInformation
+	End    token.SourceInformation
 	Left   Expression
 	Right  Expression
 }
@@ -107,6 +129,12 @@ func (a *Assignment) SourceInfo() *token.SourceInformation {
 	return &a.Source
 }
 
+// Span gets the source span from the start of the left hand side to the
+// semicolon.
+func (a *Assignment) Span() token.SourceSpan {
+	return token.Span(a.Left.Span().Start, a.End)
+}
+
 func (a *Assignment) String() string {
 	return fmt.Sprintf("Assignment[%s, %s]", a.Left.String(), a.Right.String())
 }
@@ -115,12 +143,24 @@ func (a *Assignment) statementNode() {}
 
 // Declaration represents a variable declaration statement.
 type Declaration struct {
+	triviaHolder
 	Source token.SourceInformation
+	End    token.SourceInformation
 	Name   string
 	Type   Type
+	// Value is the initial value of the variable, or nil if there is none.
+	Value Expression
 }
 
 func (d *Declaration) String() string {
+	if d.Value != nil {
+		return fmt.Sprintf(
+			"Declaration[%s, %s, %s]",
+			d.Name,
+			d.Type.String(),
+			d.Value.String(),
+		)
+	}
 	return fmt.Sprintf(
 		"Declaration[%s, %s]",
 		d.Name,
@@ -134,13 +174,46 @@ func (d *Declaration) SourceInfo() *token.SourceInformation {
 	return &d.Source
 }
 
+// Span gets the source span from the 'var' keyword to the semicolon.
+func (d *Declaration) Span() token.SourceSpan {
+	return token.Span(d.Source, d.End)
+}
+
 func (d *Declaration) statementNode() {}
 
+// TypeDeclaration represents the definition of a name for a type.
+type TypeDeclaration struct {
+	triviaHolder
+	Source token.SourceInformation
+	End    token.SourceInformation
+	Name   string
+	Type   Type
+}
+
+func (t *TypeDeclaration) String() string {
+	return fmt.Sprintf("TypeDeclaration[%s, %s]", t.Name, t.Type.String())
+}
+
+// SourceInfo retrieves the source information for the 'type' keyword in the
+// declaration.
+func (t *TypeDeclaration) SourceInfo() *token.SourceInformation {
+	return &t.Source
+}
+
+// Span gets the source span from the 'type' keyword to the semicolon.
+func (t *TypeDeclaration) Span() token.SourceSpan {
+	return token.Span(t.Source, t.End)
+}
+
+func (t *TypeDeclaration) statementNode() {}
+
 // IfStatement represents an occurrence of an if statement. Both ifs with &
 // without an else are represented by this, in the latter case Statement2 will
 // be the empty statement.
 type IfStatement struct {
+	triviaHolder
 	Source     token.SourceInformation
+	End        token.SourceInformation
 	Condition  Expression
 	Statement1 Statement
 	Statement2 Statement
@@ -152,6 +225,12 @@ func (i *IfStatement) SourceInfo() *token.SourceInformation {
 	return &i.Source
 }
 
+// Span gets the source span from the 'if' keyword to the end of the last
+// branch.
+func (i *IfStatement) Span() token.SourceSpan {
+	return token.Span(i.Source, i.End)
+}
+
 func (i *IfStatement) String() string {
 	return fmt.Sprintf(
 		"If[%s, %s, %s]",
@@ -165,9 +244,14 @@ func (i *IfStatement) statementNode() {}
 
 // WhileStatement is a 'while' statement.
 type WhileStatement struct {
+	triviaHolder
 	Source    token.SourceInformation
+	End       token.SourceInformation
 	Condition Expression
 	Statement Statement
+	// Else is executed once the condition is false, or is nil if the loop
+	// has no else.
+	Else Statement
 }
 
 // SourceInfo gets the source information for the 'while' keyword part
@@ -176,7 +260,20 @@ func (w *WhileStatement) SourceInfo() *token.SourceInformation {
 	return &w.Source
 }
 
+// Span gets the source span from the 'while' keyword to the end of the body.
+func (w *WhileStatement) Span() token.SourceSpan {
+	return token.Span(w.Source, w.End)
+}
+
 func (w *WhileStatement) String() string {
+	if w.Else != nil {
+		return fmt.Sprintf(
+			"While[%s, %s, %s]",
+			w.Condition.String(),
+			w.Statement.String(),
+			w.Else.String(),
+		)
+	}
 	return fmt.Sprintf(
 		"While[%s, %s]",
 		w.Condition.String(),
@@ -186,9 +283,142 @@ func (w *WhileStatement) String() string {
 
 func (w *WhileStatement) statementNode() {}
 
+// AssertStatement checks that a condition holds when the program is run.
+type AssertStatement struct {
+	triviaHolder
+	Source    token.SourceInformation
+	End       token.SourceInformation
+	Condition Expression
+}
+
+// SourceInfo gets the source information for the 'assert' keyword.
+func (a *AssertStatement) SourceInfo() *token.SourceInformation {
+	return &a.Source
+}
+
+// Span gets the source span from the 'assert' keyword to the semicolon.
+func (a *AssertStatement) Span() token.SourceSpan {
+	return token.Span(a.Source, a.End)
+}
+
+func (a *AssertStatement) String() string {
+	return fmt.Sprintf("Assert[%s]", a.Condition.String())
+}
+
+func (a *AssertStatement) statementNode() {}
+
+// PrintfStatement writes its arguments to the program's output, formatted
+// according to a format string.
+type PrintfStatement struct {
+	triviaHolder
+	Source    token.SourceInformation
+	End       token.SourceInformation
+	Format    *StringLiteral
+	Arguments []Expression
+}
+
+// SourceInfo gets the source information for the 'printf' keyword.
+func (p *PrintfStatement) SourceInfo() *token.SourceInformation {
+	return &p.Source
+}
+
+// Span gets the source span from the 'printf' keyword to the semicolon.
+func (p *PrintfStatement) Span() token.SourceSpan {
+	return token.Span(p.Source, p.End)
+}
+
+func (p *PrintfStatement) String() string {
+	strs := make([]string, len(p.Arguments)+1)
+	strs[0] = p.Format.String()
+	for i, arg := range p.Arguments {
+		strs[i+1] = arg.String()
+	}
+	return fmt.Sprintf("Printf[%s]", strings.Join(strs, ", "))
+}
+
+func (p *PrintfStatement) statementNode() {}
+
+// DeferStatement delays a statement until the end of the innermost block
+// containing it, or the end of the program at the top level.
+type DeferStatement struct {
+	triviaHolder
+	Source    token.SourceInformation
+	Statement Statement
+}
+
+// SourceInfo gets the source information for the 'defer' keyword.
+func (d *DeferStatement) SourceInfo() *token.SourceInformation {
+	return &d.Source
+}
+
+// Span gets the source span from the 'defer' keyword to the end of the
+// deferred statement.
+func (d *DeferStatement) Span() token.SourceSpan {
+	return token.Span(d.Source, d.Statement.Span().End)
+}
+
+func (d *DeferStatement) String() string {
+	return fmt.Sprintf("Defer[%s]", d.Statement.String())
+}
+
+func (d *DeferStatement) statementNode() {}
+
+// SwitchStatement compares a value against a series of cases, executing the
+// statements of the first case that matches. If no case matches then the
+// default case is executed, if there is one.
+type SwitchStatement struct {
+	triviaHolder
+	Source token.SourceInformation
+	End    token.SourceInformation
+	Value  Expression
+	Cases  []*SwitchCase
+}
+
+// SwitchCase is a single case of a switch statement.
+type SwitchCase struct {
+	// Source is the source information of the 'case' or 'default' keyword.
+	Source token.SourceInformation
+	// Value is the value the case matches, or nil for the default case.
+	Value      Expression
+	Statements []Statement
+}
+
+func (s *SwitchCase) String() string {
+	strs := make([]string, len(s.Statements))
+	for i, statement := range s.Statements {
+		strs[i] = statement.String()
+	}
+	if s.Value == nil {
+		return fmt.Sprintf("Default[%s]", strings.Join(strs, ", "))
+	}
+	return fmt.Sprintf("Case[%s, [%s]]", s.Value.String(), strings.Join(strs, ", "))
+}
+
+// SourceInfo gets the source information for the 'switch' keyword.
+func (s *SwitchStatement) SourceInfo() *token.SourceInformation {
+	return &s.Source
+}
+
+// Span gets the source span from the 'switch' keyword to the closing bracket.
+func (s *SwitchStatement) Span() token.SourceSpan {
+	return token.Span(s.Source, s.End)
+}
+
+func (s *SwitchStatement) String() string {
+	strs := make([]string, len(s.Cases))
+	for i, c := range s.Cases {
+		strs[i] = c.String()
+	}
+	return fmt.Sprintf("Switch[%s, %s]", s.Value.String(), strings.Join(strs, ", "))
+}
+
+func (s *SwitchStatement) statementNode() {}
+
 // BlockStatement is a series of statements surrounded by curly brackets.
 type BlockStatement struct {
+	triviaHolder
 	Source     token.SourceInformation
+	End        token.SourceInformation
 	Statements []Statement
 }
 
@@ -198,6 +428,12 @@ func (b *BlockStatement) SourceInfo() *token.SourceInformation {
 	return &b.Source
 }
 
+// Span gets the source span from the opening bracket to the closing bracket
+// of the block.
+func (b *BlockStatement) Span() token.SourceSpan {
+	return token.Span(b.Source, b.End)
+}
+
 func (b *BlockStatement) String() string {
 	strs := make([]string, len(b.Statements))
 	for i, statement := range b.Statements {
@@ -211,6 +447,83 @@ func (b *BlockStatement) String() string {
 
 func (b *BlockStatement) statementNode() {}
 
+// LabeledStatement is a statement preceded by a label, which break and
+// continue statements inside it can name.
+type LabeledStatement struct {
+	triviaHolder
+	Source    token.SourceInformation
+	Label     string
+	Statement Statement
+}
+
+// SourceInfo gets the source information for the label.
+func (l *LabeledStatement) SourceInfo() *token.SourceInformation {
+	return &l.Source
+}
+
+// Span gets the source span from the label to the end of the statement.
+func (l *LabeledStatement) Span() token.SourceSpan {
+	return token.Span(l.Source, l.Statement.Span().End)
+}
+
+func (l *LabeledStatement) String() string {
+	return fmt.Sprintf("Labeled[%s, %s]", l.Label, l.Statement.String())
+}
+
+func (l *LabeledStatement) statementNode() {}
+
+// BreakStatement ends a loop early, without running its else. The loop is
+// the innermost one around the statement, or the one named by Label if it
+// isn't empty.
+type BreakStatement struct {
+	triviaHolder
+	Source token.SourceInformation
+	End    token.SourceInformation
+	Label  string
+}
+
+// SourceInfo gets the source information for the 'break' keyword.
+func (b *BreakStatement) SourceInfo() *token.SourceInformation {
+	return &b.Source
+}
+
+// Span gets the source span from the 'break' keyword to the semicolon.
+func (b *BreakStatement) Span() token.SourceSpan {
+	return token.Span(b.Source, b.End)
+}
+
+func (b *BreakStatement) String() string {
+	return fmt.Sprintf("Break[%s]", b.Label)
+}
+
+func (b *BreakStatement) statementNode() {}
+
+// ContinueStatement skips the rest of the body of a loop, going on to test
+// its condition again. The loop is chosen in the same way as for a break
+// statement.
+type ContinueStatement struct {
+	triviaHolder
+	Source token.SourceInformation
+	End    token.SourceInformation
+	Label  string
+}
+
+// SourceInfo gets the source information for the 'continue' keyword.
+func (c *ContinueStatement) SourceInfo() *token.SourceInformation {
+	return &c.Source
+}
+
+// Span gets the source span from the 'continue' keyword to the semicolon.
+func (c *ContinueStatement) Span() token.SourceSpan {
+	return token.Span(c.Source, c.End)
+}
+
+func (c *ContinueStatement) String() string {
+	return fmt.Sprintf("Continue[%s]", c.Label)
+}
+
+func (c *ContinueStatement) statementNode() {}
+
 // Integer is an integer expression.
 type Integer struct {
 	Source token.SourceInformation
@@ -222,12 +535,122 @@ func (i *Integer) SourceInfo() *token.SourceInformation {
 	return &i.Source
 }
 
+// Span gets the source span of the integer.
+func (i *Integer) Span() token.SourceSpan {
+	return token.Span(i.Source, i.Source)
+}
+
 func (i *Integer) String() string {
 	return i.Value
 }
 
+// Int64 gets the value of the integer as a fixed-width integer, returning an
+// error if it is out of range.
+func (i *Integer) Int64() (int64, error) {
+	val, ok := i.Big()
+	if !ok || !val.IsInt64() {
+		return 0, fmt.Errorf("[%s] integer %s overflows int", i.Source.String(), i.Value)
+	}
+	return val.Int64(), nil
+}
+
+// Big gets the value of the integer with arbitrary precision. The second
+// return value is false if the integer is malformed. Integers are decimal
+// unless they are prefixed by 0x or 0X, after any sign.
+func (i *Integer) Big() (*big.Int, bool) {
+	digits, base := i.Value, 10
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		digits, sign = digits[1:], "-"
+	}
+	if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+		digits, base = digits[2:], 16
+	}
+	return new(big.Int).SetString(sign+digits, base)
+}
+
 func (i *Integer) expressionNode() {}
 
+// Character is a character literal expression.
+type Character struct {
+	Source token.SourceInformation
+	Value  byte
+	// Length is the number of bytes of source the character was parsed
+	// from, which differs from its quoted form when it is escaped. It is
+	// zero for a character that wasn't parsed.
+	Length int
+}
+
+// SourceInfo gets the source information for the character.
+func (c *Character) SourceInfo() *token.SourceInformation {
+	return &c.Source
+}
+
+// Span gets the source span of the character.
+func (c *Character) Span() token.SourceSpan {
+	return token.Span(c.Source, c.Source)
+}
+
+func (c *Character) String() string {
+	if c.Value >= utf8.RuneSelf {
+		return fmt.Sprintf("'\\x%02x'", c.Value)
+	}
+	return strconv.QuoteRuneToASCII(rune(c.Value))
+}
+
+func (c *Character) expressionNode() {}
+
+// StringLiteral is a string literal. Strings aren't values in the language, so
+// a StringLiteral isn't an expression and only appears where the grammar asks
+// for a string, such as the format of a printf statement.
+type StringLiteral struct {
+	Source token.SourceInformation
+	// Value is the contents of the string, with any escape sequences
+	// decoded.
+	Value string
+	// Raw is set if the string was written between backticks, in which case
+	// it has no escape sequences.
+	Raw bool
+	// Length is the number of bytes of source the string was parsed from,
+	// or zero for a string that wasn't parsed.
+	Length int
+}
+
+// SourceInfo gets the source information for the string.
+func (s *StringLiteral) SourceInfo() *token.SourceInformation {
+	return &s.Source
+}
+
+// Span gets the source span of the string.
+func (s *StringLiteral) Span() token.SourceSpan {
+	return token.Span(s.Source, s.Source)
+}
+
+func (s *StringLiteral) String() string {
+	return strconv.Quote(s.Value)
+}
+
+// NilLiteral is the 'nil' pointer literal.
+type NilLiteral struct {
+	Source token.SourceInformation
+}
+
+// SourceInfo gets the source information for the 'nil' keyword.
+func (n *NilLiteral) SourceInfo() *token.SourceInformation {
+	return &n.Source
+}
+
+// Span gets the source span of the 'nil' keyword.
+func (n *NilLiteral) Span() token.SourceSpan {
+	return token.Span(n.Source, n.Source)
+}
+
+func (n *NilLiteral) String() string {
+	return "nil"
+}
+
+func (n *NilLiteral) expressionNode() {}
+
 // Variable is a variable expression.
 type Variable struct {
 	Source token.SourceInformation
@@ -239,6 +662,11 @@ func (v *Variable) SourceInfo() *token.SourceInformation {
 	return &v.Source
 }
 
+// Span gets the source span of the variable.
+func (v *Variable) Span() token.SourceSpan {
+	return token.Span(v.Source, v.Source)
+}
+
 func (v *Variable) String() string {
 	return v.Value
 }
@@ -248,9 +676,12 @@ func (v *Variable) expressionNode() {}
 // BinaryOperator represents an occurrence of a binary operator
 // expression.
 type BinaryOperator struct {
-	Type  BinaryOperatorType
-	Left  Expression
-	Right Expression
+	// Source is the position of the operator. Errors in the expression
+	// are reported from its left operand, where the expression starts.
+	Source token.SourceInformation
+	Type   BinaryOperatorType
+	Left   Expression
+	Right  Expression
 }
 
 // SourceInfo gets the source information for the left operand of the
@@ -259,6 +690,12 @@ func (b *BinaryOperator) SourceInfo() *token.SourceInformation {
 	return b.Left.SourceInfo()
 }
 
+// Span gets the source span from the start of the left operand to the end
+// of the right operand.
+func (b *BinaryOperator) Span() token.SourceSpan {
+	return token.Span(b.Left.Span().Start, b.Right.Span().End)
+}
+
 func (b *BinaryOperator) String() string {
 	return fmt.Sprintf(
 		"BinaryOperator[%s, %s, %s]",
@@ -273,14 +710,20 @@ func (b *BinaryOperator) expressionNode() {}
 // UnaryOperator represents an occurrence of a unary operator
 // expression.
 type UnaryOperator struct {
-	Type  UnaryOperatorType
-	Value Expression
+	// Source is the position of the operator.
+	Source token.SourceInformation
+	Type   UnaryOperatorType
+	Value  Expression
 }
 
-// SourceInfo gets the source information for the operator inside the
-// unary operator node.
+// SourceInfo gets the source information for the operator.
 func (u *UnaryOperator) SourceInfo() *token.SourceInformation {
-	return u.Value.SourceInfo()
+	return &u.Source
+}
+
+// Span gets the source span from the operator to the end of the operand.
+func (u *UnaryOperator) Span() token.SourceSpan {
+	return token.Span(u.Source, u.Value.Span().End)
 }
 
 func (u *UnaryOperator) String() string {
@@ -295,6 +738,7 @@ func (u *UnaryOperator) expressionNode() {}
 
 // Subscript represents an array subscript expression.
 type Subscript struct {
+	End   token.SourceInformation
 	Value Expression
 	Index Expression
 }
@@ -304,12 +748,107 @@ func (s *Subscript) SourceInfo() *token.SourceInformation {
 	return s.Value.SourceInfo()
 }
 
+// Span gets the source span from the start of the value being indexed to the
+// closing bracket.
+func (s *Subscript) Span() token.SourceSpan {
+	return token.Span(s.Value.Span().Start, s.End)
+}
+
 func (s *Subscript) String() string {
 	return fmt.Sprintf("Subscript[%s, %s]", s.Value.String(), s.Index.String())
 }
 
 func (s *Subscript) expressionNode() {}
 
+// FieldAccess represents reading a field of a struct, as in a.b.
+type FieldAccess struct {
+	// End is the source information for the field's name.
+	End   token.SourceInformation
+	Value Expression
+	Field string
+}
+
+// SourceInfo gets the source information for the struct being accessed.
+func (f *FieldAccess) SourceInfo() *token.SourceInformation {
+	return f.Value.SourceInfo()
+}
+
+// Span gets the source span from the start of the struct being accessed to
+// the field's name.
+func (f *FieldAccess) Span() token.SourceSpan {
+	return token.Span(f.Value.Span().Start, f.End)
+}
+
+func (f *FieldAccess) String() string {
+	return fmt.Sprintf("FieldAccess[%s, %s]", f.Value.String(), f.Field)
+}
+
+func (f *FieldAccess) expressionNode() {}
+
+// ArrayLiteral is a list of values surrounded by curly brackets, used to
+// initialize an array in a declaration.
+type ArrayLiteral struct {
+	Source   token.SourceInformation
+	End      token.SourceInformation
+	Elements []Expression
+}
+
+// SourceInfo gets the source information for the opening bracket of the
+// literal.
+func (a *ArrayLiteral) SourceInfo() *token.SourceInformation {
+	return &a.Source
+}
+
+// Span gets the source span from the opening bracket to the closing bracket
+// of the literal.
+func (a *ArrayLiteral) Span() token.SourceSpan {
+	return token.Span(a.Source, a.End)
+}
+
+func (a *ArrayLiteral) String() string {
+	strs := make([]string, len(a.Elements))
+	for i, elem := range a.Elements {
+		strs[i] = elem.String()
+	}
+	return fmt.Sprintf("ArrayLiteral[%s]", strings.Join(strs, ", "))
+}
+
+func (a *ArrayLiteral) expressionNode() {}
+
+// StatementExpression is a GCC-style statement expression, a series of
+// statements followed by an expression between '({' and '})'. The statements
+// run in a scope of their own, and the value of the final expression is the
+// value of the whole.
+type StatementExpression struct {
+	Source     token.SourceInformation
+	End        token.SourceInformation
+	Statements []Statement
+	Value      Expression
+}
+
+// SourceInfo gets the source information for the opening bracket of the
+// statement expression.
+func (s *StatementExpression) SourceInfo() *token.SourceInformation {
+	return &s.Source
+}
+
+// Span gets the source span from the opening bracket to the closing bracket
+// of the statement expression.
+func (s *StatementExpression) Span() token.SourceSpan {
+	return token.Span(s.Source, s.End)
+}
+
+func (s *StatementExpression) String() string {
+	strs := make([]string, len(s.Statements)+1)
+	for i, stmt := range s.Statements {
+		strs[i] = stmt.String()
+	}
+	strs[len(s.Statements)] = s.Value.String()
+	return fmt.Sprintf("StatementExpression[%s]", strings.Join(strs, ", "))
+}
+
+func (s *StatementExpression) expressionNode() {}
+
 // PrimitiveType is used in the Primitive node to represent which primitive
 // type is contained in it.
 type PrimitiveType int
@@ -332,6 +871,11 @@ func (p *Primitive) SourceInfo() *token.SourceInformation {
 	return &p.Source
 }
 
+// Span gets the source span of the primitive type.
+func (p *Primitive) Span() token.SourceSpan {
+	return token.Span(p.Source, p.Source)
+}
+
 func (p *Primitive) String() string {
 	return p.Type.String()
 }
@@ -349,9 +893,14 @@ func (p *Primitive) Size() int {
 
 func (p *Primitive) typeNode() {}
 
+// UnknownLength is the length of an array type written without one, which is
+// to be inferred from the array literal that initializes it.
+const UnknownLength = -1
+
 // ArrayType is the type for fixed-length statically allocated arrays.
 type ArrayType struct {
 	Source token.SourceInformation
+	// Length is the number of elements, or UnknownLength if it was left out.
 	Length int
 	Type   Type
 }
@@ -361,7 +910,16 @@ func (a *ArrayType) SourceInfo() *token.SourceInformation {
 	return &a.Source
 }
 
+// Span gets the source span from the 'array' keyword to the end of the
+// element type.
+func (a *ArrayType) Span() token.SourceSpan {
+	return token.Span(a.Source, a.Type.Span().End)
+}
+
 func (a *ArrayType) String() string {
+	if a.Length == UnknownLength {
+		return fmt.Sprintf("Array[?, %s]", a.Type.String())
+	}
 	return fmt.Sprintf(
 		"Array[%d, %s]",
 		a.Length,
@@ -370,8 +928,11 @@ func (a *ArrayType) String() string {
 }
 
 // Size gets the size of the array in bytes, which is the length times the size of
-// the the array's type.
+// the the array's type. An array of unknown length has no size.
 func (a *ArrayType) Size() int {
+	if a.Length == UnknownLength {
+		return 0
+	}
 	return a.Type.Size() * a.Length
 }
 
@@ -389,6 +950,12 @@ func (p *PointerType) SourceInfo() *token.SourceInformation {
 	return &p.Source
 }
 
+// Span gets the source span from the 'ptr' keyword to the end of the
+// pointed-to type.
+func (p *PointerType) Span() token.SourceSpan {
+	return token.Span(p.Source, p.Type.Span().End)
+}
+
 func (p *PointerType) String() string {
 	return fmt.Sprintf("Pointer[%s]", p.Type.String())
 }
@@ -399,3 +966,140 @@ func (p *PointerType) Size() int {
 }
 
 func (p *PointerType) typeNode() {}
+
+// FunctionType is the type of a function, given by the types of its
+// parameters and the type it returns.
+type FunctionType struct {
+	Source     token.SourceInformation
+	End        token.SourceInformation
+	Parameters []Type
+	// Return is the type returned by the function, or nil if the function
+	// doesn't return a value.
+	Return Type
+}
+
+// SourceInfo gets the source information for the 'func' keyword part of the
+// occurrence.
+func (f *FunctionType) SourceInfo() *token.SourceInformation {
+	return &f.Source
+}
+
+// Span gets the source span from the 'func' keyword to the end of the
+// return type, or the closing bracket if there is no return type.
+func (f *FunctionType) Span() token.SourceSpan {
+	if f.Return != nil {
+		return token.Span(f.Source, f.Return.Span().End)
+	}
+	return token.Span(f.Source, f.End)
+}
+
+func (f *FunctionType) String() string {
+	strs := make([]string, len(f.Parameters))
+	for i, param := range f.Parameters {
+		strs[i] = param.String()
+	}
+	ret := "void"
+	if f.Return != nil {
+		ret = f.Return.String()
+	}
+	return fmt.Sprintf("Function[(%s), %s]", strings.Join(strs, ", "), ret)
+}
+
+// Size gets the size of a function value in bytes, which is the size of a
+// pointer to its code.
+func (f *FunctionType) Size() int {
+	return 8
+}
+
+func (f *FunctionType) typeNode() {}
+
+// NamedType is a type referred to by name, which has to be resolved to the
+// type it names before it can be used.
+type NamedType struct {
+	Source token.SourceInformation
+	Name   string
+	// Type is the type the name is defined as, or nil until the name has
+	// been resolved.
+	Type Type
+}
+
+// SourceInfo gets the source information for the name.
+func (n *NamedType) SourceInfo() *token.SourceInformation {
+	return &n.Source
+}
+
+// Span gets the source span of the name.
+func (n *NamedType) Span() token.SourceSpan {
+	return token.Span(n.Source, n.Source)
+}
+
+func (n *NamedType) String() string {
+	return fmt.Sprintf("Named[%s]", n.Name)
+}
+
+// Size gets the size of the type a name is defined as, or zero if the name
+// hasn't been resolved.
+func (n *NamedType) Size() int {
+	if n.Type == nil {
+		return 0
+	}
+	return n.Type.Size()
+}
+
+func (n *NamedType) typeNode() {}
+
+// Underlying gets the type a type is defined as, following named types until
+// it reaches one that isn't named. A name that hasn't been resolved is its own
+// underlying type.
+func Underlying(typ Type) Type {
+	for {
+		named, ok := typ.(*NamedType)
+		if !ok || named.Type == nil {
+			return typ
+		}
+		typ = named.Type
+	}
+}
+
+// StructField is a named field of a struct type.
+type StructField struct {
+	Source token.SourceInformation
+	Name   string
+	Type   Type
+}
+
+// StructType is the type of a struct, whose fields are stored one after
+// another in the order they are written.
+type StructType struct {
+	Source token.SourceInformation
+	End    token.SourceInformation
+	Fields []*StructField
+}
+
+// SourceInfo gets the source information for the 'struct' keyword part of
+// the occurrence.
+func (s *StructType) SourceInfo() *token.SourceInformation {
+	return &s.Source
+}
+
+// Span gets the source span from the 'struct' keyword to the closing curly
+// bracket.
+func (s *StructType) Span() token.SourceSpan {
+	return token.Span(s.Source, s.End)
+}
+
+func (s *StructType) String() string {
+	strs := make([]string, len(s.Fields))
+	for i, field := range s.Fields {
+		strs[i] = field.Name + " " + field.Type.String()
+	}
+	return fmt.Sprintf("Struct[%s]", strings.Join(strs, ", "))
+}
+
+// Size gets the size of the struct in bytes as laid out for the
+// DefaultTarget, including any padding between and after its fields.
+func (s *StructType) Size() int {
+	return DefaultTarget.Layout(s).Size
+}
+
+func (s *StructType) typeNode() {}
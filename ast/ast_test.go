@@ -0,0 +1,49 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestOperatorStrings checks that every operator has a distinct string. The
+// lists must be kept in sync with the constants: the value after the last one
+// listed is checked to have no string, so a new operator fails this test until
+// it is added.
+func TestOperatorStrings(t *testing.T) {
+	binary := []BinaryOperatorType{
+		BinaryAdd, BinarySub, BinaryMul, BinaryDiv,
+		BinaryLessThan, BinaryGreaterThan, BinaryEqual, BinaryNotEqual,
+	}
+	unary := []UnaryOperatorType{UnaryDereference, UnaryMinus, UnaryAddress}
+	binaryStrs := make([]string, len(binary)+1)
+	for i, op := range binary {
+		binaryStrs[i] = op.String()
+	}
+	binaryStrs[len(binary)] = BinaryOperatorType(len(binary)).String()
+	unaryStrs := make([]string, len(unary)+1)
+	for i, op := range unary {
+		unaryStrs[i] = op.String()
+	}
+	unaryStrs[len(unary)] = UnaryOperatorType(len(unary)).String()
+	for _, strs := range [][]string{binaryStrs, unaryStrs} {
+		seen := make(map[string]bool)
+		for i, str := range strs {
+			unnamed := str == "" || strings.Contains(str, "OperatorType(")
+			if unnamed != (i == len(strs)-1) || seen[str] {
+				t.Error(
+					"For", i,
+					"expected", "a distinct operator string",
+					"got", str,
+				)
+			}
+			seen[str] = true
+		}
+	}
+	if BinaryNotEqual.String() != "'!='" {
+		t.Error(
+			"For", "BinaryNotEqual",
+			"expected", "'!='",
+			"got", BinaryNotEqual.String(),
+		)
+	}
+}
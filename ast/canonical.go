@@ -0,0 +1,107 @@
+package ast
+
+import "sort"
+
+// Canonicalize rewrites an expression so that expressions differing only in
+// the order or grouping of the operands of + and * become Equal, e.g. b + a
+// and (c + a) + b become a + b and (a + b) + c. Each chain of the same
+// operator is flattened, its operands are sorted by their S-expressions, and
+// the chain is rebuilt grouping to the left. The original expression is left
+// unchanged.
+//
+// Reordering is only safe for integers, where wrapping arithmetic makes both
+// operators associative and commutative. That only holds under arith.Wrap:
+// under arith.Trap or arith.Saturate a reordered chain can overflow where the
+// original didn't, so a canonical expression must only be evaluated with
+// arith.Wrap. Moving a pointer along in a
+// different order can take it outside its object, so integer is called to
+// ask whether an operator in the original expression gives an integer, as
+// sema's Info.TypeOf can tell. Operands holding a statement expression have
+// side effects, so a chain containing one is left in its original order.
+func Canonicalize(expr Expression, integer func(*BinaryOperator) bool) Expression {
+	switch e := expr.(type) {
+	case *BinaryOperator:
+		if (e.Type == BinaryAdd || e.Type == BinaryMul) && integer(e) {
+			return canonicalChain(e, integer)
+		}
+		c := *e
+		c.Left = Canonicalize(e.Left, integer)
+		c.Right = Canonicalize(e.Right, integer)
+		return &c
+	case *UnaryOperator:
+		c := *e
+		c.Value = Canonicalize(e.Value, integer)
+		return &c
+	case *Subscript:
+		c := *e
+		c.Value = Canonicalize(e.Value, integer)
+		c.Index = Canonicalize(e.Index, integer)
+		return &c
+	case *FieldAccess:
+		c := *e
+		c.Value = Canonicalize(e.Value, integer)
+		return &c
+	case *ArrayLiteral:
+		c := *e
+		c.Elements = make([]Expression, len(e.Elements))
+		for i, elem := range e.Elements {
+			c.Elements[i] = Canonicalize(elem, integer)
+		}
+		return &c
+	}
+	return expr
+}
+
+// canonicalChain canonicalizes a chain of integer additions or
+// multiplications.
+func canonicalChain(expr *BinaryOperator, integer func(*BinaryOperator) bool) Expression {
+	operands := flattenChain(expr, integer, nil)
+	effects := false
+	for i, operand := range operands {
+		effects = effects || hasStatementExpression(operand)
+		operands[i] = Canonicalize(operand, integer)
+	}
+	if !effects {
+		keys := make(map[Expression]string, len(operands))
+		for _, operand := range operands {
+			keys[operand] = ToSExpr(operand)
+		}
+		sort.SliceStable(operands, func(i, j int) bool {
+			return keys[operands[i]] < keys[operands[j]]
+		})
+	}
+	// The rebuilt operators take the position of the operator at the top
+	// of the chain, since their operands no longer match any operator in
+	// the source.
+	result := operands[0]
+	for _, operand := range operands[1:] {
+		result = &BinaryOperator{Source: expr.Source, Type: expr.Type, Left: result, Right: operand}
+	}
+	return result
+}
+
+// flattenChain appends the operands of a chain of the same integer operator
+// to operands, in source order.
+func flattenChain(expr *BinaryOperator, integer func(*BinaryOperator) bool, operands []Expression) []Expression {
+	for _, operand := range []Expression{expr.Left, expr.Right} {
+		if inner, ok := operand.(*BinaryOperator); ok && inner.Type == expr.Type && integer(inner) {
+			operands = flattenChain(inner, integer, operands)
+		} else {
+			operands = append(operands, operand)
+		}
+	}
+	return operands
+}
+
+// hasStatementExpression checks if a tree contains a statement expression.
+func hasStatementExpression(node Node) bool {
+	if _, ok := node.(*StatementExpression); ok {
+		return true
+	}
+	for _, child := range children(node) {
+		if hasStatementExpression(child) {
+			return true
+		}
+	}
+	return false
+}
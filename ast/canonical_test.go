@@ -0,0 +1,112 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/cmgn/compiler/token"
+)
+
+func TestCanonicalize(t *testing.T) {
+	v := func(name string) Expression { return &Variable{Value: name} }
+	bin := func(typ BinaryOperatorType, l, r Expression) Expression {
+		return &BinaryOperator{Type: typ, Left: l, Right: r}
+	}
+	integer := func(*BinaryOperator) bool { return true }
+	tests := []struct {
+		name string
+		a, b Expression
+		out  bool
+	}{
+		{
+			"swapped addition",
+			bin(BinaryAdd, v("a"), v("b")),
+			bin(BinaryAdd, v("b"), v("a")),
+			true,
+		},
+		{
+			"swapped multiplication",
+			bin(BinaryMul, v("a"), &Integer{Value: "2"}),
+			bin(BinaryMul, &Integer{Value: "2"}, v("a")),
+			true,
+		},
+		{
+			"regrouped addition",
+			bin(BinaryAdd, bin(BinaryAdd, v("c"), v("a")), v("b")),
+			bin(BinaryAdd, v("a"), bin(BinaryAdd, v("b"), v("c"))),
+			true,
+		},
+		{
+			"nested operands",
+			&UnaryOperator{Type: UnaryMinus, Value: bin(BinaryMul, bin(BinaryAdd, v("y"), v("x")), v("z"))},
+			&UnaryOperator{Type: UnaryMinus, Value: bin(BinaryMul, v("z"), bin(BinaryAdd, v("x"), v("y")))},
+			true,
+		},
+		{
+			"swapped subtraction",
+			bin(BinarySub, v("a"), v("b")),
+			bin(BinarySub, v("b"), v("a")),
+			false,
+		},
+		{
+			"swapped division",
+			bin(BinaryDiv, v("a"), v("b")),
+			bin(BinaryDiv, v("b"), v("a")),
+			false,
+		},
+		{
+			"mixed operators",
+			bin(BinaryAdd, bin(BinaryMul, v("a"), v("b")), v("c")),
+			bin(BinaryMul, v("a"), bin(BinaryAdd, v("b"), v("c"))),
+			false,
+		},
+		{
+			"statement expression",
+			bin(BinaryAdd, &StatementExpression{Value: v("a")}, v("b")),
+			bin(BinaryAdd, v("b"), &StatementExpression{Value: v("a")}),
+			false,
+		},
+	}
+	for _, test := range tests {
+		before := test.a.String()
+		a := Canonicalize(test.a, integer)
+		b := Canonicalize(test.b, integer)
+		if Equal(a, b) != test.out {
+			t.Error(
+				"For", test.name,
+				"expected", test.out,
+				"got", a, b,
+			)
+		}
+		if test.a.String() != before {
+			t.Error(
+				"For", test.name,
+				"expected", "original expression to be unchanged",
+				"got", test.a,
+			)
+		}
+	}
+
+	// Pointer arithmetic is left alone.
+	in := bin(BinaryAdd, bin(BinaryAdd, v("p"), v("b")), v("a"))
+	pointer := func(*BinaryOperator) bool { return false }
+	expected := "BinaryOperator['+', BinaryOperator['+', p, b], a]"
+	if out := Canonicalize(in, pointer); out.String() != expected {
+		t.Error(
+			"For", in,
+			"expected", expected,
+			"got", out,
+		)
+	}
+
+	// The rebuilt chain keeps the position of its top operator.
+	source := token.SourceInformation{FileName: "test", Line: 2, Column: 7}
+	in = &BinaryOperator{Source: source, Type: BinaryAdd, Left: bin(BinaryAdd, v("c"), v("b")), Right: v("a")}
+	out := Canonicalize(in, integer).(*BinaryOperator)
+	if out.Source != source || out.Left.(*BinaryOperator).Source != source {
+		t.Error(
+			"For", in,
+			"expected", source.String(),
+			"got", out.Source.String(), out.Left.(*BinaryOperator).Source.String(),
+		)
+	}
+}
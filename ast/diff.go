@@ -0,0 +1,117 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Diff describes the first difference between two nodes that makes them not
+// Equal, or gives the empty string if they are Equal. The description starts
+// with the path to the differing node, made of the name of the root's type
+// followed by the fields leading from it, e.g.
+//
+//	WhileStatement.Statement.Statements[0].Right: Type differs: '+' vs '-'
+//
+// Nodes are visited in source order, so the same pair of trees always gives
+// the same description.
+func Diff(a, b Node) string {
+	if a == nil && b == nil {
+		return ""
+	}
+	path := "<nil>"
+	if a != nil {
+		path = nodeName(a)
+	} else {
+		path = nodeName(b)
+	}
+	return diff(path, a, b)
+}
+
+// diff finds the first difference between two nodes at the given path.
+func diff(path string, a, b Node) string {
+	if a == nil || b == nil {
+		if a == nil && b == nil {
+			return ""
+		}
+		return fmt.Sprintf("%s: %s vs %s", path, describe(a), describe(b))
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return fmt.Sprintf("%s: %s vs %s", path, describe(a), describe(b))
+	}
+	if d := attributeDiff(a, b); d != "" {
+		return path + ": " + d
+	}
+	ac, bc := children(a), children(b)
+	for i := 0; i < len(ac) || i < len(bc); i++ {
+		switch {
+		case i >= len(ac):
+			return fmt.Sprintf("%s.%s: missing vs %s", path, fieldPath(b, bc[i]), describe(bc[i]))
+		case i >= len(bc):
+			return fmt.Sprintf("%s.%s: %s vs missing", path, fieldPath(a, ac[i]), describe(ac[i]))
+		}
+		if d := diff(path+"."+fieldPath(a, ac[i]), ac[i], bc[i]); d != "" {
+			return d
+		}
+	}
+	return ""
+}
+
+// describe gives the type and string of a node for a difference.
+func describe(node Node) string {
+	if node == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("%s %s", nodeName(node), node.String())
+}
+
+// nodeName gives the name of the type of a node, without the package.
+func nodeName(node Node) string {
+	return reflect.TypeOf(node).Elem().Name()
+}
+
+// fieldPath finds the exported field, or element of a field, of a parent node
+// that holds one of its children, e.g. "Cases[1].Statements[0]".
+func fieldPath(parent, child Node) string {
+	path, _ := findField(reflect.ValueOf(parent).Elem(), child)
+	return path
+}
+
+// findField searches a struct for a child node, descending into slices and
+// into structs that aren't nodes themselves.
+func findField(v reflect.Value, child Node) (string, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if path, ok := findValue(v.Field(i), child); ok {
+			return field.Name + path, true
+		}
+	}
+	return "", false
+}
+
+// findValue checks if a value is, or holds, a child node.
+func findValue(v reflect.Value, child Node) (string, bool) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return "", false
+		}
+		if node, ok := v.Interface().(Node); ok {
+			return "", node == child
+		}
+		return findValue(v.Elem(), child)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if path, ok := findValue(v.Index(i), child); ok {
+				return fmt.Sprintf("[%d]%s", i, path), true
+			}
+		}
+	case reflect.Struct:
+		if path, ok := findField(v, child); ok {
+			return "." + path, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,81 @@
+package ast
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	one := func() *Integer { return &Integer{Value: "1"} }
+	// while 1 { a[1] = 1 op *b; }
+	loop := func(op BinaryOperatorType) Node {
+		return &WhileStatement{
+			Condition: one(),
+			Statement: &BlockStatement{
+				Statements: []Statement{
+					&Assignment{
+						Left: &Subscript{Value: &Variable{Value: "a"}, Index: one()},
+						Right: &BinaryOperator{
+							Type:  op,
+							Left:  one(),
+							Right: &UnaryOperator{Type: UnaryDereference, Value: &Variable{Value: "b"}},
+						},
+					},
+				},
+			},
+		}
+	}
+	array := func(length int) Node {
+		return &Declaration{
+			Name: "a",
+			Type: &PointerType{Type: &ArrayType{Length: length, Type: &Primitive{Type: IntType}}},
+		}
+	}
+	cases := func(defaultValue Expression) Node {
+		return &SwitchStatement{
+			Value: one(),
+			Cases: []*SwitchCase{
+				{Value: one(), Statements: []Statement{&Empty{}}},
+				{Statements: []Statement{&ExpressionStatement{Expression: defaultValue}}},
+			},
+		}
+	}
+	tests := []struct {
+		a, b Node
+		out  string
+	}{
+		{loop(BinaryAdd), loop(BinaryAdd), ""},
+		{
+			loop(BinaryAdd), loop(BinarySub),
+			"WhileStatement.Statement.Statements[0].Right: Type differs: '+' vs '-'",
+		},
+		{array(3), array(3), ""},
+		{array(3), array(4), "Declaration.Type.Type: Length differs: 3 vs 4"},
+		{
+			cases(&Variable{Value: "x"}), cases(one()),
+			"SwitchStatement.Cases[1].Statements[0].Expression: Variable x vs Integer 1",
+		},
+		{
+			&Declaration{Name: "a", Type: &Primitive{Type: IntType}},
+			&Declaration{Name: "a", Type: &Primitive{Type: IntType}, Value: one()},
+			"Declaration.Value: missing vs Integer 1",
+		},
+		{one(), nil, "Integer: Integer 1 vs nil"},
+		{
+			&StructType{Fields: []*StructField{{Name: "x", Type: &Primitive{Type: IntType}}}},
+			&StructType{Fields: []*StructField{{Name: "y", Type: &Primitive{Type: IntType}}}},
+			"StructType: Fields[0].Name differs: x vs y",
+		},
+		{
+			&BreakStatement{Label: "outer"}, &BreakStatement{},
+			"BreakStatement: Label differs: outer vs ",
+		},
+	}
+	for _, test := range tests {
+		out := Diff(test.a, test.b)
+		if out != test.out || (out == "") != Equal(test.a, test.b) {
+			t.Error(
+				"For", test.a, test.b,
+				"expected", test.out,
+				"got", out,
+			)
+		}
+	}
+}
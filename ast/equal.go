@@ -0,0 +1,139 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Equal checks if two nodes have the same structure, ignoring where they
+// occur in the source and any trivia attached to them.
+func Equal(a, b Node) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || !sameAttributes(a, b) {
+		return false
+	}
+	ac, bc := children(a), children(b)
+	if len(ac) != len(bc) {
+		return false
+	}
+	for i := range ac {
+		if !Equal(ac[i], bc[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// attribute is a part of a node that isn't one of its children, described as
+// a string so that any two attributes can be compared and reported the same
+// way.
+type attribute struct {
+	name  string
+	value string
+}
+
+// attributes lists the parts of a node that aren't its children. Where
+// children alone are ambiguous, such as which of the children of a switch
+// belong to which case, the shape is listed here too. Nodes of the same type
+// always list their attributes in the same order, up to the first one that
+// differs.
+func attributes(n Node) []attribute {
+	switch n := n.(type) {
+	case *Declaration:
+		return []attribute{{"Name", n.Name}}
+	case *TypeDeclaration:
+		return []attribute{{"Name", n.Name}}
+	case *LabeledStatement:
+		return []attribute{{"Label", n.Label}}
+	case *BreakStatement:
+		return []attribute{{"Label", n.Label}}
+	case *ContinueStatement:
+		return []attribute{{"Label", n.Label}}
+	case *SwitchStatement:
+		attrs := []attribute{{"Cases", fmt.Sprintf("%d cases", len(n.Cases))}}
+		for i, sc := range n.Cases {
+			attrs = append(attrs,
+				attribute{fmt.Sprintf("Cases[%d]", i), caseKind(sc)},
+				attribute{fmt.Sprintf("Cases[%d].Statements", i), fmt.Sprintf("%d statements", len(sc.Statements))},
+			)
+		}
+		return attrs
+	case *StringLiteral:
+		return []attribute{{"Value", n.String()}}
+	case *Integer:
+		return []attribute{{"Value", n.Value}}
+	case *Character:
+		return []attribute{{"Value", fmt.Sprintf("%q", n.Value)}}
+	case *Variable:
+		return []attribute{{"Value", n.Value}}
+	case *FieldAccess:
+		return []attribute{{"Field", n.Field}}
+	case *BinaryOperator:
+		return []attribute{{"Type", n.Type.String()}}
+	case *UnaryOperator:
+		return []attribute{{"Type", n.Type.String()}}
+	case *Primitive:
+		return []attribute{{"Type", primitiveNames[n.Type]}}
+	case *NamedType:
+		return []attribute{{"Name", n.Name}}
+	case *ArrayType:
+		return []attribute{{"Length", strconv.Itoa(n.Length)}}
+	case *FunctionType:
+		return []attribute{
+			{"Parameters", fmt.Sprintf("%d parameters", len(n.Parameters))},
+			{"Return", returnKind(n)},
+		}
+	case *StructType:
+		attrs := []attribute{{"Fields", fmt.Sprintf("%d fields", len(n.Fields))}}
+		for i, field := range n.Fields {
+			attrs = append(attrs, attribute{fmt.Sprintf("Fields[%d].Name", i), field.Name})
+		}
+		return attrs
+	}
+	return nil
+}
+
+// sameAttributes compares the attributes of two nodes of the same type.
+func sameAttributes(a, b Node) bool {
+	return attributeDiff(a, b) == ""
+}
+
+// attributeDiff describes the first difference between the attributes of two
+// nodes of the same type, or gives the empty string if there isn't one.
+func attributeDiff(a, b Node) string {
+	aa, ba := attributes(a), attributes(b)
+	for i := 0; i < len(aa) && i < len(ba); i++ {
+		if why := differs(aa[i].name, aa[i].value, ba[i].value); why != "" {
+			return why
+		}
+	}
+	return ""
+}
+
+// differs describes a difference in a field, or gives the empty string if the
+// values are the same.
+func differs(field, a, b string) string {
+	if a == b {
+		return ""
+	}
+	return fmt.Sprintf("%s differs: %s vs %s", field, a, b)
+}
+
+// caseKind names the kind of a switch case.
+func caseKind(sc *SwitchCase) string {
+	if sc.Value == nil {
+		return "default"
+	}
+	return "case"
+}
+
+// returnKind describes whether a function type returns a value.
+func returnKind(typ *FunctionType) string {
+	if typ.Return == nil {
+		return "no return type"
+	}
+	return "a return type"
+}
@@ -0,0 +1,76 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/cmgn/compiler/token"
+)
+
+func TestEqual(t *testing.T) {
+	at := func(line int) token.SourceInformation {
+		return token.SourceInformation{FileName: "test", Line: line, Column: 1}
+	}
+	tests := []struct {
+		name string
+		a, b Node
+		out  bool
+	}{
+		{
+			"same variable at different places",
+			&Variable{Source: at(1), Value: "x"},
+			&Variable{Source: at(2), Value: "x"},
+			true,
+		},
+		{
+			"different variables",
+			&Variable{Value: "x"},
+			&Variable{Value: "y"},
+			false,
+		},
+		{
+			"different node types",
+			&Variable{Value: "x"},
+			&Integer{Value: "x"},
+			false,
+		},
+		{
+			"same subscript",
+			&Subscript{Value: &Variable{Value: "a"}, Index: &Integer{Value: "1"}},
+			&Subscript{Value: &Variable{Value: "a"}, Index: &Integer{Value: "1"}},
+			true,
+		},
+		{
+			"different operators",
+			&BinaryOperator{Type: BinaryAdd, Left: &Integer{Value: "1"}, Right: &Integer{Value: "2"}},
+			&BinaryOperator{Type: BinarySub, Left: &Integer{Value: "1"}, Right: &Integer{Value: "2"}},
+			false,
+		},
+		{
+			"different array lengths",
+			&ArrayType{Length: 2, Type: &Primitive{Type: IntType}},
+			&ArrayType{Length: 3, Type: &Primitive{Type: IntType}},
+			false,
+		},
+		{
+			"statement moved between cases",
+			&SwitchStatement{Value: &Variable{Value: "x"}, Cases: []*SwitchCase{
+				{Value: &Integer{Value: "1"}, Statements: []Statement{&Empty{}}},
+				{Value: &Integer{Value: "2"}},
+			}},
+			&SwitchStatement{Value: &Variable{Value: "x"}, Cases: []*SwitchCase{
+				{Value: &Integer{Value: "1"}},
+				{Value: &Integer{Value: "2"}, Statements: []Statement{&Empty{}}},
+			}},
+			false,
+		},
+	}
+	for _, test := range tests {
+		if out := Equal(test.a, test.b); out != test.out {
+			t.Error(
+				"For", test.name,
+				"expected", test.out,
+				"got", out,
+			)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cmgn/compiler/token"
+)
+
+// BraceStyle says where the opening bracket of a block goes.
+type BraceStyle int
+
+// Definitions for the brace styles.
+const (
+	// BracesKAndR puts opening brackets at the end of the line that starts
+	// the statement, and else on the same line as the closing bracket.
+	BracesKAndR BraceStyle = iota
+	// BracesAllman puts opening brackets, closing brackets and else on lines
+	// of their own.
+	BracesAllman
+)
+
+// Style holds the options that control how Format lays out a program.
+type Style struct {
+	// IndentWidth is the number of spaces to indent by. Zero indents with
+	// tabs instead.
+	IndentWidth int
+	// SpaceOperators puts spaces around binary operators.
+	SpaceOperators bool
+	// Braces says where the brackets of blocks go.
+	Braces BraceStyle
+}
+
+// DefaultStyle is the style used by FormatDefault.
+var DefaultStyle = Style{
+	SpaceOperators: true,
+	Braces:         BracesKAndR,
+}
+
+// FormatDefault formats a program using DefaultStyle.
+func FormatDefault(stmts []Statement) string {
+	return Format(stmts, DefaultStyle)
+}
+
+// Format turns a program back into source code laid out according to a
+// style. Parsing the result gives a program Equal to the one formatted, and
+// any trivia attached to the statements is reproduced, with runs of blank
+// lines shortened to a single line.
+func Format(stmts []Statement, style Style) string {
+	f := &formatter{style: style}
+	f.statements(stmts)
+	return f.buf.String()
+}
+
+// FormatExpression turns an expression back into source code in
+// DefaultStyle, as it is quoted in error messages and warnings.
+func FormatExpression(expr Expression) string {
+	f := &formatter{style: DefaultStyle}
+	return f.expression(expr)
+}
+
+// formatter holds the state of a call to Format.
+type formatter struct {
+	style Style
+	buf   strings.Builder
+	// depth is the current level of indentation.
+	depth int
+}
+
+// line starts a new line at the current indentation.
+func (f *formatter) line() {
+	if f.buf.Len() > 0 {
+		f.buf.WriteByte('\n')
+	}
+	if f.style.IndentWidth == 0 {
+		f.buf.WriteString(strings.Repeat("\t", f.depth))
+	} else {
+		f.buf.WriteString(strings.Repeat(" ", f.depth*f.style.IndentWidth))
+	}
+}
+
+// statements writes a series of statements, each on a new line.
+func (f *formatter) statements(stmts []Statement) {
+	for i, stmt := range stmts {
+		var trivia *Trivia
+		if holder, ok := stmt.(HasTrivia); ok {
+			trivia = holder.Trivia()
+		}
+		if trivia != nil && trivia.BlankLines > 0 && i > 0 {
+			f.buf.WriteByte('\n')
+		}
+		if trivia != nil {
+			for _, comment := range trivia.Leading {
+				f.line()
+				f.buf.WriteString(comment)
+			}
+		}
+		f.line()
+		f.statement(stmt)
+		if trivia != nil && trivia.Trailing != "" {
+			f.buf.WriteString(" " + trivia.Trailing)
+		}
+	}
+}
+
+// statement writes a statement, starting at the current position.
+func (f *formatter) statement(stmt Statement) {
+	switch stmt := stmt.(type) {
+	case *Empty:
+		f.buf.WriteByte(';')
+	case *ExpressionStatement:
+		f.buf.WriteString(f.expression(stmt.Expression) + ";")
+	case *Assignment:
+		f.buf.WriteString(f.expression(stmt.Left) + " = " + f.expression(stmt.Right) + ";")
+	case *Declaration:
+		f.buf.WriteString("var " + stmt.Name + " " + f.typ(stmt.Type))
+		if stmt.Value != nil {
+			f.buf.WriteString(" = " + f.expression(stmt.Value))
+		}
+		f.buf.WriteByte(';')
+	case *TypeDeclaration:
+		f.buf.WriteString("type " + stmt.Name + " " + f.typ(stmt.Type) + ";")
+	case *IfStatement:
+		f.buf.WriteString("if " + f.expression(stmt.Condition))
+		f.body(stmt.Statement1)
+		f.elseBody(stmt.Statement1, stmt.Statement2)
+	case *WhileStatement:
+		f.buf.WriteString("while " + f.expression(stmt.Condition))
+		f.body(stmt.Statement)
+		if stmt.Else != nil {
+			f.elseBody(stmt.Statement, stmt.Else)
+		}
+	case *AssertStatement:
+		f.buf.WriteString("assert " + f.expression(stmt.Condition) + ";")
+	case *PrintfStatement:
+		f.buf.WriteString("printf " + f.expression(stmt.Format))
+		for _, arg := range stmt.Arguments {
+			f.buf.WriteString(", " + f.expression(arg))
+		}
+		f.buf.WriteByte(';')
+	case *DeferStatement:
+		f.buf.WriteString("defer ")
+		f.statement(stmt.Statement)
+	case *LabeledStatement:
+		f.buf.WriteString(stmt.Label + ": ")
+		f.statement(stmt.Statement)
+	case *BreakStatement:
+		f.branch("break", stmt.Label)
+	case *ContinueStatement:
+		f.branch("continue", stmt.Label)
+	case *SwitchStatement:
+		f.buf.WriteString("switch " + f.expression(stmt.Value))
+		f.open()
+		for _, sc := range stmt.Cases {
+			f.line()
+			if sc.Value == nil {
+				f.buf.WriteString("default:")
+			} else {
+				f.buf.WriteString("case " + f.expression(sc.Value) + ":")
+			}
+			f.depth++
+			f.statements(sc.Statements)
+			f.depth--
+		}
+		f.line()
+		f.buf.WriteByte('}')
+	case *BlockStatement:
+		f.buf.WriteByte('{')
+		f.depth++
+		f.statements(stmt.Statements)
+		f.depth--
+		f.line()
+		f.buf.WriteByte('}')
+	default:
+		panic(fmt.Sprintf("cannot format %s", stmt.String()))
+	}
+}
+
+// branch writes a break or continue statement.
+func (f *formatter) branch(keyword, label string) {
+	f.buf.WriteString(keyword)
+	if label != "" {
+		f.buf.WriteString(" " + label)
+	}
+	f.buf.WriteByte(';')
+}
+
+// open writes the opening bracket of a block whose statement has been
+// written up to the bracket.
+func (f *formatter) open() {
+	if f.style.Braces == BracesAllman {
+		f.line()
+		f.buf.WriteByte('{')
+	} else {
+		f.buf.WriteString(" {")
+	}
+}
+
+// body writes the body of an if or while statement. Blocks follow the brace
+// style, and other statements go on the next line, indented.
+func (f *formatter) body(stmt Statement) {
+	if _, ok := stmt.(*BlockStatement); ok {
+		if f.style.Braces == BracesAllman {
+			f.line()
+		} else {
+			f.buf.WriteByte(' ')
+		}
+		f.statement(stmt)
+		return
+	}
+	f.depth++
+	f.line()
+	f.statement(stmt)
+	f.depth--
+}
+
+// elseBody writes the else branch of an if or while statement, if it has
+// one. An else if is kept on the same line as the else.
+func (f *formatter) elseBody(body, alt Statement) {
+	if _, ok := alt.(*Empty); ok {
+		return
+	}
+	_, block := body.(*BlockStatement)
+	if block && f.style.Braces == BracesKAndR {
+		f.buf.WriteString(" else")
+	} else {
+		f.line()
+		f.buf.WriteString("else")
+	}
+	if _, ok := alt.(*IfStatement); ok {
+		f.buf.WriteByte(' ')
+		f.statement(alt)
+		return
+	}
+	f.body(alt)
+}
+
+// unarySymbols maps each unary operator to the symbol written before its
+// operand.
+var unarySymbols = map[UnaryOperatorType]string{
+	UnaryDereference: "*",
+	UnaryMinus:       "-",
+	UnaryAddress:     "&",
+}
+
+// binarySymbols maps each binary operator to its symbol.
+var binarySymbols = map[BinaryOperatorType]string{
+	BinaryAdd:         "+",
+	BinarySub:         "-",
+	BinaryMul:         "*",
+	BinaryDiv:         "/",
+	BinaryLessThan:    "<",
+	BinaryGreaterThan: ">",
+	BinaryEqual:       "==",
+	BinaryNotEqual:    "!=",
+}
+
+// expression formats an expression, or a string literal, adding only the
+// brackets needed to keep its structure.
+func (f *formatter) expression(expr Node) string {
+	switch expr := expr.(type) {
+	case *StringLiteral:
+		if expr.Raw {
+			return "`" + expr.Value + "`"
+		}
+		return token.Quote(expr.Value, '"')
+	case *Integer:
+		return expr.Value
+	case *Character:
+		return token.Quote(string(expr.Value), '\'')
+	case *NilLiteral:
+		return "nil"
+	case *Variable:
+		return expr.Value
+	case *BinaryOperator:
+		power := expr.Type.Precedence()
+		left := f.operand(expr.Left, func(p int) bool {
+			return p < power || p == power && expr.Type.Associativity() == NonAssociative
+		})
+		right := f.operand(expr.Right, func(p int) bool { return p <= power })
+		op := binarySymbols[expr.Type]
+		if f.style.SpaceOperators {
+			return left + " " + op + " " + right
+		}
+		return left + op + right
+	case *UnaryOperator:
+		value := f.expression(expr.Value)
+		if _, ok := expr.Value.(*BinaryOperator); ok {
+			value = "(" + value + ")"
+		} else if _, ok := expr.Value.(*Integer); ok && expr.Type == UnaryMinus {
+			// Without brackets the minus would become part of the
+			// integer.
+			value = "(" + value + ")"
+		}
+		return unarySymbols[expr.Type] + value
+	case *Subscript:
+		value := f.expression(expr.Value)
+		switch expr.Value.(type) {
+		case *BinaryOperator, *UnaryOperator:
+			value = "(" + value + ")"
+		}
+		return value + "[" + f.expression(expr.Index) + "]"
+	case *FieldAccess:
+		value := f.expression(expr.Value)
+		switch expr.Value.(type) {
+		case *BinaryOperator, *UnaryOperator:
+			value = "(" + value + ")"
+		}
+		return value + "." + expr.Field
+	case *ArrayLiteral:
+		strs := make([]string, len(expr.Elements))
+		for i, elem := range expr.Elements {
+			strs[i] = f.expression(elem)
+		}
+		return "{" + strings.Join(strs, ", ") + "}"
+	case *StatementExpression:
+		// The statements are written one per line, indented one level
+		// further than the line the expression starts on.
+		inner := &formatter{style: f.style, depth: f.depth + 1}
+		inner.statements(expr.Statements)
+		inner.line()
+		inner.buf.WriteString(inner.expression(expr.Value))
+		inner.depth--
+		inner.line()
+		return "({\n" + inner.buf.String() + "})"
+	}
+	panic(fmt.Sprintf("cannot format %s", expr.String()))
+}
+
+// operand formats the operand of a binary operator, bracketing it if it is a
+// binary operator whose precedence needs brackets.
+func (f *formatter) operand(expr Expression, needsBrackets func(precedence int) bool) string {
+	str := f.expression(expr)
+	if bin, ok := expr.(*BinaryOperator); ok && needsBrackets(bin.Type.Precedence()) {
+		return "(" + str + ")"
+	}
+	return str
+}
+
+// typ formats a type.
+func (f *formatter) typ(typ Type) string {
+	switch typ := typ.(type) {
+	case *Primitive:
+		return primitiveNames[typ.Type]
+	case *NamedType:
+		return typ.Name
+	case *ArrayType:
+		if typ.Length == UnknownLength {
+			return "array of " + f.typ(typ.Type)
+		}
+		return fmt.Sprintf("array(%d) of %s", typ.Length, f.typ(typ.Type))
+	case *PointerType:
+		return "ptr to " + f.typ(typ.Type)
+	case *FunctionType:
+		strs := make([]string, len(typ.Parameters))
+		for i, param := range typ.Parameters {
+			strs[i] = f.typ(param)
+		}
+		str := "func(" + strings.Join(strs, ", ") + ")"
+		if typ.Return != nil {
+			str += " " + f.typ(typ.Return)
+		}
+		return str
+	case *StructType:
+		if len(typ.Fields) == 0 {
+			return "struct {}"
+		}
+		var buf strings.Builder
+		buf.WriteString("struct {")
+		for _, field := range typ.Fields {
+			buf.WriteString(" " + field.Name + " " + f.typ(field.Type) + ";")
+		}
+		buf.WriteString(" }")
+		return buf.String()
+	}
+	panic(fmt.Sprintf("cannot format %s", typ.String()))
+}
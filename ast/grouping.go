@@ -0,0 +1,123 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Precedence levels of the binary operators, following the grammar. An
+// operator with a higher level binds more tightly.
+const (
+	precedenceEquality = iota + 1
+	precedenceComparison
+	precedenceSummation
+	precedenceProduct
+)
+
+// binaryPrecedences maps each binary operator to its precedence level.
+var binaryPrecedences = map[BinaryOperatorType]int{
+	BinaryEqual:       precedenceEquality,
+	BinaryNotEqual:    precedenceEquality,
+	BinaryLessThan:    precedenceComparison,
+	BinaryGreaterThan: precedenceComparison,
+	BinaryAdd:         precedenceSummation,
+	BinarySub:         precedenceSummation,
+	BinaryMul:         precedenceProduct,
+	BinaryDiv:         precedenceProduct,
+}
+
+// Precedence gets the precedence level of a binary operator, counting from one
+// for the loosest binding operators.
+func (t BinaryOperatorType) Precedence() int {
+	return binaryPrecedences[t]
+}
+
+// Associativity says how a chain of operators with the same precedence
+// groups.
+type Associativity int
+
+// Definitions for the kinds of associativity.
+const (
+	// LeftAssociative operators group from the left, so a - b - c is
+	// (a - b) - c.
+	LeftAssociative Associativity = iota
+	// NonAssociative operators can't be chained without brackets, so
+	// a < b < c is invalid.
+	NonAssociative
+)
+
+func (a Associativity) String() string {
+	if a == NonAssociative {
+		return "non-associative"
+	}
+	return "left-associative"
+}
+
+// Associativity gets the associativity of a binary operator.
+func (t BinaryOperatorType) Associativity() Associativity {
+	if t.Precedence() == precedenceComparison {
+		return NonAssociative
+	}
+	return LeftAssociative
+}
+
+// Parenthesize writes an expression as source with every operator and its
+// operands in brackets, to show how the expression was grouped, e.g.
+// a + b * c < d is written ((a + (b * c)) < d).
+func Parenthesize(expr Expression) string {
+	switch expr := expr.(type) {
+	case *BinaryOperator:
+		return fmt.Sprintf("(%s %s %s)", Parenthesize(expr.Left),
+			binarySymbols[expr.Type], Parenthesize(expr.Right))
+	case *UnaryOperator:
+		return fmt.Sprintf("(%s%s)", unarySymbols[expr.Type], Parenthesize(expr.Value))
+	case *Subscript:
+		return fmt.Sprintf("%s[%s]", Parenthesize(expr.Value), Parenthesize(expr.Index))
+	case *FieldAccess:
+		return Parenthesize(expr.Value) + "." + expr.Field
+	case *ArrayLiteral:
+		strs := make([]string, len(expr.Elements))
+		for i, elem := range expr.Elements {
+			strs[i] = Parenthesize(elem)
+		}
+		return "{" + strings.Join(strs, ", ") + "}"
+	}
+	return (&formatter{}).expression(expr)
+}
+
+// Grouping describes how each binary operator in an expression grouped its
+// operands, one per line from the outermost in, giving the operator's
+// precedence and associativity, e.g.
+//
+//	(a + (b * c)): '+' precedence 3, left-associative
+//	(b * c): '*' precedence 4, left-associative
+func Grouping(expr Expression) string {
+	var buf strings.Builder
+	writeGrouping(&buf, expr)
+	return buf.String()
+}
+
+// writeGrouping writes the grouping of each binary operator within an
+// expression.
+func writeGrouping(buf *strings.Builder, expr Expression) {
+	switch expr := expr.(type) {
+	case *BinaryOperator:
+		fmt.Fprintf(buf, "%s: %s precedence %d, %s\n", Parenthesize(expr), expr.Type.String(),
+			expr.Type.Precedence(), expr.Type.Associativity())
+		writeGrouping(buf, expr.Left)
+		writeGrouping(buf, expr.Right)
+	case *UnaryOperator:
+		writeGrouping(buf, expr.Value)
+	case *Subscript:
+		writeGrouping(buf, expr.Value)
+		writeGrouping(buf, expr.Index)
+	case *FieldAccess:
+		writeGrouping(buf, expr.Value)
+	case *ArrayLiteral:
+		for _, elem := range expr.Elements {
+			writeGrouping(buf, elem)
+		}
+	case *StatementExpression:
+		writeGrouping(buf, expr.Value)
+	}
+}
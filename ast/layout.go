@@ -0,0 +1,100 @@
+package ast
+
+// Target describes how the machine a program runs on lays out its values. A
+// scalar, that is a primitive, pointer or function, is aligned to its size,
+// up to MaxAlign bytes. An array is aligned like its elements and a struct
+// like its most aligned field.
+type Target struct {
+	// MaxAlign is the largest alignment the target needs. A MaxAlign of one
+	// packs structs without any padding.
+	MaxAlign int
+}
+
+// DefaultTarget is the target types are laid out for when no other is
+// given, which aligns every scalar to its size.
+var DefaultTarget = &Target{MaxAlign: 8}
+
+// Layout is the placement of the fields of a struct in memory.
+type Layout struct {
+	// Offsets holds the offset in bytes of each field from the start of the
+	// struct, in the order the fields are written.
+	Offsets []int
+	// Size is the size of the struct in bytes. It is padded to a multiple
+	// of the alignment so that every element of an array of the struct is
+	// aligned.
+	Size  int
+	Align int
+}
+
+// Align gets the alignment in bytes of a type. A type without a size, such as
+// a NamedType that hasn't been resolved, is given an alignment of one.
+func (t *Target) Align(typ Type) int {
+	switch typ := Underlying(typ).(type) {
+	case *ArrayType:
+		return t.Align(typ.Type)
+	case *StructType:
+		return t.Layout(typ).Align
+	}
+	align := Underlying(typ).Size()
+	if align > t.MaxAlign {
+		align = t.MaxAlign
+	}
+	if align < 1 {
+		align = 1
+	}
+	return align
+}
+
+// SizeOf gets the size of a type in bytes, including the padding of any
+// structs it contains.
+func (t *Target) SizeOf(typ Type) int {
+	switch typ := Underlying(typ).(type) {
+	case *ArrayType:
+		if typ.Length == UnknownLength {
+			return 0
+		}
+		return t.SizeOf(typ.Type) * typ.Length
+	case *StructType:
+		return t.Layout(typ).Size
+	}
+	return Underlying(typ).Size()
+}
+
+// Layout places each field of a struct at the first offset after the
+// previous field that is aligned for the field's type. The struct's type must
+// not contain the struct by value.
+func (t *Target) Layout(s *StructType) *Layout {
+	layout := &Layout{Offsets: make([]int, len(s.Fields)), Align: 1}
+	for i, field := range s.Fields {
+		align := t.Align(field.Type)
+		layout.Offsets[i] = alignUp(layout.Size, align)
+		layout.Size = layout.Offsets[i] + t.SizeOf(field.Type)
+		if align > layout.Align {
+			layout.Align = align
+		}
+	}
+	layout.Size = alignUp(layout.Size, layout.Align)
+	return layout
+}
+
+// FieldOffset gets the offset in bytes of the named field of a struct, or -1
+// if the struct has no such field.
+func (t *Target) FieldOffset(s *StructType, name string) int {
+	for i, field := range s.Fields {
+		if field.Name == name {
+			return t.Layout(s).Offsets[i]
+		}
+	}
+	return -1
+}
+
+// FieldOffset gets the offset in bytes of the named field of a struct laid out
+// for the DefaultTarget, or -1 if the struct has no such field.
+func FieldOffset(s *StructType, name string) int {
+	return DefaultTarget.FieldOffset(s, name)
+}
+
+// alignUp rounds n up to a multiple of align.
+func alignUp(n, align int) int {
+	return (n + align - 1) / align * align
+}
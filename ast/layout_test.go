@@ -0,0 +1,91 @@
+package ast
+
+import "testing"
+
+func TestLayout(t *testing.T) {
+	char := &Primitive{Type: CharType}
+	integer := &Primitive{Type: IntType}
+	mixed := &StructType{Fields: []*StructField{
+		{Name: "a", Type: char},
+		{Name: "b", Type: integer},
+		{Name: "c", Type: char},
+	}}
+	nested := &StructType{Fields: []*StructField{
+		{Name: "c", Type: char},
+		{Name: "pair", Type: &StructType{Fields: []*StructField{
+			{Name: "x", Type: char},
+			{Name: "y", Type: char},
+		}}},
+		{Name: "s", Type: &ArrayType{Length: 3, Type: char}},
+		{Name: "p", Type: &PointerType{Type: mixed}},
+		{Name: "m", Type: &ArrayType{Length: 2, Type: mixed}},
+	}}
+	tests := []struct {
+		target  *Target
+		typ     *StructType
+		offsets []int
+		size    int
+		align   int
+	}{
+		{DefaultTarget, mixed, []int{0, 8, 16}, 24, 8},
+		{&Target{MaxAlign: 4}, mixed, []int{0, 4, 12}, 16, 4},
+		{&Target{MaxAlign: 1}, mixed, []int{0, 1, 9}, 10, 1},
+		{DefaultTarget, nested, []int{0, 1, 3, 8, 16}, 64, 8},
+		{DefaultTarget, &StructType{}, []int{}, 0, 1},
+	}
+	for _, test := range tests {
+		layout := test.target.Layout(test.typ)
+		same := len(layout.Offsets) == len(test.offsets)
+		for i := 0; same && i < len(test.offsets); i++ {
+			same = layout.Offsets[i] == test.offsets[i]
+		}
+		if !same || layout.Size != test.size || layout.Align != test.align {
+			t.Error(
+				"For", test.typ, "with", test.target.MaxAlign,
+				"expected", test.offsets, test.size, test.align,
+				"got", layout.Offsets, layout.Size, layout.Align,
+			)
+		}
+	}
+
+	if size := mixed.Size(); size != 24 {
+		t.Error(
+			"For", mixed,
+			"expected", 24,
+			"got", size,
+		)
+	}
+	if size := (&ArrayType{Length: 2, Type: mixed}).Size(); size != 48 {
+		t.Error(
+			"For", "array(2) of", mixed,
+			"expected", 48,
+			"got", size,
+		)
+	}
+}
+
+func TestFieldOffset(t *testing.T) {
+	s := &StructType{Fields: []*StructField{
+		{Name: "tag", Type: &Primitive{Type: CharType}},
+		{Name: "value", Type: &Primitive{Type: IntType}},
+		{Name: "flag", Type: &Primitive{Type: CharType}},
+	}}
+	tests := []struct {
+		name string
+		out  int
+	}{
+		{"tag", 0},
+		{"value", 8},
+		{"flag", 16},
+		{"missing", -1},
+	}
+	for _, test := range tests {
+		if off := FieldOffset(s, test.name); off != test.out {
+			t.Error(
+				"For", test.name,
+				"expected", test.out,
+				"got", off,
+			)
+		}
+	}
+}
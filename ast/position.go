@@ -0,0 +1,88 @@
+package ast
+
+import (
+	"strings"
+
+	"github.com/cmgn/compiler/token"
+)
+
+// NodeAt finds the innermost node in a program whose source contains pos, or
+// nil if no node does, such as when pos is in whitespace between statements.
+// Only the line and column of pos are compared.
+func NodeAt(stmts []Statement, pos token.SourceInformation) Node {
+	for _, stmt := range stmts {
+		if node := nodeAt(stmt, pos); node != nil {
+			return node
+		}
+	}
+	return nil
+}
+
+// nodeAt finds the innermost node within node that contains pos.
+func nodeAt(node Node, pos token.SourceInformation) Node {
+	for _, child := range children(node) {
+		if found := nodeAt(child, pos); found != nil {
+			return found
+		}
+	}
+	span := node.Span()
+	if before(pos, span.Start) || before(lastColumn(node, span.End), pos) {
+		return nil
+	}
+	return node
+}
+
+// lastColumn gets the position of the last column of a node, given the start
+// of its last token. Only a raw string can end on a later line than its last
+// token starts, so it is measured from its last line.
+func lastColumn(node Node, end token.SourceInformation) token.SourceInformation {
+	if str, ok := node.(*StringLiteral); ok && str.Raw {
+		if i := strings.LastIndexByte(str.Value, '\n'); i >= 0 {
+			end.Line += strings.Count(str.Value, "\n")
+			end.Column = len(str.Value) - i
+			return end
+		}
+	}
+	end.Column += lastTokenWidth(node) - 1
+	return end
+}
+
+// lastTokenWidth gets the number of columns taken up by the last token of a
+// node, where the span only records where it starts. For nodes ending in a
+// child, the child covers the rest of the token, and every other node ends in
+// a single character such as ';' or '}'.
+func lastTokenWidth(node Node) int {
+	switch node := node.(type) {
+	case *Integer:
+		return len(node.Value)
+	case *Variable:
+		return len(node.Value)
+	case *FieldAccess:
+		return len(node.Field)
+	case *Character:
+		if node.Length != 0 {
+			return node.Length
+		}
+		return len(node.String())
+	case *StringLiteral:
+		if node.Length != 0 {
+			return node.Length
+		}
+		if node.Raw {
+			return len(node.Value) + 2
+		}
+		return len(node.String())
+	case *NilLiteral:
+		return len("nil")
+	case *Primitive:
+		return len(primitiveNames[node.Type])
+	case *NamedType:
+		return len(node.Name)
+	}
+	return 1
+}
+
+// before checks if the position a comes before b.
+func before(a, b token.SourceInformation) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
@@ -0,0 +1,195 @@
+package ast
+
+// Rewrite rebuilds a tree bottom-up, replacing each node with the result of
+// calling fn on it. The children of a node are rewritten before fn is called
+// on the node itself, and fn is always given a fresh copy of the node so it is
+// free to modify it. The original tree is left unchanged.
+//
+// fn must return a node of the same kind as the one it was given, that is a
+// Statement for a Statement, an Expression for an Expression, a Type for a
+// Type, and a StringLiteral for a StringLiteral. Passing a function that
+// returns its argument clones the tree.
+func Rewrite(node Node, fn func(Node) Node) Node {
+	switch n := node.(type) {
+	case *Empty:
+		c := *n
+		return fn(&c)
+	case *ExpressionStatement:
+		c := *n
+		c.Expression = rewriteExpression(n.Expression, fn)
+		return fn(&c)
+	case *Assignment:
+		c := *n
+		c.Left = rewriteExpression(n.Left, fn)
+		c.Right = rewriteExpression(n.Right, fn)
+		return fn(&c)
+	case *Declaration:
+		c := *n
+		c.Type = rewriteType(n.Type, fn)
+		if n.Value != nil {
+			c.Value = rewriteExpression(n.Value, fn)
+		}
+		return fn(&c)
+	case *TypeDeclaration:
+		c := *n
+		c.Type = rewriteType(n.Type, fn)
+		return fn(&c)
+	case *IfStatement:
+		c := *n
+		c.Condition = rewriteExpression(n.Condition, fn)
+		c.Statement1 = rewriteStatement(n.Statement1, fn)
+		c.Statement2 = rewriteStatement(n.Statement2, fn)
+		return fn(&c)
+	case *WhileStatement:
+		c := *n
+		c.Condition = rewriteExpression(n.Condition, fn)
+		c.Statement = rewriteStatement(n.Statement, fn)
+		if n.Else != nil {
+			c.Else = rewriteStatement(n.Else, fn)
+		}
+		return fn(&c)
+	case *AssertStatement:
+		c := *n
+		c.Condition = rewriteExpression(n.Condition, fn)
+		return fn(&c)
+	case *DeferStatement:
+		c := *n
+		c.Statement = rewriteStatement(n.Statement, fn)
+		return fn(&c)
+	case *LabeledStatement:
+		c := *n
+		c.Statement = rewriteStatement(n.Statement, fn)
+		return fn(&c)
+	case *BreakStatement:
+		c := *n
+		return fn(&c)
+	case *ContinueStatement:
+		c := *n
+		return fn(&c)
+	case *PrintfStatement:
+		c := *n
+		c.Format = Rewrite(n.Format, fn).(*StringLiteral)
+		c.Arguments = make([]Expression, len(n.Arguments))
+		for i, arg := range n.Arguments {
+			c.Arguments[i] = rewriteExpression(arg, fn)
+		}
+		return fn(&c)
+	case *SwitchStatement:
+		c := *n
+		c.Value = rewriteExpression(n.Value, fn)
+		c.Cases = make([]*SwitchCase, len(n.Cases))
+		for i, sc := range n.Cases {
+			rewritten := *sc
+			if sc.Value != nil {
+				rewritten.Value = rewriteExpression(sc.Value, fn)
+			}
+			rewritten.Statements = make([]Statement, len(sc.Statements))
+			for j, stmt := range sc.Statements {
+				rewritten.Statements[j] = rewriteStatement(stmt, fn)
+			}
+			c.Cases[i] = &rewritten
+		}
+		return fn(&c)
+	case *BlockStatement:
+		c := *n
+		c.Statements = make([]Statement, len(n.Statements))
+		for i, stmt := range n.Statements {
+			c.Statements[i] = rewriteStatement(stmt, fn)
+		}
+		return fn(&c)
+	case *StringLiteral:
+		c := *n
+		return fn(&c)
+	case *Integer:
+		c := *n
+		return fn(&c)
+	case *Character:
+		c := *n
+		return fn(&c)
+	case *NilLiteral:
+		c := *n
+		return fn(&c)
+	case *Variable:
+		c := *n
+		return fn(&c)
+	case *BinaryOperator:
+		c := *n
+		c.Left = rewriteExpression(n.Left, fn)
+		c.Right = rewriteExpression(n.Right, fn)
+		return fn(&c)
+	case *UnaryOperator:
+		c := *n
+		c.Value = rewriteExpression(n.Value, fn)
+		return fn(&c)
+	case *Subscript:
+		c := *n
+		c.Value = rewriteExpression(n.Value, fn)
+		c.Index = rewriteExpression(n.Index, fn)
+		return fn(&c)
+	case *FieldAccess:
+		c := *n
+		c.Value = rewriteExpression(n.Value, fn)
+		return fn(&c)
+	case *ArrayLiteral:
+		c := *n
+		c.Elements = make([]Expression, len(n.Elements))
+		for i, elem := range n.Elements {
+			c.Elements[i] = rewriteExpression(elem, fn)
+		}
+		return fn(&c)
+	case *StatementExpression:
+		c := *n
+		c.Statements = make([]Statement, len(n.Statements))
+		for i, stmt := range n.Statements {
+			c.Statements[i] = rewriteStatement(stmt, fn)
+		}
+		c.Value = rewriteExpression(n.Value, fn)
+		return fn(&c)
+	case *Primitive:
+		c := *n
+		return fn(&c)
+	case *ArrayType:
+		c := *n
+		c.Type = rewriteType(n.Type, fn)
+		return fn(&c)
+	case *NamedType:
+		c := *n
+		return fn(&c)
+	case *PointerType:
+		c := *n
+		c.Type = rewriteType(n.Type, fn)
+		return fn(&c)
+	case *FunctionType:
+		c := *n
+		c.Parameters = make([]Type, len(n.Parameters))
+		for i, param := range n.Parameters {
+			c.Parameters[i] = rewriteType(param, fn)
+		}
+		if n.Return != nil {
+			c.Return = rewriteType(n.Return, fn)
+		}
+		return fn(&c)
+	case *StructType:
+		c := *n
+		c.Fields = make([]*StructField, len(n.Fields))
+		for i, field := range n.Fields {
+			f := *field
+			f.Type = rewriteType(field.Type, fn)
+			c.Fields[i] = &f
+		}
+		return fn(&c)
+	}
+	panic("unhandled node type")
+}
+
+func rewriteStatement(stmt Statement, fn func(Node) Node) Statement {
+	return Rewrite(stmt, fn).(Statement)
+}
+
+func rewriteExpression(expr Expression, fn func(Node) Node) Expression {
+	return Rewrite(expr, fn).(Expression)
+}
+
+func rewriteType(typ Type, fn func(Node) Node) Type {
+	return Rewrite(typ, fn).(Type)
+}
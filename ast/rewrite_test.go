@@ -0,0 +1,52 @@
+package ast
+
+import "testing"
+
+func TestRewrite(t *testing.T) {
+	one := func() *Integer { return &Integer{Value: "1"} }
+	// while 1 { a[1] = 1 + *b; if 3 1; }
+	tree := &WhileStatement{
+		Condition: one(),
+		Statement: &BlockStatement{
+			Statements: []Statement{
+				&Assignment{
+					Left: &Subscript{Value: &Variable{Value: "a"}, Index: one()},
+					Right: &BinaryOperator{
+						Type:  BinaryAdd,
+						Left:  one(),
+						Right: &UnaryOperator{Type: UnaryDereference, Value: &Variable{Value: "b"}},
+					},
+				},
+				&IfStatement{
+					Condition:  &Integer{Value: "3"},
+					Statement1: &ExpressionStatement{Expression: one()},
+					Statement2: &Empty{},
+				},
+			},
+		},
+	}
+	before := tree.String()
+	out := Rewrite(tree, func(n Node) Node {
+		if i, ok := n.(*Integer); ok && i.Value == "1" {
+			i.Value = "2"
+		}
+		return n
+	})
+	expected := "While[2, Block[" +
+		"Assignment[Subscript[a, 2], BinaryOperator['+', 2, UnaryOperator['*', b]]], " +
+		"If[3, ExpressionStatement[2], Empty[]]]]"
+	if out.String() != expected {
+		t.Error(
+			"For", before,
+			"expected", expected,
+			"got", out.String(),
+		)
+	}
+	if tree.String() != before {
+		t.Error(
+			"For", before,
+			"expected", "original tree to be unchanged",
+			"got", tree.String(),
+		)
+	}
+}
@@ -0,0 +1,195 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// binaryNames maps each binary operator to its name in S-expressions.
+var binaryNames = map[BinaryOperatorType]string{
+	BinaryAdd:         "add",
+	BinarySub:         "sub",
+	BinaryMul:         "mul",
+	BinaryDiv:         "div",
+	BinaryLessThan:    "lt",
+	BinaryGreaterThan: "gt",
+	BinaryEqual:       "eq",
+	BinaryNotEqual:    "ne",
+}
+
+// unaryNames maps each unary operator to its name in S-expressions.
+var unaryNames = map[UnaryOperatorType]string{
+	UnaryDereference: "deref",
+	UnaryMinus:       "neg",
+	UnaryAddress:     "addr",
+}
+
+// primitiveNames maps each primitive type to its name in S-expressions.
+var primitiveNames = map[PrimitiveType]string{
+	IntType:  "int",
+	CharType: "char",
+}
+
+// ToSExpr converts a node into a Lisp-style S-expression, such as
+// (binop add (var a) (int 5)) for a + 5. Unlike String, every node has a
+// short lower case name, so the output is compact and easy to compare.
+func ToSExpr(node Node) string {
+	var buf strings.Builder
+	writeSExpr(&buf, node)
+	return buf.String()
+}
+
+// writeSExpr writes the S-expression for a node to buf.
+func writeSExpr(buf *strings.Builder, node Node) {
+	switch n := node.(type) {
+	case *Empty:
+		buf.WriteString("(empty)")
+	case *ExpressionStatement:
+		list(buf, "expr", n.Expression)
+	case *Assignment:
+		list(buf, "assign", n.Left, n.Right)
+	case *Declaration:
+		buf.WriteString("(decl " + n.Name + " ")
+		writeSExpr(buf, n.Type)
+		if n.Value != nil {
+			buf.WriteByte(' ')
+			writeSExpr(buf, n.Value)
+		}
+		buf.WriteByte(')')
+	case *TypeDeclaration:
+		list(buf, "type "+n.Name, n.Type)
+	case *IfStatement:
+		list(buf, "if", n.Condition, n.Statement1, n.Statement2)
+	case *WhileStatement:
+		if n.Else != nil {
+			list(buf, "while", n.Condition, n.Statement, n.Else)
+		} else {
+			list(buf, "while", n.Condition, n.Statement)
+		}
+	case *AssertStatement:
+		list(buf, "assert", n.Condition)
+	case *DeferStatement:
+		list(buf, "defer", n.Statement)
+	case *LabeledStatement:
+		buf.WriteString("(label " + n.Label + " ")
+		writeSExpr(buf, n.Statement)
+		buf.WriteByte(')')
+	case *BreakStatement:
+		branch(buf, "break", n.Label)
+	case *ContinueStatement:
+		branch(buf, "continue", n.Label)
+	case *PrintfStatement:
+		buf.WriteString("(printf " + n.Format.String())
+		for _, arg := range n.Arguments {
+			buf.WriteByte(' ')
+			writeSExpr(buf, arg)
+		}
+		buf.WriteByte(')')
+	case *SwitchStatement:
+		buf.WriteString("(switch ")
+		writeSExpr(buf, n.Value)
+		for _, sc := range n.Cases {
+			buf.WriteByte(' ')
+			if sc.Value == nil {
+				buf.WriteString("(default")
+			} else {
+				buf.WriteString("(case ")
+				writeSExpr(buf, sc.Value)
+			}
+			for _, stmt := range sc.Statements {
+				buf.WriteByte(' ')
+				writeSExpr(buf, stmt)
+			}
+			buf.WriteByte(')')
+		}
+		buf.WriteByte(')')
+	case *BlockStatement:
+		nodes := make([]Node, len(n.Statements))
+		for i, stmt := range n.Statements {
+			nodes[i] = stmt
+		}
+		list(buf, "block", nodes...)
+	case *Integer:
+		buf.WriteString("(int " + n.Value + ")")
+	case *Character:
+		fmt.Fprintf(buf, "(char %q)", n.Value)
+	case *StringLiteral:
+		buf.WriteString(n.String())
+	case *NilLiteral:
+		buf.WriteString("(nil)")
+	case *Variable:
+		buf.WriteString("(var " + n.Value + ")")
+	case *BinaryOperator:
+		list(buf, "binop "+binaryNames[n.Type], n.Left, n.Right)
+	case *UnaryOperator:
+		list(buf, "unop "+unaryNames[n.Type], n.Value)
+	case *Subscript:
+		list(buf, "index", n.Value, n.Index)
+	case *FieldAccess:
+		list(buf, "field "+n.Field, n.Value)
+	case *ArrayLiteral:
+		nodes := make([]Node, len(n.Elements))
+		for i, elem := range n.Elements {
+			nodes[i] = elem
+		}
+		list(buf, "list", nodes...)
+	case *StatementExpression:
+		nodes := make([]Node, 0, len(n.Statements)+1)
+		for _, stmt := range n.Statements {
+			nodes = append(nodes, stmt)
+		}
+		list(buf, "stmtexpr", append(nodes, n.Value)...)
+	case *Primitive:
+		buf.WriteString(primitiveNames[n.Type])
+	case *NamedType:
+		buf.WriteString("(named " + n.Name + ")")
+	case *ArrayType:
+		if n.Length == UnknownLength {
+			list(buf, "array", n.Type)
+		} else {
+			list(buf, fmt.Sprintf("array %d", n.Length), n.Type)
+		}
+	case *PointerType:
+		list(buf, "ptr", n.Type)
+	case *FunctionType:
+		params := make([]Node, len(n.Parameters))
+		for i, param := range n.Parameters {
+			params[i] = param
+		}
+		buf.WriteString("(func ")
+		list(buf, "params", params...)
+		if n.Return != nil {
+			buf.WriteByte(' ')
+			writeSExpr(buf, n.Return)
+		}
+		buf.WriteByte(')')
+	case *StructType:
+		buf.WriteString("(struct")
+		for _, field := range n.Fields {
+			buf.WriteByte(' ')
+			list(buf, "field "+field.Name, field.Type)
+		}
+		buf.WriteByte(')')
+	default:
+		panic("unhandled node type")
+	}
+}
+
+// list writes an S-expression made up of a head followed by nodes.
+func list(buf *strings.Builder, head string, nodes ...Node) {
+	buf.WriteString("(" + head)
+	for _, node := range nodes {
+		buf.WriteByte(' ')
+		writeSExpr(buf, node)
+	}
+	buf.WriteByte(')')
+}
+
+// branch writes a break or continue statement, with its label if it has one.
+func branch(buf *strings.Builder, head, label string) {
+	buf.WriteString("(" + head)
+	if label != "" {
+		buf.WriteString(" " + label)
+	}
+	buf.WriteByte(')')
+}
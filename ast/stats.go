@@ -0,0 +1,117 @@
+package ast
+
+// Depth gets the maximum nesting depth of a tree. A node with no children has
+// a depth of 1.
+func Depth(node Node) int {
+	depth := 0
+	for _, child := range children(node) {
+		if d := Depth(child); d > depth {
+			depth = d
+		}
+	}
+	return depth + 1
+}
+
+// Count gets the total number of nodes in a tree, including the root.
+func Count(node Node) int {
+	count := 1
+	for _, child := range children(node) {
+		count += Count(child)
+	}
+	return count
+}
+
+// children gets the immediate children of a node, in source order. The cases
+// of a switch statement are not nodes themselves, so their values and
+// statements are treated as children of the switch.
+func children(node Node) []Node {
+	switch n := node.(type) {
+	case *ExpressionStatement:
+		return []Node{n.Expression}
+	case *Assignment:
+		return []Node{n.Left, n.Right}
+	case *Declaration:
+		if n.Value != nil {
+			return []Node{n.Type, n.Value}
+		}
+		return []Node{n.Type}
+	case *TypeDeclaration:
+		return []Node{n.Type}
+	case *IfStatement:
+		return []Node{n.Condition, n.Statement1, n.Statement2}
+	case *WhileStatement:
+		if n.Else != nil {
+			return []Node{n.Condition, n.Statement, n.Else}
+		}
+		return []Node{n.Condition, n.Statement}
+	case *AssertStatement:
+		return []Node{n.Condition}
+	case *DeferStatement:
+		return []Node{n.Statement}
+	case *LabeledStatement:
+		return []Node{n.Statement}
+	case *PrintfStatement:
+		nodes := []Node{n.Format}
+		for _, arg := range n.Arguments {
+			nodes = append(nodes, arg)
+		}
+		return nodes
+	case *SwitchStatement:
+		nodes := []Node{n.Value}
+		for _, sc := range n.Cases {
+			if sc.Value != nil {
+				nodes = append(nodes, sc.Value)
+			}
+			for _, stmt := range sc.Statements {
+				nodes = append(nodes, stmt)
+			}
+		}
+		return nodes
+	case *BlockStatement:
+		nodes := make([]Node, len(n.Statements))
+		for i, stmt := range n.Statements {
+			nodes[i] = stmt
+		}
+		return nodes
+	case *BinaryOperator:
+		return []Node{n.Left, n.Right}
+	case *UnaryOperator:
+		return []Node{n.Value}
+	case *Subscript:
+		return []Node{n.Value, n.Index}
+	case *FieldAccess:
+		return []Node{n.Value}
+	case *ArrayLiteral:
+		nodes := make([]Node, len(n.Elements))
+		for i, elem := range n.Elements {
+			nodes[i] = elem
+		}
+		return nodes
+	case *StatementExpression:
+		nodes := make([]Node, 0, len(n.Statements)+1)
+		for _, stmt := range n.Statements {
+			nodes = append(nodes, stmt)
+		}
+		return append(nodes, n.Value)
+	case *ArrayType:
+		return []Node{n.Type}
+	case *PointerType:
+		return []Node{n.Type}
+	case *FunctionType:
+		nodes := make([]Node, 0, len(n.Parameters)+1)
+		for _, param := range n.Parameters {
+			nodes = append(nodes, param)
+		}
+		if n.Return != nil {
+			nodes = append(nodes, n.Return)
+		}
+		return nodes
+	case *StructType:
+		nodes := make([]Node, len(n.Fields))
+		for i, field := range n.Fields {
+			nodes[i] = field.Type
+		}
+		return nodes
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package ast
+
+import "testing"
+
+func TestDepthAndCount(t *testing.T) {
+	tests := []struct {
+		in    Node
+		depth int
+		count int
+	}{
+		{&Variable{Value: "a"}, 1, 1},
+		{
+			// a + b[c]
+			&BinaryOperator{
+				Type:  BinaryAdd,
+				Left:  &Variable{Value: "a"},
+				Right: &Subscript{Value: &Variable{Value: "b"}, Index: &Variable{Value: "c"}},
+			},
+			3, 5,
+		},
+		{
+			// var p ptr to array(3) of int = nil;
+			&Declaration{
+				Name: "p",
+				Type: &PointerType{
+					Type: &ArrayType{Length: 3, Type: &Primitive{Type: IntType}},
+				},
+				Value: &NilLiteral{},
+			},
+			4, 5,
+		},
+		{
+			// var f func(int, char) int;
+			&Declaration{
+				Name: "f",
+				Type: &FunctionType{
+					Parameters: []Type{&Primitive{Type: IntType}, &Primitive{Type: CharType}},
+					Return:     &Primitive{Type: IntType},
+				},
+			},
+			3, 5,
+		},
+		{
+			// while 1 { if a { } }
+			&WhileStatement{
+				Condition: &Integer{Value: "1"},
+				Statement: &BlockStatement{
+					Statements: []Statement{
+						&IfStatement{
+							Condition:  &Variable{Value: "a"},
+							Statement1: &BlockStatement{},
+							Statement2: &Empty{},
+						},
+					},
+				},
+			},
+			4, 7,
+		},
+		{
+			// switch x { case 1: y; default: }
+			&SwitchStatement{
+				Value: &Variable{Value: "x"},
+				Cases: []*SwitchCase{
+					{
+						Value:      &Integer{Value: "1"},
+						Statements: []Statement{&ExpressionStatement{Expression: &Variable{Value: "y"}}},
+					},
+					{},
+				},
+			},
+			3, 5,
+		},
+	}
+	for _, test := range tests {
+		depth, count := Depth(test.in), Count(test.in)
+		if depth != test.depth || count != test.count {
+			t.Error(
+				"For", test.in,
+				"expected", test.depth, test.count,
+				"got", depth, count,
+			)
+		}
+	}
+}
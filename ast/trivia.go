@@ -0,0 +1,35 @@
+package ast
+
+// Trivia holds the parts of the source around a statement that don't affect
+// its meaning, so that a formatter can reproduce them.
+type Trivia struct {
+	// BlankLines is the number of blank lines before the statement and its
+	// leading comments.
+	BlankLines int
+	// Leading holds the comments on the lines before the statement.
+	Leading []string
+	// Trailing is the comment after the statement on its last line, or the
+	// empty string if there isn't one.
+	Trailing string
+}
+
+// HasTrivia is implemented by the nodes that trivia can be attached to.
+type HasTrivia interface {
+	Trivia() *Trivia
+	SetTrivia(*Trivia)
+}
+
+// triviaHolder is embedded in statements to let trivia be attached to them.
+type triviaHolder struct {
+	trivia *Trivia
+}
+
+// Trivia gets the trivia attached to a statement, or nil if none was recorded.
+func (t *triviaHolder) Trivia() *Trivia {
+	return t.trivia
+}
+
+// SetTrivia attaches trivia to a statement.
+func (t *triviaHolder) SetTrivia(trivia *Trivia) {
+	t.trivia = trivia
+}
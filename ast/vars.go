@@ -0,0 +1,102 @@
+package ast
+
+// FreeVars gets the names of the variables read by an expression, in the
+// order they first occur. Each name appears at most once. Variables declared
+// inside a statement expression are not free, except where they are read
+// before their declaration.
+func FreeVars(e Expression) []string {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	var walk func(e Expression, bound map[string]bool)
+	var statement func(s Statement, bound map[string]bool)
+	// scope copies the bound names, so that declarations in an inner
+	// scope are forgotten when it ends.
+	scope := func(bound map[string]bool) map[string]bool {
+		inner := make(map[string]bool, len(bound))
+		for name := range bound {
+			inner[name] = true
+		}
+		return inner
+	}
+	walk = func(e Expression, bound map[string]bool) {
+		switch e := e.(type) {
+		case *Variable:
+			if !seen[e.Value] && !bound[e.Value] {
+				seen[e.Value] = true
+				names = append(names, e.Value)
+			}
+		case *BinaryOperator:
+			walk(e.Left, bound)
+			walk(e.Right, bound)
+		case *UnaryOperator:
+			walk(e.Value, bound)
+		case *Subscript:
+			walk(e.Value, bound)
+			walk(e.Index, bound)
+		case *FieldAccess:
+			walk(e.Value, bound)
+		case *ArrayLiteral:
+			for _, elem := range e.Elements {
+				walk(elem, bound)
+			}
+		case *StatementExpression:
+			inner := scope(bound)
+			for _, s := range e.Statements {
+				statement(s, inner)
+			}
+			walk(e.Value, inner)
+		}
+	}
+	statement = func(s Statement, bound map[string]bool) {
+		switch s := s.(type) {
+		case *ExpressionStatement:
+			walk(s.Expression, bound)
+		case *Assignment:
+			walk(s.Left, bound)
+			walk(s.Right, bound)
+		case *Declaration:
+			if s.Value != nil {
+				walk(s.Value, bound)
+			}
+			bound[s.Name] = true
+		case *IfStatement:
+			walk(s.Condition, bound)
+			statement(s.Statement1, scope(bound))
+			statement(s.Statement2, scope(bound))
+		case *WhileStatement:
+			walk(s.Condition, bound)
+			statement(s.Statement, scope(bound))
+			if s.Else != nil {
+				statement(s.Else, scope(bound))
+			}
+		case *AssertStatement:
+			walk(s.Condition, bound)
+		case *PrintfStatement:
+			for _, arg := range s.Arguments {
+				walk(arg, bound)
+			}
+		case *DeferStatement:
+			statement(s.Statement, bound)
+		case *SwitchStatement:
+			walk(s.Value, bound)
+			for _, c := range s.Cases {
+				if c.Value != nil {
+					walk(c.Value, bound)
+				}
+				inner := scope(bound)
+				for _, s := range c.Statements {
+					statement(s, inner)
+				}
+			}
+		case *LabeledStatement:
+			statement(s.Statement, bound)
+		case *BlockStatement:
+			inner := scope(bound)
+			for _, s := range s.Statements {
+				statement(s, inner)
+			}
+		}
+	}
+	walk(e, make(map[string]bool))
+	return names
+}
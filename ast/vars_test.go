@@ -0,0 +1,77 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFreeVars(t *testing.T) {
+	tests := []struct {
+		in  Expression
+		out []string
+	}{
+		{
+			// a + b[c]
+			&BinaryOperator{
+				Type:  BinaryAdd,
+				Left:  &Variable{Value: "a"},
+				Right: &Subscript{Value: &Variable{Value: "b"}, Index: &Variable{Value: "c"}},
+			},
+			[]string{"a", "b", "c"},
+		},
+		{
+			// 1 + 2
+			&BinaryOperator{
+				Type:  BinaryAdd,
+				Left:  &Integer{Value: "1"},
+				Right: &Integer{Value: "2"},
+			},
+			[]string{},
+		},
+		{
+			// *a - a
+			&BinaryOperator{
+				Type:  BinarySub,
+				Left:  &UnaryOperator{Type: UnaryDereference, Value: &Variable{Value: "a"}},
+				Right: &Variable{Value: "a"},
+			},
+			[]string{"a"},
+		},
+		{
+			// ({ y = x; x })
+			&StatementExpression{
+				Statements: []Statement{
+					&Assignment{Left: &Variable{Value: "y"}, Right: &Variable{Value: "x"}},
+				},
+				Value: &Variable{Value: "x"},
+			},
+			[]string{"y", "x"},
+		},
+		{
+			// ({ var y int = x; { var z int = y; } y + z })
+			&StatementExpression{
+				Statements: []Statement{
+					&Declaration{Name: "y", Type: &Primitive{Type: IntType}, Value: &Variable{Value: "x"}},
+					&BlockStatement{Statements: []Statement{
+						&Declaration{Name: "z", Type: &Primitive{Type: IntType}, Value: &Variable{Value: "y"}},
+					}},
+				},
+				Value: &BinaryOperator{
+					Type:  BinaryAdd,
+					Left:  &Variable{Value: "y"},
+					Right: &Variable{Value: "z"},
+				},
+			},
+			[]string{"x", "z"},
+		},
+	}
+	for _, test := range tests {
+		if out := FreeVars(test.in); !reflect.DeepEqual(out, test.out) {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", out,
+			)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/cmgn/compiler/ast"
+	"github.com/cmgn/compiler/compile"
+	"github.com/cmgn/compiler/diag"
+	"github.com/cmgn/compiler/interp"
+	"github.com/cmgn/compiler/lexer"
+	"github.com/cmgn/compiler/parser"
+	"github.com/cmgn/compiler/sema"
+	"github.com/cmgn/compiler/token"
+)
+
+// command is a subcommand of the compiler. It is given the arguments after
+// its name and writes any output to out.
+type command func(out io.Writer, args []string) error
+
+// commands maps the names of the subcommands to the functions that run them.
+var commands = map[string]command{
+	"lex":   lexCommand,
+	"parse": parseCommand,
+	"run":   runCommand,
+	"build": buildCommand,
+	"check": checkCommand,
+}
+
+// dispatch runs the subcommand named by the first argument.
+func dispatch(out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: compiler <lex|parse|run|build|check> [flags] <file>")
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %s", args[0])
+	}
+	return cmd(out, args[1:])
+}
+
+// options holds the configuration of each pass, as set by the flags of a
+// subcommand.
+type options struct {
+	lexer lexer.Config
+	sema  sema.Config
+	// json says whether errors and warnings are written as JSON.
+	json bool
+	// time says whether to write the time taken by each phase to
+	// timingOutput once the subcommand is done.
+	time bool
+	// timer records the time taken by each phase.
+	timer *compile.Timer
+}
+
+// timingOutput is where the summary requested by the -time flag is written.
+var timingOutput io.Writer = os.Stderr
+
+// writeTimings writes the time taken by each phase to timingOutput, if the
+// -time flag was given.
+func (opts *options) writeTimings() {
+	if opts.time {
+		opts.timer.WriteSummary(timingOutput)
+	}
+}
+
+// newFlagSet creates the flag set for a subcommand, with the options that
+// every subcommand accepts. Every warning is enabled.
+func newFlagSet(out io.Writer, name string) (*flag.FlagSet, *options) {
+	opts := &options{lexer: lexer.DefaultConfig, sema: sema.DefaultConfig, timer: &compile.Timer{}}
+	opts.sema.WarnShadowing = true
+	opts.sema.WarnUnused = true
+	opts.sema.WarnSelfComparison = true
+	opts.sema.WarnConstantCondition = true
+	opts.sema.WarnMixedComparison = true
+	opts.sema.WarnSelfAssignment = true
+	opts.sema.WarnNonTerminating = true
+	opts.sema.WarnRedundantCondition = true
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.IntVar(&opts.lexer.TabWidth, "tabwidth", opts.lexer.TabWidth, "distance between tab stops in columns")
+	fs.BoolVar(&opts.lexer.InsertSemiColons, "semicolons", opts.lexer.InsertSemiColons, "insert semicolons at line ends")
+	fs.Var((*strictFlag)(&opts.sema.Strict), "strict", "report warnings as errors, optionally only those in a comma separated list of categories")
+	fs.Var((*diagnosticsFlag)(&opts.json), "diagnostics", "format of errors and warnings, text or json")
+	fs.BoolVar(&opts.time, "time", false, "write the time taken by each phase to stderr")
+	return fs, opts
+}
+
+// diagnosticsFlag is the value of the -diagnostics flag. It is true if errors
+// and warnings should be written to the output as JSON, one per line.
+type diagnosticsFlag bool
+
+func (f *diagnosticsFlag) String() string {
+	if *f {
+		return "json"
+	}
+	return "text"
+}
+
+func (f *diagnosticsFlag) Set(s string) error {
+	switch s {
+	case "text":
+		*f = false
+	case "json":
+		*f = true
+	default:
+		return fmt.Errorf("unknown diagnostics format %s", s)
+	}
+	return nil
+}
+
+// errReported is returned by subcommands for errors that have already been
+// written to the output as JSON.
+var errReported = errors.New("errors were reported as diagnostics")
+
+// errorList is the errors found compiling a program, which are printed one per
+// line.
+type errorList []error
+
+func (l errorList) Error() string {
+	strs := make([]string, len(l))
+	for i, err := range l {
+		strs[i] = err.Error()
+	}
+	return strings.Join(strs, "\n")
+}
+
+// report returns an error from lexing, parsing or checking a file. When
+// diagnostics are written as JSON the error is written to out and errReported
+// is returned instead.
+func report(out io.Writer, opts *options, err error) error {
+	if !opts.json {
+		return err
+	}
+	if werr := diag.WriteJSON(out, diag.FromError(err)); werr != nil {
+		return werr
+	}
+	return errReported
+}
+
+// strictFlag is the value of the -strict flag. On its own the flag selects
+// every category of warning, or it can be given a list of categories.
+type strictFlag []sema.Category
+
+func (f *strictFlag) String() string {
+	strs := make([]string, len(*f))
+	for i, category := range *f {
+		strs[i] = string(category)
+	}
+	return strings.Join(strs, ",")
+}
+
+func (f *strictFlag) Set(s string) error {
+	switch s {
+	case "true":
+		*f = sema.Categories
+		return nil
+	case "false":
+		*f = nil
+		return nil
+	}
+	*f = nil
+	for _, name := range strings.Split(s, ",") {
+		category, ok := lookupCategory(name)
+		if !ok {
+			return fmt.Errorf("unknown warning category %s", name)
+		}
+		*f = append(*f, category)
+	}
+	return nil
+}
+
+// IsBoolFlag allows -strict to be given without a value.
+func (f *strictFlag) IsBoolFlag() bool {
+	return true
+}
+
+// lookupCategory finds the category of warning with the given name.
+func lookupCategory(name string) (sema.Category, bool) {
+	for _, category := range sema.Categories {
+		if string(category) == name {
+			return category, true
+		}
+	}
+	return "", false
+}
+
+// parseArgs parses the flags of a subcommand, which must be followed by
+// exactly one file name, and returns the name of the file.
+func parseArgs(fs *flag.FlagSet, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 {
+		return "", fmt.Errorf("usage: compiler %s [flags] <file>", fs.Name())
+	}
+	return fs.Arg(0), nil
+}
+
+// parseProgramArgs parses the flags of a subcommand that compiles a program,
+// which must be followed by the names of the one or more files making up the
+// program, and returns the names of the files.
+func parseProgramArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() == 0 {
+		return nil, fmt.Errorf("usage: compiler %s [flags] <file>...", fs.Name())
+	}
+	return fs.Args(), nil
+}
+
+func lexFile(filename string, opts *options) ([]*token.Token, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []*token.Token
+	opts.timer.Time("lex", func() {
+		tokens, err = lexer.LexWith(filename, string(contents), opts.lexer)
+	})
+	return tokens, err
+}
+
+func parseFile(filename string, opts *options) ([]ast.Statement, error) {
+	tokens, err := lexFile(filename, opts)
+	if err != nil {
+		return nil, err
+	}
+	var stmts []ast.Statement
+	opts.timer.Time("parse", func() {
+		stmts, err = parser.Parse(tokens)
+	})
+	return stmts, err
+}
+
+// compileFiles reads a set of files and compiles them as one program,
+// giving every error found.
+func compileFiles(filenames []string, opts *options) (*compile.Result, []error) {
+	sources := make([]compile.Source, len(filenames))
+	for i, filename := range filenames {
+		contents, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, []error{err}
+		}
+		sources[i] = compile.Source{Name: filename, Text: string(contents)}
+	}
+	cfg := compile.DefaultConfig
+	cfg.Lexer = opts.lexer
+	cfg.Sema = opts.sema
+	cfg.Timer = opts.timer
+	return compile.CompileProgram(sources, cfg)
+}
+
+// checkFiles compiles a set of files as one program, writing any warnings to
+// out. If there are errors, each of them is reported.
+func checkFiles(out io.Writer, filenames []string, opts *options) (*compile.Result, error) {
+	result, errs := compileFiles(filenames, opts)
+	if result != nil {
+		for _, warning := range result.Info.Warnings {
+			if opts.json {
+				diag.WriteJSON(out, diag.FromWarning(warning.Source, warning.Message))
+			} else {
+				fmt.Fprintf(out, "warning: %s\n", warning)
+			}
+		}
+	}
+	switch {
+	case len(errs) == 1:
+		return nil, report(out, opts, errs[0])
+	case len(errs) > 1 && opts.json:
+		for _, err := range errs {
+			if werr := diag.WriteJSON(out, diag.FromError(err)); werr != nil {
+				return nil, werr
+			}
+		}
+		return nil, errReported
+	case len(errs) > 1:
+		return nil, errorList(errs)
+	}
+	return result, nil
+}
+
+// lexCommand prints the tokens in a file.
+func lexCommand(out io.Writer, args []string) error {
+	fs, opts := newFlagSet(out, "lex")
+	filename, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	defer opts.writeTimings()
+	tokens, err := lexFile(filename, opts)
+	if err != nil {
+		return report(out, opts, err)
+	}
+	strs := make([]string, len(tokens))
+	for i, tok := range tokens {
+		strs[i] = tok.String()
+	}
+	fmt.Fprintln(out, strings.Join(strs, " "))
+	return nil
+}
+
+// parseCommand prints the syntax tree of each statement in a file.
+func parseCommand(out io.Writer, args []string) error {
+	fs, opts := newFlagSet(out, "parse")
+	filename, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	defer opts.writeTimings()
+	stmts, err := parseFile(filename, opts)
+	if err != nil {
+		return report(out, opts, err)
+	}
+	for _, stmt := range stmts {
+		fmt.Fprintln(out, stmt.String())
+	}
+	return nil
+}
+
+// runCommand checks a program made up of one or more files and runs it with
+// the interpreter.
+func runCommand(out io.Writer, args []string) error {
+	fs, opts := newFlagSet(out, "run")
+	noBoundsCheck := fs.Bool("no-bounds-check", false, "don't check that array indices are in range")
+	filenames, err := parseProgramArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	defer opts.writeTimings()
+	result, err := checkFiles(out, filenames, opts)
+	if err != nil {
+		return err
+	}
+	cfg := interp.DefaultConfig
+	cfg.Output = out
+	cfg.NoBoundsCheck = *noBoundsCheck
+	opts.timer.Time("run", func() {
+		err = interp.NewWith(cfg).EvalWith(result.Statements, result.Info)
+	})
+	return err
+}
+
+// checkCommand lexes, parses and checks a program made up of one or more
+// files without running it, writing every error and warning found to out. It
+// fails if there were any errors, which includes warnings made errors by
+// -strict.
+func checkCommand(out io.Writer, args []string) error {
+	fs, opts := newFlagSet(out, "check")
+	filenames, err := parseProgramArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	defer opts.writeTimings()
+	diagnostics, status := checkDiagnostics(filenames, opts)
+	for _, d := range diagnostics {
+		if opts.json {
+			diag.WriteJSON(out, d)
+		} else {
+			fmt.Fprintln(out, d.String())
+		}
+	}
+	if status != 0 {
+		return errReported
+	}
+	return nil
+}
+
+// checkDiagnostics runs every analysis on a program, giving the errors and
+// warnings found along with the status the check command exits with: 1 if
+// there were any errors or 0 if there were only warnings. Lexing and parsing
+// carry on after an error, so every error they find is given along with the
+// first error found by the type checker. The warnings come first, followed by
+// the errors sorted by position.
+func checkDiagnostics(filenames []string, opts *options) ([]diag.Diagnostic, int) {
+	result, errs := compileFiles(filenames, opts)
+	var diagnostics []diag.Diagnostic
+	if result != nil {
+		for _, warning := range result.Info.Warnings {
+			diagnostics = append(diagnostics, diag.FromWarning(warning.Source, warning.Message))
+		}
+	}
+	for _, err := range errs {
+		diagnostics = append(diagnostics, diag.FromError(err))
+	}
+	if len(errs) != 0 {
+		return diagnostics, 1
+	}
+	return diagnostics, 0
+}
+
+// buildCommand checks a program made up of one or more files ready for code
+// generation. There is no code generator yet, so valid programs are reported
+// as an error too.
+func buildCommand(out io.Writer, args []string) error {
+	fs, opts := newFlagSet(out, "build")
+	filenames, err := parseProgramArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	defer opts.writeTimings()
+	if _, err := checkFiles(out, filenames, opts); err != nil {
+		return err
+	}
+	return errors.New("build: code generation is not supported yet")
+}
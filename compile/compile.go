@@ -0,0 +1,128 @@
+// Package compile runs the passes of the compiler over a source file, from
+// lexing through to type checking.
+package compile
+
+import (
+	"sort"
+
+	"github.com/cmgn/compiler/ast"
+	"github.com/cmgn/compiler/diag"
+	"github.com/cmgn/compiler/lexer"
+	"github.com/cmgn/compiler/parser"
+	"github.com/cmgn/compiler/sema"
+	"github.com/cmgn/compiler/token"
+)
+
+// Config holds the options for each pass.
+type Config struct {
+	Lexer  lexer.Config
+	Parser parser.Config
+	Sema   sema.Config
+	// Timer records how long each pass takes, unless it is nil. Type
+	// checking resolves names as it goes, so both are timed as one check
+	// phase.
+	Timer *Timer
+}
+
+// DefaultConfig is the configuration with the default options for every
+// pass.
+var DefaultConfig = Config{
+	Lexer:  lexer.DefaultConfig,
+	Parser: parser.DefaultConfig,
+	Sema:   sema.DefaultConfig,
+}
+
+// Result holds the checked program.
+type Result struct {
+	// Program holds the statements of each file that could be parsed.
+	Program *Program
+	// Statements holds the statements of every file in order.
+	Statements []ast.Statement
+	// Info holds what the type checker found out about the statements,
+	// including any warnings.
+	Info *sema.Info
+}
+
+// Source is the name and contents of a source file.
+type Source struct {
+	Name string
+	Text string
+}
+
+// Compile lexes, parses and checks a source file, stopping before code
+// generation. Lexing and parsing always carry on after an error so that as
+// many problems as possible are reported, and the statements that could be
+// parsed are still checked. The errors from every pass are returned together,
+// sorted by the position they refer to.
+func Compile(filename, source string, cfg Config) (*Result, []error) {
+	return CompileProgram([]Source{{Name: filename, Text: source}}, cfg)
+}
+
+// CompileProgram compiles a set of source files as one program in the same
+// way as Compile. The files share a top level scope and are checked in the
+// order given, as though they were one file. If the same name is declared at
+// the top level of two files, the program isn't checked any further. Errors
+// are sorted by file, in the order the files were given, and then by position.
+func CompileProgram(sources []Source, cfg Config) (*Result, []error) {
+	var errs []error
+	tokens := make([][]*token.Token, len(sources))
+	cfg.Timer.Time("lex", func() {
+		for i, src := range sources {
+			var lexErrs []error
+			tokens[i], lexErrs = lexer.LexWithRecovery(src.Name, src.Text, cfg.Lexer)
+			errs = append(errs, lexErrs...)
+		}
+	})
+	parserCfg := cfg.Parser
+	parserCfg.Recover = true
+	prog := &Program{Files: make([]*File, len(sources))}
+	cfg.Timer.Time("parse", func() {
+		for i, src := range sources {
+			parsed, _ := parser.ParseWith(tokens[i], parserCfg)
+			errs = append(errs, parsed.Errors...)
+			prog.Files[i] = &File{Name: src.Name, Statements: parsed.Statements}
+		}
+	})
+	stmts := prog.Statements()
+	info := &sema.Info{}
+	cfg.Timer.Time("check", func() {
+		if _, resolveErrs := prog.Resolve(); len(resolveErrs) != 0 {
+			errs = append(errs, resolveErrs...)
+			return
+		}
+		var err error
+		if info, err = sema.Analyze(stmts, cfg.Sema); err != nil {
+			errs = append(errs, err)
+		}
+	})
+	order := make(map[string]int, len(sources))
+	for i := len(sources) - 1; i >= 0; i-- {
+		order[sources[i].Name] = i
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return before(errs[i], errs[j], order)
+	})
+	return &Result{Program: prog, Statements: stmts, Info: info}, errs
+}
+
+// before checks if error a refers to an earlier position in the sources than
+// error b, given the order of the files. Errors without a position sort
+// first.
+func before(a, b error, order map[string]int) bool {
+	ea, ok := a.(*diag.Error)
+	if !ok {
+		_, ok := b.(*diag.Error)
+		return ok
+	}
+	eb, ok := b.(*diag.Error)
+	if !ok {
+		return false
+	}
+	if fa, fb := order[ea.Source.FileName], order[eb.Source.FileName]; fa != fb {
+		return fa < fb
+	}
+	if ea.Source.Line != eb.Source.Line {
+		return ea.Source.Line < eb.Source.Line
+	}
+	return ea.Source.Column < eb.Source.Column
+}
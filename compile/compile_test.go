@@ -0,0 +1,185 @@
+package compile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	in := "var x int = 1;\nvar p ptr to int = x;\nx = ;\nvar y int = 2 # 3;\nx = x + 1;"
+	result, errs := Compile("test", in, DefaultConfig)
+	expected := []string{
+		"[test:2] cannot assign int to ptr to int",
+		"[test:3] unexpected ';'",
+		"[test:4] unexpected #",
+		"[test:4] expected ';', got '3'",
+	}
+	strs := make([]string, len(errs))
+	for i, err := range errs {
+		strs[i] = err.Error()
+	}
+	if strings.Join(strs, "\n") != strings.Join(expected, "\n") {
+		t.Error(
+			"For", in,
+			"expected", expected,
+			"got", strs,
+		)
+	}
+	if len(result.Statements) != 3 {
+		t.Error(
+			"For", in,
+			"expected", 3, "statements",
+			"got", result.Statements,
+		)
+	}
+}
+
+func TestCompileValid(t *testing.T) {
+	in := "var x int = 1;\nx = x + 1;"
+	result, errs := Compile("test", in, DefaultConfig)
+	if len(errs) != 0 || len(result.Statements) != 2 {
+		t.Error(
+			"For", in,
+			"expected", "no errors",
+			"got", result.Statements, errs,
+		)
+		return
+	}
+	if len(result.Info.Warnings) != 0 {
+		t.Error(
+			"For", in,
+			"expected", "no warnings",
+			"got", result.Info.Warnings,
+		)
+	}
+}
+
+func TestCompileProgram(t *testing.T) {
+	sources := []Source{
+		{Name: "a", Text: "var limit int = 10;\nvar p ptr to int;"},
+		{Name: "b", Text: "var x int = limit * 2;\np = &x;\nassert *p == 20;"},
+	}
+	result, errs := CompileProgram(sources, DefaultConfig)
+	if len(errs) != 0 || len(result.Program.Files) != 2 || len(result.Statements) != 5 {
+		t.Fatal(
+			"For", sources,
+			"expected", "no errors",
+			"got", result.Statements, errs,
+		)
+	}
+	scope, errs := result.Program.Resolve()
+	if len(errs) != 0 || scope["limit"] != result.Program.Files[0].Statements[0] ||
+		scope["x"] != result.Program.Files[1].Statements[0] {
+		t.Error(
+			"For", sources,
+			"expected", "limit and x in the shared scope",
+			"got", scope, errs,
+		)
+	}
+
+	tests := []struct {
+		sources []Source
+		errs    []string
+	}{
+		{
+			[]Source{
+				{Name: "a", Text: "var x int;\nvar y int;"},
+				{Name: "b", Text: "var z int;\nvar y char;"},
+			},
+			[]string{"[b:2] redeclaration of y, already declared at a:2"},
+		},
+		{
+			[]Source{
+				{Name: "a", Text: "var x int;\nvar x int;"},
+				{Name: "b", Text: "x = 1;"},
+			},
+			[]string{"[a:2] redeclaration of x"},
+		},
+		{
+			[]Source{
+				{Name: "a", Text: "type t int;"},
+				{Name: "b", Text: "var x int;\ntype t char;"},
+			},
+			[]string{"[b:2] type t already declared at a:1"},
+		},
+		{
+			// Types can be used by the files before them.
+			[]Source{
+				{Name: "a", Text: "var n node;\nvar p ptr to node = &n;"},
+				{Name: "b", Text: "type node struct { next ptr to node; };"},
+			},
+			nil,
+		},
+		{
+			// Files can only use what the files before them declare.
+			[]Source{
+				{Name: "a", Text: "x = 1;"},
+				{Name: "b", Text: "var x int;"},
+			},
+			[]string{"[a:1] undeclared variable x"},
+		},
+		{
+			[]Source{
+				{Name: "b", Text: "\n\nvar x int = ;"},
+				{Name: "a", Text: "var y int = ;"},
+			},
+			[]string{"[b:3] unexpected ';'", "[a:1] unexpected ';'"},
+		},
+	}
+	for _, test := range tests {
+		_, errs := CompileProgram(test.sources, DefaultConfig)
+		strs := make([]string, len(errs))
+		for i, err := range errs {
+			strs[i] = err.Error()
+		}
+		if strings.Join(strs, "\n") != strings.Join(test.errs, "\n") {
+			t.Error(
+				"For", test.sources,
+				"expected", test.errs,
+				"got", strs,
+			)
+		}
+	}
+}
+
+func TestTimer(t *testing.T) {
+	var buf strings.Builder
+	buf.WriteString("var x int = 1;\n")
+	for i := 0; i < 2000; i++ {
+		buf.WriteString("x = x * 2 + (x - 1) / 3;\nwhile x < 10 { x = x + 1; }\n")
+	}
+	timer := &Timer{}
+	cfg := DefaultConfig
+	cfg.Timer = timer
+	if _, errs := Compile("test", buf.String(), cfg); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	names := make([]string, len(timer.Phases))
+	for i, phase := range timer.Phases {
+		names[i] = phase.Name
+		if phase.Duration <= 0 {
+			t.Error(
+				"For", phase.Name,
+				"expected", "a positive duration",
+				"got", phase.Duration,
+			)
+		}
+	}
+	if strings.Join(names, " ") != "lex parse check" {
+		t.Error(
+			"For", "the phases",
+			"expected", "lex parse check",
+			"got", names,
+		)
+	}
+	var nilTimer *Timer
+	ran := false
+	nilTimer.Time("lex", func() { ran = true })
+	if !ran {
+		t.Error(
+			"For", "a nil timer",
+			"expected", "the function to run",
+			"got", "nothing",
+		)
+	}
+}
@@ -0,0 +1,63 @@
+package compile
+
+import (
+	"github.com/cmgn/compiler/ast"
+	"github.com/cmgn/compiler/diag"
+)
+
+// File is the statements parsed from a source file.
+type File struct {
+	Name       string
+	Statements []ast.Statement
+}
+
+// Program is a set of files compiled together. The files run one after
+// another in order, and share a top level scope, so a file can use the
+// variables declared at the top level of the files before it and the types
+// declared at the top level of any file.
+type Program struct {
+	Files []*File
+}
+
+// Statements gets the statements of every file in the program, in order.
+func (p *Program) Statements() []ast.Statement {
+	var stmts []ast.Statement
+	for _, file := range p.Files {
+		stmts = append(stmts, file.Statements...)
+	}
+	return stmts
+}
+
+// Resolve builds the top level scope shared by the files of the program,
+// mapping each variable declared at the top level of a file to its
+// declaration. It reports a variable or a type declared at the top level of
+// more than one file. A name declared twice in the same file is left for the
+// type checker to report, as it would be in a program of one file.
+func (p *Program) Resolve() (map[string]*ast.Declaration, []error) {
+	scope := make(map[string]*ast.Declaration)
+	types := make(map[string]*ast.TypeDeclaration)
+	var errs []error
+	for _, file := range p.Files {
+		for _, stmt := range file.Statements {
+			switch decl := stmt.(type) {
+			case *ast.Declaration:
+				prev, ok := scope[decl.Name]
+				if !ok {
+					scope[decl.Name] = decl
+				} else if prev.Source.FileName != file.Name {
+					errs = append(errs, diag.Errorf(decl.Source, "redeclaration of %s, already declared at %s",
+						decl.Name, prev.Source.String()))
+				}
+			case *ast.TypeDeclaration:
+				prev, ok := types[decl.Name]
+				if !ok {
+					types[decl.Name] = decl
+				} else if prev.Source.FileName != file.Name {
+					errs = append(errs, diag.Errorf(decl.Source, "type %s already declared at %s",
+						decl.Name, prev.Source.String()))
+				}
+			}
+		}
+	}
+	return scope, errs
+}
@@ -0,0 +1,52 @@
+package compile
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Phase is a named part of compilation and how long it took.
+type Phase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Timer records how long each phase of compilation takes, in the order they
+// ran. The zero value is ready to use, and a nil *Timer records nothing.
+type Timer struct {
+	Phases []Phase
+}
+
+// Time runs fn and records the wall-clock time it took as a phase with the
+// given name.
+func (t *Timer) Time(name string, fn func()) {
+	if t == nil {
+		fn()
+		return
+	}
+	start := time.Now()
+	fn()
+	t.Phases = append(t.Phases, Phase{Name: name, Duration: time.Since(start)})
+}
+
+// Total gets the time taken by every phase together.
+func (t *Timer) Total() time.Duration {
+	var total time.Duration
+	for _, phase := range t.Phases {
+		total += phase.Duration
+	}
+	return total
+}
+
+// WriteSummary writes the time taken by each phase to w, one per line,
+// followed by the total.
+func (t *Timer) WriteSummary(w io.Writer) error {
+	for _, phase := range t.Phases {
+		if _, err := fmt.Fprintf(w, "%-8s %v\n", phase.Name, phase.Duration); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%-8s %v\n", "total", t.Total())
+	return err
+}
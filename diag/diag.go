@@ -0,0 +1,76 @@
+// Package diag provides helpers for reporting diagnostics against the
+// source they refer to.
+package diag
+
+import (
+	"strings"
+
+	"github.com/cmgn/compiler/token"
+)
+
+// Caret renders the source line containing pos followed by a line with a
+// caret under pos's column. Tabs in the source line are expanded to tab stops
+// tabWidth apart, which should match the tab width used when lexing so that
+// the caret lines up.
+func Caret(source string, pos token.SourceInformation, tabWidth int) string {
+	lines := strings.Split(source, "\n")
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return ""
+	}
+	line := expandTabs(strings.TrimRight(lines[pos.Line-1], "\r"), tabWidth)
+	col := pos.Column
+	if col < 1 {
+		col = 1
+	}
+	return line + "\n" + strings.Repeat(" ", col-1) + "^"
+}
+
+// maxSpanLines is the most lines of source that CaretSpan renders. The lines in
+// the middle of longer spans are left out.
+const maxSpanLines = 4
+
+// CaretSpan renders the source lines that span covers, with a caret under its
+// start and a caret under its end. A span within one line is rendered as
+// Caret renders its start. Spans of more than maxSpanLines lines are clamped,
+// with a line of "..." in place of the lines between the first and the last.
+func CaretSpan(source string, span token.SourceSpan, tabWidth int) string {
+	start, end := span.Start, span.End
+	if end.Line <= start.Line {
+		return Caret(source, start, tabWidth)
+	}
+	lines := strings.Split(source, "\n")
+	if start.Line < 1 || end.Line > len(lines) {
+		return ""
+	}
+	strs := []string{Caret(source, start, tabWidth)}
+	if end.Line-start.Line+1 > maxSpanLines {
+		strs = append(strs, "...")
+	} else {
+		for i := start.Line; i < end.Line-1; i++ {
+			strs = append(strs, expandTabs(strings.TrimRight(lines[i], "\r"), tabWidth))
+		}
+	}
+	strs = append(strs, Caret(source, end, tabWidth))
+	return strings.Join(strs, "\n")
+}
+
+// expandTabs replaces each tab in a line with enough spaces to reach the next
+// tab stop.
+func expandTabs(line string, tabWidth int) string {
+	if tabWidth < 1 {
+		tabWidth = 1
+	}
+	var buf strings.Builder
+	col := 0
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\t' {
+			n := tabWidth - col%tabWidth
+			buf.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		buf.WriteByte(line[i])
+		col++
+	}
+	return buf.String()
+}
@@ -0,0 +1,132 @@
+package diag
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/cmgn/compiler/token"
+)
+
+func TestCaret(t *testing.T) {
+	tests := []struct {
+		source   string
+		column   int
+		tabWidth int
+		out      string
+	}{
+		{"a = b;", 5, 1, "a = b;\n    ^"},
+		{"\tx;", 2, 1, " x;\n ^"},
+		{"\tx;", 5, 4, "    x;\n    ^"},
+		{"ab\tx;", 9, 8, "ab      x;\n        ^"},
+	}
+	for _, test := range tests {
+		pos := token.SourceInformation{Line: 1, Column: test.column}
+		if out := Caret(test.source, pos, test.tabWidth); out != test.out {
+			t.Error(
+				"For", test.source,
+				"expected", test.out,
+				"got", out,
+			)
+		}
+	}
+}
+
+func TestCaretSpan(t *testing.T) {
+	source := "if a {\n\tb;\n\tc;\n\td;\n\te;"
+	pos := func(line, column int) token.SourceInformation {
+		return token.SourceInformation{Line: line, Column: column}
+	}
+	tests := []struct {
+		span token.SourceSpan
+		out  string
+	}{
+		{token.Span(pos(1, 6), pos(1, 6)), "if a {\n     ^"},
+		{token.Span(pos(1, 6), pos(2, 5)), "if a {\n     ^\n    b;\n    ^"},
+		{token.Span(pos(1, 6), pos(4, 5)), "if a {\n     ^\n    b;\n    c;\n    d;\n    ^"},
+		{token.Span(pos(1, 6), pos(5, 5)), "if a {\n     ^\n...\n    e;\n    ^"},
+		{token.Span(pos(1, 6), pos(9, 1)), ""},
+	}
+	for _, test := range tests {
+		if out := CaretSpan(source, test.span, 4); out != test.out {
+			t.Error(
+				"For", test.span,
+				"expected", test.out,
+				"got", out,
+			)
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	pos := token.SourceInformation{FileName: "a", Line: 2, Column: 3}
+	err := Errorf(pos, "unexpected %s", "'x'")
+	err.End.Column = 5
+	tests := []struct {
+		diagnostic Diagnostic
+		out        string
+	}{
+		{
+			FromError(err),
+			`{"file":"a","line":2,"column":3,"endLine":2,"endColumn":5,"severity":"error","message":"unexpected 'x'"}` + "\n",
+		},
+		{
+			FromError(errors.New("no position")),
+			`{"file":"","line":0,"column":0,"endLine":0,"endColumn":0,"severity":"error","message":"no position"}` + "\n",
+		},
+		{
+			FromWarning(pos, "unused"),
+			`{"file":"a","line":2,"column":3,"endLine":2,"endColumn":3,"severity":"warning","message":"unused"}` + "\n",
+		},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := WriteJSON(&buf, test.diagnostic); err != nil || buf.String() != test.out {
+			t.Error(
+				"For", test.diagnostic,
+				"expected", test.out,
+				"got", buf.String(),
+			)
+		}
+	}
+	if err.Error() != "[a:2] unexpected 'x'" {
+		t.Error(
+			"For", err,
+			"expected", "[a:2] unexpected 'x'",
+			"got", err.Error(),
+		)
+	}
+	err.End.Line = 4
+	if err.Error() != "[a:2-4] unexpected 'x'" {
+		t.Error(
+			"For", err,
+			"expected", "[a:2-4] unexpected 'x'",
+			"got", err.Error(),
+		)
+	}
+}
+
+func TestDiagnosticString(t *testing.T) {
+	pos := token.SourceInformation{FileName: "a", Line: 2, Column: 3}
+	err := Errorf(pos, "unexpected %s", "'x'")
+	span := Errorf(pos, "unclosed '{'")
+	span.End.Line = 4
+	tests := []struct {
+		diagnostic Diagnostic
+		out        string
+	}{
+		{FromError(err), err.Error()},
+		{FromError(span), span.Error()},
+		{FromError(errors.New("no position")), "no position"},
+		{FromWarning(pos, "unused"), "warning: [a:2] unused"},
+	}
+	for _, test := range tests {
+		if out := test.diagnostic.String(); out != test.out {
+			t.Error(
+				"For", test.diagnostic,
+				"expected", test.out,
+				"got", out,
+			)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package diag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/cmgn/compiler/token"
+)
+
+// Error is an error found in a source file, running from Source to End. For
+// errors at a single point End is the same as Source.
+type Error struct {
+	Source  token.SourceInformation
+	End     token.SourceInformation
+	Message string
+	// Fix, if it isn't empty, is text that corrects the error when it is
+	// inserted at Source.
+	Fix string
+}
+
+// Errorf creates an error at a single point in a source file, formatting its
+// message according to a format string.
+func Errorf(source token.SourceInformation, format string, args ...interface{}) *Error {
+	return &Error{
+		Source:  source,
+		End:     source,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Error gives the message of the error after its position. An error spanning
+// several lines gives the range of lines, e.g. [file:1-3].
+func (e *Error) Error() string {
+	span := token.Span(e.Source, e.End)
+	return "[" + span.String() + "] " + e.Message
+}
+
+// Severity says whether a diagnostic stops the program from being compiled.
+type Severity string
+
+// Definitions for the severities of diagnostics.
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is the machine readable form of an error or a warning.
+type Diagnostic struct {
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	Column    int      `json:"column"`
+	EndLine   int      `json:"endLine"`
+	EndColumn int      `json:"endColumn"`
+	Severity  Severity `json:"severity"`
+	Message   string   `json:"message"`
+	// Fix is text to insert at the start of the diagnostic to correct it,
+	// if there is one.
+	Fix string `json:"fix,omitempty"`
+}
+
+// String gives the diagnostic in the form errors are printed, e.g.
+// "[file:1] message", with warnings prefixed by "warning: ". A diagnostic
+// without a position gives only its message.
+func (d Diagnostic) String() string {
+	str := d.Message
+	if d.File != "" || d.Line != 0 {
+		span := token.Span(
+			token.SourceInformation{FileName: d.File, Line: d.Line, Column: d.Column},
+			token.SourceInformation{FileName: d.File, Line: d.EndLine, Column: d.EndColumn},
+		)
+		str = "[" + span.String() + "] " + str
+	}
+	if d.Severity == SeverityWarning {
+		return "warning: " + str
+	}
+	return str
+}
+
+// FromError creates the diagnostic for an error. Errors other than *Error
+// have no position, so only their message is kept.
+func FromError(err error) Diagnostic {
+	e, ok := err.(*Error)
+	if !ok {
+		return Diagnostic{Severity: SeverityError, Message: err.Error()}
+	}
+	return Diagnostic{
+		File:      e.Source.FileName,
+		Line:      e.Source.Line,
+		Column:    e.Source.Column,
+		EndLine:   e.End.Line,
+		EndColumn: e.End.Column,
+		Severity:  SeverityError,
+		Message:   e.Message,
+		Fix:       e.Fix,
+	}
+}
+
+// FromWarning creates the diagnostic for a warning at a point in a source
+// file.
+func FromWarning(source token.SourceInformation, message string) Diagnostic {
+	return Diagnostic{
+		File:      source.FileName,
+		Line:      source.Line,
+		Column:    source.Column,
+		EndLine:   source.Line,
+		EndColumn: source.Column,
+		Severity:  SeverityWarning,
+		Message:   message,
+	}
+}
+
+// WriteJSON writes a diagnostic as a JSON object on a line of its own.
+func WriteJSON(w io.Writer, d Diagnostic) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
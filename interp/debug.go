@@ -0,0 +1,139 @@
+package interp
+
+import (
+	"errors"
+
+	"github.com/cmgn/compiler/ast"
+)
+
+// ErrStopped is the error a program stops with when its debugger is stopped
+// before the program finishes.
+var ErrStopped = errors.New("stopped by debugger")
+
+// resumeMode says how a paused program should carry on.
+type resumeMode int
+
+const (
+	resumeStep resumeMode = iota
+	resumeContinue
+	resumeStop
+)
+
+// Debugger runs a program one statement at a time, pausing before statements
+// so that its variables can be inspected. Block statements are entered
+// without pausing, so the debugger always pauses before the statements inside
+// them.
+//
+// The program runs in its own goroutine, which waits while the program is
+// paused. A program that isn't run to completion should be stopped with Stop.
+type Debugger struct {
+	in          *Interpreter
+	stmts       []ast.Statement
+	breakpoints map[int]bool
+	started     bool
+	done        bool
+	err         error
+	// resume tells the program how to carry on from a pause.
+	resume chan resumeMode
+	// paused receives each statement the program pauses before, and is
+	// closed when the program finishes.
+	paused chan ast.Statement
+}
+
+// NewDebugger creates a debugger that runs a program in an interpreter. The
+// program doesn't start until Step or Continue is called.
+func NewDebugger(in *Interpreter, stmts []ast.Statement) *Debugger {
+	return &Debugger{
+		in:          in,
+		stmts:       stmts,
+		breakpoints: make(map[int]bool),
+		resume:      make(chan resumeMode),
+		paused:      make(chan ast.Statement),
+	}
+}
+
+// SetBreakpoint makes Continue pause before any statement starting on the
+// given line.
+func (d *Debugger) SetBreakpoint(line int) {
+	d.breakpoints[line] = true
+}
+
+// Step runs the program until it is about to execute another statement, and
+// returns that statement. It returns false once the program has finished.
+func (d *Debugger) Step() (ast.Statement, bool) {
+	return d.run(resumeStep)
+}
+
+// Continue runs the program until it is about to execute a statement on a
+// line with a breakpoint, and returns that statement. It returns false once
+// the program has finished.
+func (d *Debugger) Continue() (ast.Statement, bool) {
+	return d.run(resumeContinue)
+}
+
+// Stop ends the program if it is paused, making it finish with ErrStopped.
+func (d *Debugger) Stop() {
+	if d.started && !d.done {
+		d.run(resumeStop)
+	}
+}
+
+// Err gets the error the program finished with, if any.
+func (d *Debugger) Err() error {
+	return d.err
+}
+
+// Vars gets the values of the integer and character variables in scope while
+// the program is paused. Where a name is declared in several scopes, the
+// innermost declaration is used.
+func (d *Debugger) Vars() map[string]int64 {
+	vars := make(map[string]int64)
+	for _, scope := range d.in.scopes {
+		for name := range scope {
+			if val, ok := d.in.Value(name); ok {
+				vars[name] = val
+			}
+		}
+	}
+	return vars
+}
+
+// run resumes the program in the given mode and waits for it to pause or
+// finish.
+func (d *Debugger) run(mode resumeMode) (ast.Statement, bool) {
+	if d.done {
+		return nil, false
+	}
+	if !d.started {
+		d.started = true
+		go d.eval(mode)
+	} else {
+		d.resume <- mode
+	}
+	stmt, ok := <-d.paused
+	if !ok {
+		d.done = true
+	}
+	return stmt, ok
+}
+
+// eval runs the program, pausing before statements according to the mode
+// the program was last resumed in.
+func (d *Debugger) eval(mode resumeMode) {
+	d.in.before = func(stmt ast.Statement) error {
+		if _, ok := stmt.(*ast.BlockStatement); ok {
+			return nil
+		}
+		if mode == resumeStep || d.breakpoints[stmt.SourceInfo().Line] {
+			d.paused <- stmt
+			mode = <-d.resume
+		}
+		if mode == resumeStop {
+			return ErrStopped
+		}
+		return nil
+	}
+	d.err = d.in.Eval(d.stmts)
+	d.in.before = nil
+	close(d.paused)
+}
@@ -0,0 +1,658 @@
+// Package interp implements an interpreter that executes the syntax tree
+// provided by package ast directly. Programs are expected to have been checked
+// by package sema before they are run.
+package interp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/cmgn/compiler/arith"
+	"github.com/cmgn/compiler/ast"
+	"github.com/cmgn/compiler/sema"
+	"github.com/cmgn/compiler/token"
+)
+
+// Config holds the options that control how programs are run.
+type Config struct {
+	// Overflow says what happens when integer arithmetic overflows.
+	Overflow arith.Overflow
+	// Output is where printf statements write to. If it is nil then their
+	// output is discarded.
+	Output io.Writer
+	// NoBoundsCheck turns off checking that each array index is within
+	// the length of its array. An index that is too large or too small
+	// then reaches into the neighbouring elements of an enclosing array,
+	// as it would in C. Accesses outside the variable as a whole are
+	// still reported.
+	NoBoundsCheck bool
+}
+
+// DefaultConfig is the configuration used by New and Run.
+var DefaultConfig = Config{
+	Overflow: arith.Wrap,
+	Output:   os.Stdout,
+}
+
+// Interpreter holds the state of a running program. Its variables persist
+// between calls to Eval.
+type Interpreter struct {
+	// scopes holds the locations of the variables in scope, innermost last.
+	scopes []map[string]*location
+	// deferred holds the statements deferred in each scope, in the order
+	// they were deferred.
+	deferred [][]ast.Statement
+	// config holds the options the interpreter was created with.
+	config Config
+	// before is called before each statement is executed, if it is set. If
+	// it returns an error then execution stops with that error.
+	before func(ast.Statement) error
+	// info holds the types the checker found for the statements being
+	// executed, if there are any.
+	info *sema.Info
+}
+
+// New creates an interpreter with no variables defined.
+func New() *Interpreter {
+	return NewWith(DefaultConfig)
+}
+
+// NewWith creates an interpreter in the same way as New, but using the
+// options given in cfg.
+func NewWith(cfg Config) *Interpreter {
+	if cfg.Output == nil {
+		cfg.Output = ioutil.Discard
+	}
+	in := &Interpreter{config: cfg}
+	in.push()
+	return in
+}
+
+// Run runs a program in a new interpreter.
+func Run(stmts []ast.Statement) error {
+	return New().Eval(stmts)
+}
+
+// RunWith runs a program in a new interpreter using the options given in cfg.
+func RunWith(stmts []ast.Statement, cfg Config) error {
+	return NewWith(cfg).Eval(stmts)
+}
+
+// Eval executes a series of statements, stopping at the first runtime error.
+// Statements deferred outside of any block are executed once the statements
+// finish, as though they were the end of the program. The types of the
+// expressions are found by checking the statements as a program of their own,
+// and an error from checking them is returned without running anything. A
+// caller that has already checked the program should use EvalWith instead.
+func (in *Interpreter) Eval(stmts []ast.Statement) error {
+	info, err := sema.Analyze(stmts, sema.DefaultConfig)
+	if err != nil {
+		return err
+	}
+	return in.EvalWith(stmts, info)
+}
+
+// EvalWith executes statements in the same way as Eval, taking the types of
+// their expressions from info, which the checker must have found for a valid
+// program containing them. This allows statements that use variables declared by
+// earlier calls to be run.
+func (in *Interpreter) EvalWith(stmts []ast.Statement, info *sema.Info) error {
+	in.info = info
+	if err := in.statements(stmts); err != nil {
+		return err
+	}
+	return in.runDeferred()
+}
+
+// statements executes a series of statements in the current scope.
+func (in *Interpreter) statements(stmts []ast.Statement) error {
+	for _, stmt := range stmts {
+		if err := in.statement(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EvalExpression evaluates an expression holding an integer or a character,
+// taking the types of its parts from info in the same way as EvalWith.
+func (in *Interpreter) EvalExpression(expr ast.Expression, info *sema.Info) (int64, error) {
+	in.info = info
+	v, err := in.expression(expr)
+	return v.n, err
+}
+
+// Value gets the current value of a variable holding an integer or a
+// character.
+func (in *Interpreter) Value(name string) (int64, bool) {
+	loc, ok := in.lookup(name)
+	if !ok || !isScalar(loc.typ) {
+		return 0, false
+	}
+	return loc.obj.cells[loc.off].n, true
+}
+
+// push enters a new scope.
+func (in *Interpreter) push() {
+	in.scopes = append(in.scopes, make(map[string]*location))
+	in.deferred = append(in.deferred, nil)
+}
+
+// pop leaves the innermost scope. The variables declared in it die, so any
+// pointers to them are left dangling.
+func (in *Interpreter) pop() {
+	for _, loc := range in.scopes[len(in.scopes)-1] {
+		loc.obj.live = false
+	}
+	in.scopes = in.scopes[:len(in.scopes)-1]
+	in.deferred = in.deferred[:len(in.deferred)-1]
+}
+
+// runDeferred executes the statements deferred in the current scope, most
+// recently deferred first. They are only run when the scope is left normally,
+// since a runtime error stops the whole program.
+func (in *Interpreter) runDeferred() error {
+	top := len(in.deferred) - 1
+	for len(in.deferred[top]) > 0 {
+		last := len(in.deferred[top]) - 1
+		stmt := in.deferred[top][last]
+		in.deferred[top] = in.deferred[top][:last]
+		if err := in.statement(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup finds the location of a variable, searching from the innermost
+// scope outwards.
+func (in *Interpreter) lookup(name string) (*location, bool) {
+	for i := len(in.scopes) - 1; i >= 0; i-- {
+		if loc, ok := in.scopes[i][name]; ok {
+			return loc, true
+		}
+	}
+	return nil, false
+}
+
+// runtimeError creates an error using a format string, prefixed by the source
+// information.
+func runtimeError(source *token.SourceInformation, format string, args ...interface{}) error {
+	return fmt.Errorf("[%s] %s", source.String(), fmt.Sprintf(format, args...))
+}
+
+// statement executes a single statement.
+func (in *Interpreter) statement(stmt ast.Statement) error {
+	if in.before != nil {
+		if err := in.before(stmt); err != nil {
+			return err
+		}
+	}
+	switch stmt := stmt.(type) {
+	case *ast.Empty:
+		return nil
+	case *ast.ExpressionStatement:
+		_, err := in.expression(stmt.Expression)
+		return err
+	case *ast.Declaration:
+		loc := allocate(stmt.Type)
+		if stmt.Value != nil {
+			if err := in.initialize(loc, stmt.Value); err != nil {
+				return err
+			}
+		}
+		in.scopes[len(in.scopes)-1][stmt.Name] = loc
+		return nil
+	case *ast.Assignment:
+		loc, err := in.address(stmt.Left)
+		if err != nil {
+			return err
+		}
+		return in.assign(loc, stmt.Right)
+	case *ast.IfStatement:
+		cond, err := in.expression(stmt.Condition)
+		if err != nil {
+			return err
+		}
+		if cond.truthy() {
+			return in.body(stmt.Statement1)
+		}
+		return in.body(stmt.Statement2)
+	case *ast.WhileStatement:
+		return in.loop(stmt, "")
+	case *ast.LabeledStatement:
+		if loop, ok := stmt.Statement.(*ast.WhileStatement); ok {
+			return in.loop(loop, stmt.Label)
+		}
+		return in.statement(stmt.Statement)
+	case *ast.BreakStatement:
+		return &jump{label: stmt.Label}
+	case *ast.ContinueStatement:
+		return &jump{label: stmt.Label, next: true}
+	case *ast.AssertStatement:
+		cond, err := in.expression(stmt.Condition)
+		if err != nil {
+			return err
+		}
+		if !cond.truthy() {
+			return runtimeError(stmt.SourceInfo(), "assertion failed: %s",
+				ast.FormatExpression(stmt.Condition))
+		}
+		return nil
+	case *ast.PrintfStatement:
+		return in.printfStatement(stmt)
+	case *ast.SwitchStatement:
+		return in.switchStatement(stmt)
+	case *ast.BlockStatement:
+		in.push()
+		defer in.pop()
+		return in.leave(in.statements(stmt.Statements))
+	case *ast.TypeDeclaration:
+		return nil
+	case *ast.DeferStatement:
+		top := len(in.deferred) - 1
+		in.deferred[top] = append(in.deferred[top], stmt.Statement)
+		return nil
+	}
+	return runtimeError(stmt.SourceInfo(), "cannot execute %s", stmt.String())
+}
+
+// body executes the body of an if or while statement in a scope of its own,
+// as a block would be.
+func (in *Interpreter) body(stmt ast.Statement) error {
+	if _, ok := stmt.(*ast.BlockStatement); ok {
+		return in.statement(stmt)
+	}
+	in.push()
+	defer in.pop()
+	return in.leave(in.statement(stmt))
+}
+
+// leave finishes the current scope once its statements have stopped with err.
+// Its deferred statements are run if the statements finished normally or
+// jumped to a loop outside of the scope, which then carries on.
+func (in *Interpreter) leave(err error) error {
+	if _, ok := err.(*jump); err != nil && !ok {
+		return err
+	}
+	if derr := in.runDeferred(); derr != nil {
+		return derr
+	}
+	return err
+}
+
+// jump is the error given by a break or continue statement, which is passed
+// up through the statements around it until it reaches the loop it leaves.
+type jump struct {
+	// label is the label of the loop, or empty for the innermost loop.
+	label string
+	// next is true for a continue, which goes on to the loop's next
+	// iteration rather than ending the loop.
+	next bool
+}
+
+func (j *jump) Error() string {
+	if j.next {
+		return "continue outside of a loop"
+	}
+	return "break outside of a loop"
+}
+
+// loop executes a while statement with the given label, which may be empty.
+// A break leaves the loop without running its else.
+func (in *Interpreter) loop(stmt *ast.WhileStatement, label string) error {
+	for {
+		cond, err := in.expression(stmt.Condition)
+		if err != nil {
+			return err
+		}
+		if !cond.truthy() {
+			if stmt.Else != nil {
+				return in.body(stmt.Else)
+			}
+			return nil
+		}
+		err = in.body(stmt.Statement)
+		if j, ok := err.(*jump); ok && (j.label == "" || j.label == label) {
+			if j.next {
+				continue
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// printfStatement formats the arguments of a printf statement and writes them
+// to the output. Each %d writes an argument in decimal, each %c writes it as a
+// byte, and %% writes a percent sign.
+func (in *Interpreter) printfStatement(stmt *ast.PrintfStatement) error {
+	var buf bytes.Buffer
+	args := stmt.Arguments
+	for i := 0; i < len(stmt.Format.Value); i++ {
+		if stmt.Format.Value[i] != '%' || i+1 == len(stmt.Format.Value) {
+			buf.WriteByte(stmt.Format.Value[i])
+			continue
+		}
+		i++
+		verb := stmt.Format.Value[i]
+		if verb == '%' {
+			buf.WriteByte('%')
+			continue
+		}
+		if len(args) == 0 {
+			return runtimeError(stmt.SourceInfo(), "missing argument for %%%c", verb)
+		}
+		val, err := in.expression(args[0])
+		if err != nil {
+			return err
+		}
+		args = args[1:]
+		if verb == 'c' {
+			buf.WriteByte(byte(val.n))
+		} else {
+			fmt.Fprint(&buf, val.n)
+		}
+	}
+	if _, err := in.config.Output.Write(buf.Bytes()); err != nil {
+		return runtimeError(stmt.SourceInfo(), "printf: %v", err)
+	}
+	return nil
+}
+
+// initialize stores the initial value of a declaration.
+func (in *Interpreter) initialize(loc *location, init ast.Expression) error {
+	lit, ok := init.(*ast.ArrayLiteral)
+	if !ok {
+		return in.assign(loc, init)
+	}
+	for i, elem := range lit.Elements {
+		elemLoc, err := loc.element(elem.SourceInfo(), int64(i))
+		if err != nil {
+			return err
+		}
+		if err := in.initialize(elemLoc, elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assign evaluates an expression and stores it in a location. Arrays and
+// structs are copied cell by cell.
+func (in *Interpreter) assign(loc *location, expr ast.Expression) error {
+	if !isScalar(loc.typ) {
+		from, err := in.address(expr)
+		if err != nil {
+			return err
+		}
+		return loc.copyFrom(expr.SourceInfo(), from)
+	}
+	val, err := in.expression(expr)
+	if err != nil {
+		return err
+	}
+	if p, ok := loc.typ.(*ast.Primitive); ok && p.Type == ast.CharType {
+		n, err := arith.Char(in.config.Overflow, val.n)
+		if err != nil {
+			return runtimeError(expr.SourceInfo(), "value %d of %s overflows char", val.n, ast.FormatExpression(expr))
+		}
+		val.n = n
+	}
+	return loc.store(expr.SourceInfo(), val)
+}
+
+// switchStatement executes the first case of a switch statement that matches
+// its value, or the default case if none match.
+func (in *Interpreter) switchStatement(stmt *ast.SwitchStatement) error {
+	val, err := in.expression(stmt.Value)
+	if err != nil {
+		return err
+	}
+	var matched *ast.SwitchCase
+	for _, sc := range stmt.Cases {
+		if sc.Value == nil {
+			if matched == nil {
+				matched = sc
+			}
+			continue
+		}
+		caseVal, err := in.expression(sc.Value)
+		if err != nil {
+			return err
+		}
+		if caseVal.equal(val) {
+			matched = sc
+			break
+		}
+	}
+	if matched == nil {
+		return nil
+	}
+	in.push()
+	defer in.pop()
+	return in.leave(in.statements(matched.Statements))
+}
+
+// address finds the location that an lvalue expression refers to.
+func (in *Interpreter) address(expr ast.Expression) (*location, error) {
+	switch expr := expr.(type) {
+	case *ast.Variable:
+		loc, ok := in.lookup(expr.Value)
+		if !ok {
+			return nil, runtimeError(expr.SourceInfo(), "undeclared variable %s", expr.Value)
+		}
+		return loc, nil
+	case *ast.Subscript:
+		arr, err := in.address(expr.Value)
+		if err != nil {
+			return nil, err
+		}
+		// Chars are held as unsigned bytes, so a char index needs no
+		// conversion.
+		index, err := in.expression(expr.Index)
+		if err != nil {
+			return nil, err
+		}
+		if in.config.NoBoundsCheck {
+			return arr.offset(index.n), nil
+		}
+		return arr.element(expr.SourceInfo(), index.n)
+	case *ast.FieldAccess:
+		st, err := in.address(expr.Value)
+		if err != nil {
+			return nil, err
+		}
+		return st.field(expr.Field), nil
+	case *ast.UnaryOperator:
+		if expr.Type == ast.UnaryDereference {
+			ptr, err := in.expression(expr.Value)
+			if err != nil {
+				return nil, err
+			}
+			if ptr.ptr == nil {
+				return nil, runtimeError(expr.SourceInfo(), "nil pointer dereference")
+			}
+			return ptr.ptr, nil
+		}
+	}
+	return nil, runtimeError(expr.SourceInfo(), "cannot assign to %s", ast.FormatExpression(expr))
+}
+
+// expression evaluates an expression.
+func (in *Interpreter) expression(expr ast.Expression) (value, error) {
+	switch expr := expr.(type) {
+	case *ast.Integer:
+		n, err := expr.Int64()
+		return value{n: n}, err
+	case *ast.Character:
+		return value{n: int64(expr.Value)}, nil
+	case *ast.NilLiteral:
+		return value{}, nil
+	case *ast.Variable, *ast.Subscript, *ast.FieldAccess:
+		return in.load(expr)
+	case *ast.BinaryOperator:
+		left, err := in.expression(expr.Left)
+		if err != nil {
+			return value{}, err
+		}
+		right, err := in.expression(expr.Right)
+		if err != nil {
+			return value{}, err
+		}
+		return in.binaryOperator(expr, left, right)
+	case *ast.UnaryOperator:
+		switch expr.Type {
+		case ast.UnaryMinus:
+			val, err := in.expression(expr.Value)
+			if err != nil {
+				return value{}, err
+			}
+			n, err := arith.Neg(in.config.Overflow, val.n)
+			return value{n: n}, in.overflow(expr, err)
+		case ast.UnaryDereference:
+			return in.load(expr)
+		case ast.UnaryAddress:
+			loc, err := in.address(expr.Value)
+			return value{ptr: loc}, err
+		}
+	case *ast.StatementExpression:
+		in.push()
+		defer in.pop()
+		if err := in.statements(expr.Statements); err != nil {
+			return value{}, err
+		}
+		val, err := in.expression(expr.Value)
+		if err != nil {
+			return value{}, err
+		}
+		return val, in.runDeferred()
+	}
+	return value{}, runtimeError(expr.SourceInfo(), "cannot evaluate %s", ast.FormatExpression(expr))
+}
+
+// load reads the value held by an lvalue expression.
+func (in *Interpreter) load(expr ast.Expression) (value, error) {
+	loc, err := in.address(expr)
+	if err != nil {
+		return value{}, err
+	}
+	if !isScalar(loc.typ) {
+		return value{}, runtimeError(expr.SourceInfo(), "cannot evaluate %s", ast.FormatExpression(expr))
+	}
+	return loc.load(expr.SourceInfo())
+}
+
+// isScalar checks if a value of a type fits in a single cell.
+func isScalar(typ ast.Type) bool {
+	switch typ.(type) {
+	case *ast.ArrayType, *ast.StructType:
+		return false
+	}
+	return true
+}
+
+// binaryOperator applies a binary operator to its evaluated operands.
+// Comparisons produce 1 if they hold and 0 otherwise. Chars are held as
+// unsigned bytes and promoted to int, so they compare as unsigned values.
+func (in *Interpreter) binaryOperator(expr *ast.BinaryOperator, l, r value) (value, error) {
+	mode := in.config.Overflow
+	var n int64
+	var err error
+	switch expr.Type {
+	case ast.BinaryAdd:
+		if in.pointer(expr.Left) {
+			return pointerAdd(expr, l, r)
+		}
+		if in.pointer(expr.Right) {
+			return pointerAdd(expr, r, l)
+		}
+		n, err = arith.Add(mode, l.n, r.n)
+	case ast.BinarySub:
+		if in.pointer(expr.Left) {
+			return pointerSub(expr, l, r, in.pointer(expr.Right))
+		}
+		n, err = arith.Sub(mode, l.n, r.n)
+	case ast.BinaryMul:
+		n, err = arith.Mul(mode, l.n, r.n)
+	case ast.BinaryDiv:
+		if r.n == 0 {
+			return value{}, runtimeError(expr.SourceInfo(), "division by zero")
+		}
+		n, err = arith.Div(mode, l.n, r.n)
+	case ast.BinaryLessThan:
+		return boolean(l.n < r.n), nil
+	case ast.BinaryGreaterThan:
+		return boolean(l.n > r.n), nil
+	case ast.BinaryEqual:
+		return boolean(l.equal(r)), nil
+	case ast.BinaryNotEqual:
+		return boolean(!l.equal(r)), nil
+	default:
+		return value{}, runtimeError(expr.SourceInfo(), "cannot evaluate %s", ast.FormatExpression(expr))
+	}
+	return value{n: n}, in.overflow(expr, err)
+}
+
+// pointer checks if an operand has a pointer type, going by the types found
+// by the checker. A nil pointer holds no location, so its value alone can't
+// tell it apart from an integer.
+func (in *Interpreter) pointer(expr ast.Expression) bool {
+	_, ok := in.info.TypeOf(expr).(*ast.PointerType)
+	return ok
+}
+
+// pointerAdd adds an integer to a pointer, moving the pointer by that many of
+// the values it points to.
+func pointerAdd(expr *ast.BinaryOperator, ptr, n value) (value, error) {
+	if ptr.ptr == nil {
+		return value{}, runtimeError(expr.SourceInfo(), "arithmetic on nil pointer")
+	}
+	return value{ptr: ptr.ptr.move(n.n)}, nil
+}
+
+// pointerSub subtracts an integer from a pointer, moving it back by that many
+// of the values it points to, or, if both operands are pointers, subtracts
+// two pointers into the same object, giving the number of values between
+// them.
+func pointerSub(expr *ast.BinaryOperator, l, r value, pointers bool) (value, error) {
+	if l.ptr == nil || (pointers && r.ptr == nil) {
+		return value{}, runtimeError(expr.SourceInfo(), "arithmetic on nil pointer")
+	}
+	if !pointers {
+		// Negating the smallest int gives itself, which is out of
+		// range either way.
+		return value{ptr: l.ptr.move(-r.n)}, nil
+	}
+	if l.ptr.obj != r.ptr.obj {
+		return value{}, runtimeError(expr.SourceInfo(), "subtraction of pointers to different objects")
+	}
+	// Only locations within the object, or just past its end, have a
+	// meaningful distance between them.
+	if l.ptr.outside() || r.ptr.outside() {
+		return value{}, runtimeError(expr.SourceInfo(), "subtraction of pointer outside its object")
+	}
+	return value{n: int64((l.ptr.off - r.ptr.off) / cells(l.ptr.typ))}, nil
+}
+
+// overflow turns an overflow from the arithmetic of an expression into a
+// runtime error.
+func (in *Interpreter) overflow(expr ast.Expression, err error) error {
+	if err != nil {
+		return runtimeError(expr.SourceInfo(), "integer overflow in %s", ast.FormatExpression(expr))
+	}
+	return nil
+}
+
+// boolean converts a boolean into its integer representation.
+func boolean(b bool) value {
+	if b {
+		return value{n: 1}
+	}
+	return value{}
+}
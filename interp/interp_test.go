@@ -0,0 +1,789 @@
+package interp
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/cmgn/compiler/arith"
+	"github.com/cmgn/compiler/ast"
+	"github.com/cmgn/compiler/lexer"
+	"github.com/cmgn/compiler/parser"
+	"github.com/cmgn/compiler/sema"
+)
+
+func TestWhileLoop(t *testing.T) {
+	in := `
+var i int = 0;
+var total int = 0;
+while i < 5 {
+	i = i + 1;
+	total = total + i;
+}`
+	interp := run(t, in)
+	if total, _ := interp.Value("total"); total != 15 {
+		t.Error(
+			"For", in,
+			"expected", 15,
+			"got", total,
+		)
+	}
+}
+
+func TestBodyScope(t *testing.T) {
+	in := "var y int = 1; if y var y int = 2; if 0 {} else var y int = 3;"
+	interp := run(t, in)
+	if y, _ := interp.Value("y"); y != 1 {
+		t.Error(
+			"For", in,
+			"expected", 1,
+			"got", y,
+		)
+	}
+}
+
+func TestStatementExpression(t *testing.T) {
+	in := "var x int = 2; var y int = ({ var t int = x; x = x + 1; t * 10 + x });"
+	interp := run(t, in)
+	if y, _ := interp.Value("y"); y != 23 {
+		t.Error(
+			"For", in,
+			"expected", 23,
+			"got", y,
+		)
+	}
+}
+
+func TestLoopDeclarations(t *testing.T) {
+	in := `
+var i int = 0;
+var total int = 0;
+while i < 3 {
+	var j int = i;
+	while j < 3 {
+		var i int = j;
+		j = j + 1;
+		total = total + i;
+	}
+	i = i + 1;
+}`
+	interp := run(t, in)
+	i, _ := interp.Value("i")
+	total, _ := interp.Value("total")
+	if i != 3 || total != 8 {
+		t.Error(
+			"For", in,
+			"expected", 3, 8,
+			"got", i, total,
+		)
+	}
+}
+
+func TestLoopElse(t *testing.T) {
+	tests := []struct {
+		in  string
+		out int64
+	}{
+		{"var i int = 0; var x int = 0; while i < 3 i = i + 1; else x = i * 10;", 30},
+		{"var x int = 5; while 0 x = 1; else x = x + 1;", 6},
+		{"var x int = 5; while x < 3 x = x + 1;", 5},
+	}
+	for _, test := range tests {
+		toks, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := parser.ParseWith(toks, parser.Config{LoopElse: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sema.Check(result.Statements); err != nil {
+			t.Fatal(err)
+		}
+		interp := New()
+		if err := interp.Eval(result.Statements); err != nil {
+			t.Fatal(err)
+		}
+		if x, _ := interp.Value("x"); x != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", x,
+			)
+		}
+	}
+}
+
+func TestBranchStatements(t *testing.T) {
+	tests := []struct {
+		in  string
+		out int64
+	}{
+		{"var x int; while 1 { x = x + 1; if x == 5 break; }", 5},
+		{"var i int; var x int; while i < 10 { i = i + 1; if i > 3 continue; x = x + i; }", 6},
+		{"var x int; var i int; a: while 1 { i = i + 1; while 1 { x = x + i; if x > 5 break a; continue a; } }", 6},
+		{"var x int; var i int; while i < 3 { i = i + 1; while 1 { x = x + 1; break; } }", 3},
+		{"var x int; while 1 { defer x = x * 10; x = 1; break; }", 10},
+		{"var x int; while 1 { switch x { case 0: x = 7; break; } x = 0; }", 7},
+		{"var x int; while x < 3 { x = x + 1; switch x { case 1: break; } }", 1},
+	}
+	for _, test := range tests {
+		interp := run(t, test.in)
+		if x, _ := interp.Value("x"); x != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", x,
+			)
+		}
+	}
+	in := "var x int = 0; var i int; while i < 3 { i = i + 1; if i == 2 break; } else x = 1;"
+	toks, err := lexer.Lex("test", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := parser.ParseWith(toks, parser.Config{LoopElse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	interp := New()
+	if err := interp.Eval(result.Statements); err != nil {
+		t.Fatal(err)
+	}
+	if x, _ := interp.Value("x"); x != 0 {
+		t.Error(
+			"For", in,
+			"expected", "break to skip the else",
+			"got", x,
+		)
+	}
+}
+
+func TestDefer(t *testing.T) {
+	in := `
+var x int = 1;
+{
+	defer printf "%d", x;
+	defer printf "b";
+	printf "a";
+	x = 2;
+}
+defer printf "d";
+printf "c";`
+	var out bytes.Buffer
+	if err := NewWith(Config{Output: &out}).Eval(parse(t, in)); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "ab2cd" {
+		t.Error(
+			"For", in,
+			"expected", "ab2cd",
+			"got", out.String(),
+		)
+	}
+}
+
+func TestComparisonValues(t *testing.T) {
+	in := `
+var lt int = (1 < 2);
+var gt int = (2 < 1);
+var eq int = 1 == 1;
+var ne int = 1 != 1;
+var sum int = (1 < 2) + (3 > 2) + (2 > 3);
+var branch int = 0;
+if (1 < 2) branch = branch + 10;
+if (2 < 1) branch = branch + 100;
+var c int = 1 < 2;
+if c branch = branch + 1000;
+`
+	interp := run(t, in)
+	tests := []struct {
+		name string
+		out  int64
+	}{
+		{"lt", 1},
+		{"gt", 0},
+		{"eq", 1},
+		{"ne", 0},
+		{"sum", 2},
+		{"branch", 1010},
+	}
+	for _, test := range tests {
+		if val, _ := interp.Value(test.name); val != test.out {
+			t.Error(
+				"For", test.name,
+				"expected", test.out,
+				"got", val,
+			)
+		}
+	}
+}
+
+func TestAssertPasses(t *testing.T) {
+	in := "assert 1 == 1;"
+	if err := Run(parse(t, in)); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+}
+
+func TestAssertFails(t *testing.T) {
+	in := "var x int = 1;\nassert x == 1;\nassert 1 == 2;\nx = 5;"
+	interp := New()
+	err := interp.Eval(parse(t, in))
+	expected := "[test:3] assertion failed: 1 == 2"
+	if err == nil || err.Error() != expected {
+		t.Error(
+			"For", in,
+			"expected", expected,
+			"got", err,
+		)
+	}
+	if x, _ := interp.Value("x"); x != 1 {
+		t.Error(
+			"For", in,
+			"expected", "execution to stop at the failed assertion",
+			"got", x,
+		)
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	tests := []struct {
+		in  string
+		out int64
+	}{
+		{"var x int = 2; var y int; switch x { case 1: y = 10; case 2: y = 20; default: y = 30; }", 20},
+		{"var x int = 5; var y int; switch x { default: y = 30; case 1: y = 10; }", 30},
+		{"var x int = 5; var y int = 1; switch x { case 1: y = 10; }", 1},
+	}
+	for _, test := range tests {
+		interp := run(t, test.in)
+		if y, _ := interp.Value("y"); y != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", y,
+			)
+		}
+	}
+}
+
+func TestSwitchDefer(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"var x int; switch x { case 0: defer printf \"deferred\"; printf \"body \"; }", "body deferred"},
+		{
+			"var i int; while i < 3 { switch i { case 1: defer printf \"d%d \", i; break; default: printf \"%d \", i; } i = i + 1; } printf \"end\";",
+			"0 d1 end",
+		},
+		{
+			"var i int; while i < 2 { i = i + 1; switch i { case 1: defer printf \"d \"; continue; } printf \"%d \", i; }",
+			"d 2 ",
+		},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := NewWith(Config{Output: &out}).Eval(parse(t, test.in)); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", out.String(),
+			)
+		}
+	}
+}
+
+func TestPointers(t *testing.T) {
+	tests := []struct {
+		in  string
+		out int64
+	}{
+		{"var x int = 5; var p ptr to int = &x; *p = 9;", 9},
+		{"var a array(3) of int = {1, 2, 3}; var p ptr to int = &a[1]; *p = *p * 10; var x int = a[1];", 20},
+		{"var a array(2) of array(2) of int = {{1, 2}, {3, 4}}; a[1][0] = a[0][1] + a[1][1]; var x int = a[1][0];", 6},
+		{"var y int; var p ptr to int = &y; var q ptr to int = &y; var x int = p == q;", 1},
+		{"var a array(2) of int; var x int = &a[0] == &a[1];", 0},
+		{"var a array(2) of int = {1, 2}; var b array(2) of int; b = a; a[0] = 5; var x int = b[0];", 1},
+		{"var a array(256) of int; var c char = '\\xff'; a[c] = 7; var x int = a[255];", 7},
+	}
+	for _, test := range tests {
+		interp := run(t, test.in)
+		if x, _ := interp.Value("x"); x != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", x,
+			)
+		}
+	}
+}
+
+func TestPointerArithmetic(t *testing.T) {
+	tests := []struct {
+		in  string
+		out int64
+	}{
+		{"var a array(3) of int = {1, 2, 3}; var p ptr to int = &a[0]; p = p + 1; var x int = *p;", 2},
+		{"var a array(3) of int = {1, 2, 3}; var p ptr to int = 2 + &a[0]; var x int = *(p - 1);", 2},
+		{"var a array(3) of int = {1, 2, 3}; var x int = &a[2] - &a[0];", 2},
+		{"var a array(3) of int; var x int = &a[0] - &a[2];", -2},
+		{"var a array(3) of array(2) of int; var p ptr to array(2) of int = &a[0]; p = p + 2; (*p)[1] = 7; var x int = a[2][1];", 7},
+		{"var a array(3) of array(2) of int; var x int = &a[2] - &a[0];", 2},
+		{"var a array(2) of int; var p ptr to int = &a[0] + 2; var x int = p - 1 == &a[1];", 1},
+	}
+	for _, test := range tests {
+		interp := run(t, test.in)
+		if x, _ := interp.Value("x"); x != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", x,
+			)
+		}
+	}
+}
+
+func TestMemoryErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{
+			"var a array(3) of int;\nvar i int = 3;\na[i] = 1;",
+			"[test:3] index 3 out of range for array(3) of int",
+		},
+		{
+			"var a array(3) of int;\nvar i int = 0 - 1;\nvar x int = a[i];",
+			"[test:3] index -1 out of range for array(3) of int",
+		},
+		{
+			"var p ptr to int;\n*p = 1;",
+			"[test:2] nil pointer dereference",
+		},
+		{
+			"var p ptr to int;\n{ var x int; p = &x; }\n*p = 1;",
+			"[test:3] access through dangling pointer",
+		},
+		{
+			"var a array(2) of int;\nvar p ptr to int = &a[1] + 1;\n*p = 1;",
+			"[test:3] access out of range",
+		},
+		{
+			"var a array(2) of int;\nvar p ptr to int = &a[0] + 9223372036854775807;\n*p = 1;",
+			"[test:3] access out of range",
+		},
+		{
+			"var a array(2) of int;\nvar b array(2) of int;\nvar n int = &a[0] - &b[0];",
+			"[test:3] subtraction of pointers to different objects",
+		},
+		{
+			"var p ptr to int;\np = p + 1;\n*p = 1;",
+			"[test:2] arithmetic on nil pointer",
+		},
+		{
+			"var p ptr to int;\nvar q ptr to int = 1 + p;",
+			"[test:2] arithmetic on nil pointer",
+		},
+		{
+			"var p ptr to int;\nvar q ptr to int = p - 1;",
+			"[test:2] arithmetic on nil pointer",
+		},
+		{
+			"var a array(2) of int;\nvar p ptr to int;\nvar n int = &a[0] - p;",
+			"[test:3] arithmetic on nil pointer",
+		},
+		{
+			"var a array(4) of int;\nvar r ptr to int = &a[3];\nvar d int = (r + 5) - r;",
+			"[test:3] subtraction of pointer outside its object",
+		},
+		{
+			"var a array(4) of int;\nvar r ptr to int = &a[0];\nvar d int = r - (r - 1);",
+			"[test:3] subtraction of pointer outside its object",
+		},
+	}
+	for _, test := range tests {
+		err := Run(parse(t, test.in))
+		if err == nil || err.Error() != test.err {
+			t.Error(
+				"For", test.in,
+				"expected", test.err,
+				"got", err,
+			)
+		}
+	}
+}
+
+func TestNoBoundsCheck(t *testing.T) {
+	tests := []struct {
+		in        string
+		checked   string
+		unchecked string
+	}{
+		{
+			"var a array(2) of array(3) of int;\nvar i int = 4;\na[0][i] = 7;\nassert a[1][1] == 7;",
+			"[test:3] index 4 out of range for array(3) of int",
+			"",
+		},
+		{
+			"var a array(2) of array(3) of int;\nvar i int = 0 - 1;\na[1][i] = 7;\nassert a[0][2] == 7;",
+			"[test:3] index -1 out of range for array(3) of int",
+			"",
+		},
+		{
+			"var a array(3) of int;\nvar i int = 3;\na[i] = 1;",
+			"[test:3] index 3 out of range for array(3) of int",
+			"[test:3] access out of range",
+		},
+		{
+			"var a array(2) of array(3) of int;\nvar i int = 9223372036854775807;\nvar x int = a[i][1];",
+			"[test:3] index 9223372036854775807 out of range for array(2) of array(3) of int",
+			"[test:3] access out of range",
+		},
+	}
+	for _, test := range tests {
+		for _, unchecked := range []bool{false, true} {
+			cfg := DefaultConfig
+			cfg.Output = nil
+			cfg.NoBoundsCheck = unchecked
+			want := test.checked
+			if unchecked {
+				want = test.unchecked
+			}
+			err := RunWith(parse(t, test.in), cfg)
+			errStr := ""
+			if err != nil {
+				errStr = err.Error()
+			}
+			if errStr != want {
+				t.Error(
+					"For", test.in, unchecked,
+					"expected", want,
+					"got", errStr,
+				)
+			}
+		}
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	in := "var x int = 9223372036854775807;\nx = x + 1;"
+	tests := []struct {
+		mode arith.Overflow
+		out  int64
+		err  string
+	}{
+		{arith.Wrap, math.MinInt64, ""},
+		{arith.Saturate, math.MaxInt64, ""},
+		{arith.Trap, math.MaxInt64, "[test:2] integer overflow in x + 1"},
+	}
+	for _, test := range tests {
+		interp := NewWith(Config{Overflow: test.mode})
+		err := interp.Eval(parse(t, in))
+		if x, _ := interp.Value("x"); x != test.out {
+			t.Error(
+				"For", in, test.mode,
+				"expected", test.out,
+				"got", x,
+			)
+		}
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Error(
+				"For", in, test.mode,
+				"expected", test.err,
+				"got", err,
+			)
+		}
+	}
+}
+
+func TestChars(t *testing.T) {
+	in := `
+var a char = 'a';
+var b char = '\xff';
+var less int = a < b;
+var sum int = a + 1;
+var next char = a + 1;`
+	interp := run(t, in)
+	tests := []struct {
+		name string
+		out  int64
+	}{
+		{"less", 1},
+		{"sum", 98},
+		{"next", 'b'},
+	}
+	for _, test := range tests {
+		if val, _ := interp.Value(test.name); val != test.out {
+			t.Error(
+				"For", test.name,
+				"expected", test.out,
+				"got", val,
+			)
+		}
+	}
+}
+
+func TestCharOverflow(t *testing.T) {
+	in := "var c char = 'a';\nc = c + 200;"
+	tests := []struct {
+		mode arith.Overflow
+		out  int64
+		err  string
+	}{
+		{arith.Wrap, 41, ""},
+		{arith.Saturate, 255, ""},
+		{arith.Trap, 'a', "[test:2] value 297 of c + 200 overflows char"},
+	}
+	for _, test := range tests {
+		interp := NewWith(Config{Overflow: test.mode})
+		err := interp.Eval(parse(t, in))
+		if c, _ := interp.Value("c"); c != test.out {
+			t.Error(
+				"For", in, test.mode,
+				"expected", test.out,
+				"got", c,
+			)
+		}
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Error(
+				"For", in, test.mode,
+				"expected", test.err,
+				"got", err,
+			)
+		}
+	}
+}
+
+func TestPrintf(t *testing.T) {
+	in := "var c char = 'a';\nvar x int = 41;\nprintf \"%c=%d, 100%%\\n\", c, x + 1;"
+	var out bytes.Buffer
+	interp := NewWith(Config{Output: &out})
+	if err := interp.Eval(parse(t, in)); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "a=42, 100%\n" {
+		t.Error(
+			"For", in,
+			"expected", "a=42, 100%\n",
+			"got", out.String(),
+		)
+	}
+}
+
+func TestDebugger(t *testing.T) {
+	in := `var x int = 0;
+var i int = 0;
+while i < 3 {
+	x = x + i;
+	i = i + 1;
+}
+var done int = 1;`
+	d := NewDebugger(New(), parse(t, in))
+	d.SetBreakpoint(5)
+	tests := []struct {
+		line int
+		x, i int64
+	}{
+		{5, 0, 0},
+		{5, 1, 1},
+		{5, 3, 2},
+	}
+	for _, test := range tests {
+		stmt, ok := d.Continue()
+		vars := d.Vars()
+		if !ok || stmt.SourceInfo().Line != test.line || vars["x"] != test.x || vars["i"] != test.i {
+			t.Error(
+				"For", "continue to line", test.line,
+				"expected", test.x, test.i,
+				"got", stmt, vars,
+			)
+		}
+	}
+	// The loop condition is false after the last increment, so the only
+	// statement left is the declaration of done.
+	var lines []int
+	for {
+		stmt, ok := d.Step()
+		if !ok {
+			break
+		}
+		lines = append(lines, stmt.SourceInfo().Line)
+	}
+	if len(lines) != 1 || lines[0] != 7 || d.Err() != nil || d.Vars()["done"] != 1 {
+		t.Error(
+			"For", "stepping to completion",
+			"expected", []int{7}, 1,
+			"got", lines, d.Vars()["done"], d.Err(),
+		)
+	}
+	if _, ok := d.Step(); ok {
+		t.Error(
+			"For", "stepping after completion",
+			"expected", "finished",
+			"got", "paused",
+		)
+	}
+}
+
+func TestDebuggerStop(t *testing.T) {
+	in := "var x int = 1;\nx = 2;"
+	d := NewDebugger(New(), parse(t, in))
+	if stmt, ok := d.Step(); !ok || stmt.SourceInfo().Line != 1 || len(d.Vars()) != 0 {
+		t.Error(
+			"For", in,
+			"expected", "paused before line 1",
+			"got", stmt, d.Vars(),
+		)
+	}
+	d.Step()
+	d.Stop()
+	if d.Err() != ErrStopped || d.Vars()["x"] != 1 {
+		t.Error(
+			"For", in,
+			"expected", ErrStopped, 1,
+			"got", d.Err(), d.Vars()["x"],
+		)
+	}
+}
+
+func TestRunInvalid(t *testing.T) {
+	in := "var p ptr to int;\nvar q ptr to int = p + x;"
+	toks, err := lexer.Lex("test", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := parser.Parse(toks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[test:2] undeclared variable x"
+	if err := Run(stmts); err == nil || err.Error() != expected {
+		t.Error(
+			"For", in,
+			"expected", expected,
+			"got", err,
+		)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	in := `var x int = 1;
+var a array(2) of int = {1, 2};
+var p ptr to int = &a[1];
+x = 5;
+*p = 9;
+var y int = 3;
+p = &x;
+*p = *p + 1;
+var z int = a[1];`
+	stmts := parse(t, in)
+	info, err := sema.Analyze(stmts, sema.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interp := New()
+	if err := interp.EvalWith(stmts[:3], info); err != nil {
+		t.Fatal(err)
+	}
+	snap := interp.Snapshot()
+	// Rolling back must work however many times the snapshot is used.
+	for i := 0; i < 2; i++ {
+		if err := interp.EvalWith(stmts[3:7], info); err != nil {
+			t.Fatal(err)
+		}
+		if x, _ := interp.Value("x"); x != 5 {
+			t.Fatal("For", in, "expected", 5, "got", x)
+		}
+		interp.Restore(snap)
+		x, _ := interp.Value("x")
+		_, ok := interp.Value("y")
+		if x != 1 || ok {
+			t.Error(
+				"For", in,
+				"expected", 1, "and y undefined",
+				"got", x, ok,
+			)
+		}
+	}
+	if err := interp.EvalWith(stmts[7:], info); err != nil {
+		t.Fatal(err)
+	}
+	if z, _ := interp.Value("z"); z != 3 {
+		t.Error(
+			"For", in,
+			"expected", 3,
+			"got", z,
+		)
+	}
+}
+
+func TestStructs(t *testing.T) {
+	// Structs are stored and copied as a whole, pointers step over every
+	// cell of one, and each field comes after the cells of those before it.
+	src := "var a struct { c char; n array(2) of int; }; var b struct { c char; n array(2) of int; };" +
+		"b.c = 'x'; b.n[1] = 7; a = b; var p ptr to struct { c char; n array(2) of int; } = &a; *p = b;" +
+		"var s array(3) of struct { c char; n array(2) of int; };" +
+		"var d int = &s[2] - &s[0]; var e int = (&s[0] + 1 == &s[1]);" +
+		"s[1].n[0] = 5; (*p).n[0] = s[1].n[0] + a.n[1]; var f int = a.n[0]; var g int = a.c;" +
+		"var h int = &s[1].n[1] - &s[1].n[0];"
+	interp := run(t, src)
+	for name, expected := range map[string]int64{"d": 2, "e": 1, "f": 12, "g": 'x', "h": 1} {
+		if got, ok := interp.Value(name); !ok || got != expected {
+			t.Error(
+				"For", name,
+				"expected", expected,
+				"got", got,
+			)
+		}
+	}
+}
+
+func TestTypeDeclarations(t *testing.T) {
+	src := "type pair array(2) of int; type pairs array(3) of pair;" +
+		"var ps pairs; var p pair = {4, 5}; ps[2] = p; var q ptr to pair = &ps[0];" +
+		"q = q + 2; var x int = (*q)[1]; type byte char; var b byte = 'a'; var c int = b + 1;" +
+		"type node struct { value int; next ptr to node; }; var n array(2) of node;" +
+		"var d int = &n[1] - &n[0];"
+	interp := run(t, src)
+	for name, expected := range map[string]int64{"x": 5, "c": 'b', "d": 1} {
+		if got, ok := interp.Value(name); !ok || got != expected {
+			t.Error(
+				"For", name,
+				"expected", expected,
+				"got", got,
+			)
+		}
+	}
+}
+
+func run(t *testing.T, src string) *Interpreter {
+	interp := New()
+	if err := interp.Eval(parse(t, src)); err != nil {
+		t.Fatal(err)
+	}
+	return interp
+}
+
+func parse(t *testing.T, src string) []ast.Statement {
+	toks, err := lexer.Lex("test", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := parser.Parse(toks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sema.Check(stmts); err != nil {
+		t.Fatal(err)
+	}
+	return stmts
+}
@@ -0,0 +1,160 @@
+package interp
+
+import (
+	"github.com/cmgn/compiler/ast"
+	"github.com/cmgn/compiler/sema"
+	"github.com/cmgn/compiler/token"
+)
+
+// value is a value held in a single cell of memory. Pointers refer to a
+// location, nil being a nil location, and every other value is an integer.
+type value struct {
+	n   int64
+	ptr *location
+}
+
+// truthy checks if a value counts as true in a condition.
+func (v value) truthy() bool {
+	return v.n != 0 || v.ptr != nil
+}
+
+// equal checks if two values are the same. Pointers are equal if they refer
+// to the same cell.
+func (v value) equal(w value) bool {
+	if v.ptr == nil || w.ptr == nil {
+		return v.n == w.n && v.ptr == w.ptr
+	}
+	return v.ptr.obj == w.ptr.obj && v.ptr.off == w.ptr.off
+}
+
+// object is the storage for a variable, made up of one cell for each scalar
+// it contains. An object is dead once the scope of its variable has ended.
+type object struct {
+	cells []value
+	live  bool
+}
+
+// location is the place a value of a given type is stored: the cells of an
+// object starting at an offset.
+type location struct {
+	obj *object
+	off int
+	typ ast.Type
+}
+
+// allocate creates a live object large enough to hold a value of a type, with
+// every cell set to zero.
+func allocate(typ ast.Type) *location {
+	return &location{
+		obj: &object{cells: make([]value, cells(typ)), live: true},
+		typ: ast.Underlying(typ),
+	}
+}
+
+// cells computes the number of cells needed to hold a value of a type. A
+// struct takes a cell for each scalar in its fields, with no padding.
+func cells(typ ast.Type) int {
+	switch typ := ast.Underlying(typ).(type) {
+	case *ast.ArrayType:
+		return typ.Length * cells(typ.Type)
+	case *ast.StructType:
+		n := 0
+		for _, field := range typ.Fields {
+			n += cells(field.Type)
+		}
+		return n
+	}
+	return 1
+}
+
+// element gets the location of an element of an array.
+func (l *location) element(source *token.SourceInformation, index int64) (*location, error) {
+	arr := l.typ.(*ast.ArrayType)
+	if index < 0 || index >= int64(arr.Length) {
+		return nil, runtimeError(source, "index %d out of range for %s", index, sema.TypeName(arr))
+	}
+	return l.offset(index), nil
+}
+
+// field gets the location of a field of a struct, which comes after the
+// cells of the fields before it.
+func (l *location) field(name string) *location {
+	off := l.off
+	for _, field := range l.typ.(*ast.StructType).Fields {
+		if field.Name == name {
+			return &location{obj: l.obj, off: off, typ: ast.Underlying(field.Type)}
+		}
+		off += cells(field.Type)
+	}
+	panic("unknown field " + name)
+}
+
+// offset gets the location of an element of an array without checking that
+// the index is in range.
+func (l *location) offset(index int64) *location {
+	arr := l.typ.(*ast.ArrayType)
+	first := &location{obj: l.obj, off: l.off, typ: ast.Underlying(arr.Type)}
+	return first.move(index)
+}
+
+// move gets the location n values of the location's type away from it, as
+// pointer arithmetic does. The location is checked against the bounds of its
+// object when it is accessed.
+func (l *location) move(n int64) *location {
+	off := -1
+	// A move this far can't reach a cell of the object, and could overflow
+	// the offset into one that does. Once a location is outside the object
+	// it stays outside, however it is moved.
+	if size := int64(len(l.obj.cells)); l.off >= 0 && n >= -size && n <= size {
+		off = l.off + int(n)*cells(l.typ)
+	}
+	return &location{obj: l.obj, off: off, typ: l.typ}
+}
+
+// outside checks if a location has been moved before the start of its object
+// or beyond the position just past its end.
+func (l *location) outside() bool {
+	return l.off < 0 || l.off > len(l.obj.cells)
+}
+
+// check makes sure a location can be accessed, that is its object is still
+// live and the cells it refers to are within the object.
+func (l *location) check(source *token.SourceInformation) error {
+	if !l.obj.live {
+		return runtimeError(source, "access through dangling pointer")
+	}
+	if l.off < 0 || l.off+cells(l.typ) > len(l.obj.cells) {
+		return runtimeError(source, "access out of range")
+	}
+	return nil
+}
+
+// load reads the value stored at a location holding a scalar.
+func (l *location) load(source *token.SourceInformation) (value, error) {
+	if err := l.check(source); err != nil {
+		return value{}, err
+	}
+	return l.obj.cells[l.off], nil
+}
+
+// store writes a value to a location holding a scalar.
+func (l *location) store(source *token.SourceInformation, v value) error {
+	if err := l.check(source); err != nil {
+		return err
+	}
+	l.obj.cells[l.off] = v
+	return nil
+}
+
+// copyFrom copies every cell from another location of the same type.
+func (l *location) copyFrom(source *token.SourceInformation, from *location) error {
+	if err := l.check(source); err != nil {
+		return err
+	}
+	if err := from.check(source); err != nil {
+		return err
+	}
+	n := cells(l.typ)
+	copy(l.obj.cells[l.off:l.off+n], from.obj.cells[from.off:from.off+n])
+	return nil
+}
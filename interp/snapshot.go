@@ -0,0 +1,73 @@
+package interp
+
+import "github.com/cmgn/compiler/ast"
+
+// Snapshot is the state of an interpreter's variables at some point, which
+// the interpreter can be restored to, so that statements can be run
+// speculatively and then rolled back.
+type Snapshot struct {
+	scopes   []map[string]*location
+	deferred [][]ast.Statement
+	// objects holds a copy of every object reachable from the variables
+	// in scope, keyed by the object it was copied from.
+	objects map[*object]object
+}
+
+// Snapshot records the current state of the interpreter's variables. Every
+// object that can be reached from a variable, directly or through pointers,
+// is copied, so that later changes to the object don't affect the snapshot.
+func (in *Interpreter) Snapshot() *Snapshot {
+	snap := &Snapshot{
+		scopes:   make([]map[string]*location, len(in.scopes)),
+		deferred: make([][]ast.Statement, len(in.deferred)),
+		objects:  make(map[*object]object),
+	}
+	for i, scope := range in.scopes {
+		snap.scopes[i] = make(map[string]*location, len(scope))
+		for name, loc := range scope {
+			snap.scopes[i][name] = loc
+			snap.save(loc.obj)
+		}
+	}
+	for i, stmts := range in.deferred {
+		snap.deferred[i] = append([]ast.Statement(nil), stmts...)
+	}
+	return snap
+}
+
+// save copies an object, and every object its pointers refer to, into the
+// snapshot.
+func (snap *Snapshot) save(obj *object) {
+	if _, ok := snap.objects[obj]; ok {
+		return
+	}
+	cells := append([]value(nil), obj.cells...)
+	snap.objects[obj] = object{cells: cells, live: obj.live}
+	for _, cell := range cells {
+		if cell.ptr != nil {
+			snap.save(cell.ptr.obj)
+		}
+	}
+}
+
+// Restore returns the interpreter's variables to the state recorded in a
+// snapshot. Objects are restored in place, so pointers taken before the
+// snapshot still refer to the same variables, while variables declared since
+// the snapshot are forgotten. A snapshot can be restored any number of times.
+func (in *Interpreter) Restore(snap *Snapshot) {
+	in.scopes = make([]map[string]*location, len(snap.scopes))
+	for i, scope := range snap.scopes {
+		in.scopes[i] = make(map[string]*location, len(scope))
+		for name, loc := range scope {
+			in.scopes[i][name] = loc
+		}
+	}
+	in.deferred = make([][]ast.Statement, len(snap.deferred))
+	for i, stmts := range snap.deferred {
+		in.deferred[i] = append([]ast.Statement(nil), stmts...)
+	}
+	for obj, saved := range snap.objects {
+		copy(obj.cells, saved.cells)
+		obj.live = saved.live
+	}
+}
@@ -0,0 +1,54 @@
+package lexer
+
+import (
+	"context"
+
+	"github.com/cmgn/compiler/token"
+)
+
+// LexChan lexes a string in the same way as Lex, but sends the tokens on a
+// channel as they are produced rather than collecting them in a slice. The
+// token channel is closed once the whole string has been lexed, or lexing
+// stops early. The error channel then receives at most one error, either the
+// first error in the string or the context's error if it was cancelled before
+// lexing finished, and is closed.
+func LexChan(ctx context.Context, filename string, contents string) (<-chan *token.Token, <-chan error) {
+	return LexChanWith(ctx, filename, contents, DefaultConfig)
+}
+
+// LexChanWith lexes a string in the same way as LexChan, but using the
+// options given in cfg.
+func LexChanWith(ctx context.Context, filename string, contents string, cfg Config) (<-chan *token.Token, <-chan error) {
+	tokens := make(chan *token.Token)
+	errs := make(chan error, 1)
+	lexer := &lexerState{
+		fname:  filename,
+		source: contents,
+		line:   1,
+		config: cfg,
+	}
+	go func() {
+		defer close(errs)
+		defer close(tokens)
+		for {
+			if err := ctx.Err(); err != nil {
+				errs <- err
+				return
+			}
+			tok, ok := lexer.next()
+			if !ok {
+				if lexer.err != nil {
+					errs <- lexer.err
+				}
+				return
+			}
+			select {
+			case tokens <- &tok:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return tokens, errs
+}
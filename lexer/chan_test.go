@@ -0,0 +1,91 @@
+package lexer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmgn/compiler/token"
+)
+
+func TestLexChan(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{"var a int = 1;\nwhile a < 10 { a = a + 1; }\nprintf \"%d\", a;", ""},
+		{"", ""},
+		{"a = 1;\nb = 2 # 3;", "[test:2] unexpected #"},
+	}
+	for _, test := range tests {
+		expected, expectedErr := Lex("test", test.in)
+		tokens, errs := LexChan(context.Background(), "test", test.in)
+		var got []*token.Token
+		for tok := range tokens {
+			got = append(got, tok)
+		}
+		err := <-errs
+		if (err == nil) != (test.err == "") || (err != nil && err.Error() != test.err) {
+			t.Error(
+				"For", test.in,
+				"expected", test.err,
+				"got", err,
+			)
+		}
+		if expectedErr == nil && describe(got) != describe(expected) {
+			t.Error(
+				"For", test.in,
+				"expected", describe(expected),
+				"got", describe(got),
+			)
+		}
+		if _, ok := <-errs; ok {
+			t.Error(
+				"For", test.in,
+				"expected", "at most one error",
+				"got", "more",
+			)
+		}
+	}
+}
+
+func TestLexChanCancel(t *testing.T) {
+	in := strings.Repeat("a = a + 1;\n", 100000)
+	ctx, cancel := context.WithCancel(context.Background())
+	tokens, errs := LexChan(ctx, "test", in)
+	for i := 0; i < 10; i++ {
+		<-tokens
+	}
+	cancel()
+	count := 0
+	timeout := time.After(5 * time.Second)
+	for done := false; !done; {
+		select {
+		case _, ok := <-tokens:
+			if ok {
+				count++
+			}
+			done = !ok
+		case <-timeout:
+			t.Fatal("lexing did not stop after cancellation")
+		}
+	}
+	// The lexer may already have been waiting to send a token when the
+	// context was cancelled, but it checks the context before each token
+	// after that.
+	if count > 1 {
+		t.Error(
+			"For", "a cancelled context",
+			"expected", "at most 1 more token",
+			"got", count,
+		)
+	}
+	if err := <-errs; err != context.Canceled {
+		t.Error(
+			"For", "a cancelled context",
+			"expected", context.Canceled,
+			"got", err,
+		)
+	}
+}
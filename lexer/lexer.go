@@ -3,33 +3,132 @@
 package lexer
 
 import (
-	"errors"
-	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/cmgn/compiler/diag"
 	"github.com/cmgn/compiler/token"
 )
 
+// Config holds the options that control how a string is lexed.
+type Config struct {
+	// TabWidth is the distance between tab stops when computing columns. A
+	// tab advances the column to the next tab stop.
+	TabWidth int
+	// InsertSemiColons makes the lexer insert a semicolon at the end of each
+	// line, and at the end of the input, where a statement could end. A
+	// statement could end after an identifier, a literal, or a closing
+	// bracket, so long as no '(' or '[' is left open.
+	InsertSemiColons bool
+	// Tabs controls where tabs are allowed in the source.
+	Tabs TabPolicy
+	// Comments makes the lexer produce a token for each comment, rather than
+	// skipping over them.
+	Comments bool
+	// Reserved holds identifiers that can't be used as names, usually
+	// token.Reserved. They are reported as errors rather than lexed as
+	// identifiers.
+	Reserved map[string]bool
+}
+
+// TabPolicy says where tabs are allowed in the source.
+type TabPolicy int
+
+const (
+	// AllowTabs treats tabs as whitespace wherever they appear.
+	AllowTabs TabPolicy = iota
+	// NoTabs reports an error for any tab.
+	NoTabs
+	// NoMixedIndentation reports an error if the indentation of a line
+	// contains both tabs and spaces.
+	NoMixedIndentation
+)
+
+// DefaultConfig is the configuration used by Lex.
+var DefaultConfig = Config{
+	TabWidth: 1,
+}
+
 // Lex lexes a string and returns the tokens encountered, or nil and an error
 // if it is an invalid string. The filename parameter is used in creating the
 // source information for the tokens.
 func Lex(filename string, contents string) ([]*token.Token, error) {
-	tokens := make([]*token.Token, 0)
+	return LexWith(filename, contents, DefaultConfig)
+}
+
+// LexWith lexes a string in the same way as Lex, but using the options given
+// in cfg.
+func LexWith(filename string, contents string, cfg Config) ([]*token.Token, error) {
+	values, err := LexValuesWith(filename, contents, cfg)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]*token.Token, len(values))
+	for i := range values {
+		tokens[i] = &values[i]
+	}
+	return tokens, nil
+}
+
+// LexValues lexes a string in the same way as Lex, but returns the tokens by
+// value. This saves allocating each token separately.
+func LexValues(filename string, contents string) ([]token.Token, error) {
+	return LexValuesWith(filename, contents, DefaultConfig)
+}
+
+// LexValuesWith lexes a string in the same way as LexValues, but using the
+// options given in cfg.
+func LexValuesWith(filename string, contents string, cfg Config) ([]token.Token, error) {
+	tokens, errs := lex(filename, contents, cfg, false)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return tokens, nil
+}
+
+// LexWithRecovery lexes a string in the same way as LexWith, but carries on
+// after an error by skipping past the byte where it was found. It returns
+// the tokens that could be lexed along with every error encountered.
+func LexWithRecovery(filename string, contents string, cfg Config) ([]*token.Token, []error) {
+	values, errs := lex(filename, contents, cfg, true)
+	tokens := make([]*token.Token, len(values))
+	for i := range values {
+		tokens[i] = &values[i]
+	}
+	return tokens, errs
+}
+
+// lex lexes a string, stopping at the first error unless recover is set.
+func lex(filename string, contents string, cfg Config, recover bool) ([]token.Token, []error) {
+	// Typical source has a token for every six or so bytes once whitespace
+	// and comments are included. Starting a little under that wastes little
+	// memory, and append grows the slice for denser source.
+	tokens := make([]token.Token, 0, len(contents)/8)
 	lexer := &lexerState{
 		fname:  filename,
 		source: contents,
 		line:   1,
+		config: cfg,
 	}
-	for !lexer.empty() {
-		tok := lexer.next()
-		if tok == nil {
+	var errs []error
+	for {
+		tok, ok := lexer.next()
+		if ok {
+			tokens = append(tokens, tok)
+			continue
+		}
+		if lexer.err == nil {
 			break
 		}
-		tokens = append(tokens, tok)
-	}
-	if lexer.err != nil {
-		return nil, lexer.err
+		errs = append(errs, lexer.err)
+		if !recover {
+			break
+		}
+		lexer.skipError()
 	}
-	return tokens, nil
+	return tokens, errs
 }
 
 // lexerState represents the state of a lexer.
@@ -42,8 +141,21 @@ type lexerState struct {
 	line int
 	// pos is the current position in the string.
 	pos int
+	// start is the position in the string of the current token.
+	start int
+	// lineStart is the position in the string of the current line.
+	lineStart int
+	// config holds the options the lexer was created with.
+	config Config
+	// last is the type of the last token produced, if produced is set.
+	last     token.Type
+	produced bool
+	// depth is the number of '(' and '[' brackets currently open.
+	depth int
 	// err is the error if one has been countered, nil otherwise.
 	err error
+	// errPos is the position in the string where err was found.
+	errPos int
 }
 
 // curr returns the current byte.
@@ -56,18 +168,43 @@ func (l *lexerState) empty() bool {
 	return l.pos >= len(l.source)
 }
 
-// sourceInfo creates the source information for the current position.
+// sourceInfo creates the source information for the current token.
 func (l *lexerState) sourceInfo() token.SourceInformation {
 	return token.SourceInformation{
 		FileName: l.fname,
 		Line:     l.line,
+		Column:   l.column(),
+		Offset:   l.start,
+	}
+}
+
+// column computes the column of the current token, counting from one.
+func (l *lexerState) column() int {
+	return l.columnAt(l.start)
+}
+
+// columnAt computes the column of a position on the current line, counting
+// from one.
+func (l *lexerState) columnAt(pos int) int {
+	width := l.config.TabWidth
+	if width < 1 {
+		width = 1
+	}
+	col := 1
+	for i := l.lineStart; i < pos; i++ {
+		if l.source[i] == '\t' {
+			col += width - (col-1)%width
+		} else {
+			col++
+		}
 	}
+	return col
 }
 
 // buildToken builds a token with a given value and type, using the current
 // position's source info.
-func (l *lexerState) buildToken(typ token.Type, val string) *token.Token {
-	return &token.Token{
+func (l *lexerState) buildToken(typ token.Type, val string) token.Token {
+	return token.Token{
 		Type:   typ,
 		Value:  val,
 		Source: l.sourceInfo(),
@@ -75,89 +212,366 @@ func (l *lexerState) buildToken(typ token.Type, val string) *token.Token {
 }
 
 // buildConstantToken builds a constant token using the buildToken method.
-func (l *lexerState) buildConstantToken(typ token.Type) *token.Token {
+func (l *lexerState) buildConstantToken(typ token.Type) token.Token {
 	val, ok := token.ConstantTokens[typ]
 	// This isn't an error we should handle gracefully, it's a logic error.
 	if !ok {
 		panic("called with non-constant token")
 	}
-	return &token.Token{
+	return token.Token{
 		Type:   typ,
 		Value:  val,
 		Source: l.sourceInfo(),
 	}
 }
 
-// error sets the error field.
-func (l *lexerState) error(msg string) {
-	l.err = errors.New(msg)
+// errorf sets the error field using a format string. The error runs from the
+// start of the current token to the position where it was found.
+func (l *lexerState) errorf(format string, args ...interface{}) {
+	err := diag.Errorf(l.sourceInfo(), format, args...)
+	err.End.Column = l.columnAt(l.pos)
+	l.err = err
+	l.errPos = l.pos
 }
 
-func (l *lexerState) readIdentifier() *token.Token {
+// skipError clears the error so that lexing can carry on, moving past the
+// byte where it was found unless that byte ends a line.
+func (l *lexerState) skipError() {
+	l.err = nil
+	if l.pos <= l.errPos && l.errPos < len(l.source) && l.source[l.errPos] != '\n' {
+		l.pos = l.errPos + 1
+	}
+}
+
+// atComment checks if a comment starts at the current position. Comments
+// start with '//' and run to the end of the line.
+func (l *lexerState) atComment() bool {
+	return strings.HasPrefix(l.source[l.pos:], "//")
+}
+
+// readComment reads a comment, not including the newline that ends it.
+func (l *lexerState) readComment() (token.Token, bool) {
+	start := l.pos
+	for !l.empty() && l.curr() != '\n' {
+		l.pos++
+	}
+	return l.buildToken(token.TokComment, l.source[start:l.pos]), true
+}
+
+func (l *lexerState) readIdentifier() (token.Token, bool) {
 	start := l.pos
 	for !l.empty() && (isAlpha(l.curr()) || isDigit(l.curr())) {
 		l.pos++
 	}
 	ident := l.source[start:l.pos]
 	if typ, ok := token.Keywords[ident]; ok {
-		return l.buildConstantToken(typ)
+		return l.buildConstantToken(typ), true
 	}
-	return l.buildToken(token.TokIdentifier, ident)
+	if l.config.Reserved[ident] {
+		l.errorf("reserved word %s cannot be used as identifier", ident)
+		return token.Token{}, false
+	}
+	return l.buildToken(token.TokIdentifier, ident), true
 }
 
-func (l *lexerState) readInteger() *token.Token {
+// readInteger reads a decimal integer, or a hexadecimal integer prefixed by
+// 0x or 0X.
+func (l *lexerState) readInteger() (token.Token, bool) {
 	start := l.pos
-	for !l.empty() && isDigit(l.curr()) {
+	digit := isDigit
+	if l.curr() == '0' && l.pos+2 < len(l.source) &&
+		(l.source[l.pos+1] == 'x' || l.source[l.pos+1] == 'X') && isHexDigit(l.source[l.pos+2]) {
+		l.pos += 2
+		digit = isHexDigit
+	}
+	for !l.empty() && digit(l.curr()) {
+		l.pos++
+	}
+	return l.buildToken(token.TokInteger, l.source[start:l.pos]), true
+}
+
+// readCharacter reads a character literal, which must contain exactly one
+// byte once its escape sequences are decoded.
+func (l *lexerState) readCharacter() (token.Token, bool) {
+	val, ok := l.readQuoted("character literal")
+	if !ok {
+		return token.Token{}, false
+	}
+	if len(val) != 1 {
+		l.errorf("character literal must contain exactly one byte")
+		return token.Token{}, false
+	}
+	return l.buildToken(token.TokCharacter, val), true
+}
+
+// readString reads a string literal.
+func (l *lexerState) readString() (token.Token, bool) {
+	val, ok := l.readQuoted("string literal")
+	if !ok {
+		return token.Token{}, false
+	}
+	return l.buildToken(token.TokString, val), true
+}
+
+// readRawString reads a raw string literal, which runs between backticks and
+// has no escape sequences. It may span several lines.
+func (l *lexerState) readRawString() (token.Token, bool) {
+	end := strings.IndexByte(l.source[l.pos+1:], '`')
+	if end < 0 {
+		l.pos++
+		l.errorf("unterminated raw string literal")
+		l.pos = len(l.source)
+		return token.Token{}, false
+	}
+	val := l.source[l.pos+1 : l.pos+1+end]
+	tok := l.buildToken(token.TokRawString, val)
+	l.pos++
+	for i := 0; i < len(val); i++ {
+		if val[i] == '\n' {
+			l.line++
+			l.lineStart = l.pos + i + 1
+		}
+	}
+	l.pos += len(val) + 1
+	return tok, true
+}
+
+// readQuoted reads the literal delimited by the quote at the current position
+// and returns its contents with escape sequences decoded. If the literal is
+// invalid it sets the err field and returns false.
+func (l *lexerState) readQuoted(what string) (string, bool) {
+	quote := l.curr()
+	l.pos++
+	var buf strings.Builder
+	for {
+		if l.empty() || l.curr() == '\n' {
+			l.errorf("unterminated %s", what)
+			return "", false
+		}
+		curr := l.curr()
+		if curr == quote {
+			l.pos++
+			return buf.String(), true
+		}
+		if curr == '\\' {
+			if !l.readEscape(&buf) {
+				return "", false
+			}
+			continue
+		}
+		buf.WriteByte(curr)
 		l.pos++
 	}
-	return l.buildToken(token.TokInteger, l.source[start:l.pos])
 }
 
-// next gets the next token, it returns nil and sets the err field to an error
-// if it encounters an invalid character.
-func (l *lexerState) next() *token.Token {
+// readEscape decodes the escape sequence at the current position into buf.
+// If the escape sequence is invalid it sets the err field and returns false.
+// A backslash followed by three octal digits is an octal escape, so \0 only
+// stands for a NUL byte when it isn't followed by two more octal digits.
+func (l *lexerState) readEscape(buf *strings.Builder) bool {
+	l.pos++
+	if l.empty() {
+		l.errorf("unterminated escape sequence")
+		return false
+	}
+	curr := l.curr()
+	l.pos++
+	if isOctalDigit(curr) && l.pos+2 <= len(l.source) &&
+		isOctalDigit(l.source[l.pos]) && isOctalDigit(l.source[l.pos+1]) {
+		digits := l.source[l.pos-1 : l.pos+2]
+		val, _ := strconv.ParseUint(digits, 8, 16)
+		if val > 255 {
+			l.errorf("octal escape sequence \\%s is greater than 255", digits)
+			return false
+		}
+		buf.WriteByte(byte(val))
+		l.pos += 2
+		return true
+	}
+	if b, ok := escapes[curr]; ok {
+		buf.WriteByte(b)
+		return true
+	}
+	if isOctalDigit(curr) {
+		l.errorf("invalid escape sequence, octal escapes must have three digits")
+		return false
+	}
+	switch curr {
+	case 'x':
+		if l.pos+2 > len(l.source) ||
+			!isHexDigit(l.source[l.pos]) ||
+			!isHexDigit(l.source[l.pos+1]) {
+			l.errorf("invalid escape sequence, \\x must be followed by two hexadecimal digits")
+			return false
+		}
+		val, _ := strconv.ParseUint(l.source[l.pos:l.pos+2], 16, 8)
+		buf.WriteByte(byte(val))
+		l.pos += 2
+		return true
+	case 'u':
+		if l.empty() || l.curr() != '{' {
+			l.errorf("invalid escape sequence, \\u must be followed by '{'")
+			return false
+		}
+		l.pos++
+		start := l.pos
+		for !l.empty() && isHexDigit(l.curr()) {
+			l.pos++
+		}
+		digits := l.source[start:l.pos]
+		if l.empty() || l.curr() != '}' || len(digits) == 0 || len(digits) > 6 {
+			l.errorf("invalid escape sequence, \\u{...} must contain one to six hexadecimal digits")
+			return false
+		}
+		l.pos++
+		val, _ := strconv.ParseUint(digits, 16, 32)
+		if val > unicode.MaxRune || !utf8.ValidRune(rune(val)) {
+			l.errorf("escape sequence \\u{%s} is not a valid code point", digits)
+			return false
+		}
+		buf.WriteRune(rune(val))
+		return true
+	}
+	l.errorf("unknown escape sequence \\%s", string(curr))
+	return false
+}
+
+// next gets the next token, it returns false at the end of the source, or
+// when it sets the err field after encountering an invalid character.
+func (l *lexerState) next() (token.Token, bool) {
+	tok, ok := l.scan()
+	if !ok {
+		return tok, false
+	}
+	tok.Length = l.pos - tok.Source.Offset
+	switch tok.Type {
+	case token.TokLeftBracket, token.TokLeftSquare:
+		l.depth++
+	case token.TokRightBracket, token.TokRightSquare:
+		if l.depth > 0 {
+			l.depth--
+		}
+	case token.TokComment:
+		return tok, true
+	}
+	l.last = tok.Type
+	l.produced = true
+	return tok, true
+}
+
+// endsStatement checks if a semicolon should be inserted after the last token
+// when semicolon insertion is enabled.
+func (l *lexerState) endsStatement() bool {
+	return l.config.InsertSemiColons &&
+		l.depth == 0 &&
+		l.produced &&
+		statementEnds[l.last]
+}
+
+// scan reads the next token from the source.
+func (l *lexerState) scan() (token.Token, bool) {
 loop:
 	for l.pos < len(l.source) {
 		curr := l.curr()
-		if isSpace(curr) {
+		class := byteClasses[curr]
+		if class == classSpace {
+			if !l.allowedSpace() {
+				break loop
+			}
+			if curr == '\n' && l.endsStatement() {
+				l.start = l.pos
+				return l.buildConstantToken(token.TokSemiColon), true
+			}
 			if curr == '\n' {
 				l.line++
+				l.lineStart = l.pos + 1
 			}
 			l.pos++
 			continue
-		} else if isAlpha(curr) {
+		}
+		l.start = l.pos
+		if l.atComment() {
+			if l.endsStatement() {
+				return l.buildConstantToken(token.TokSemiColon), true
+			}
+			tok, _ := l.readComment()
+			if !l.config.Comments {
+				continue
+			}
+			return tok, true
+		}
+		switch class {
+		case classAlpha:
 			return l.readIdentifier()
-		} else if isDigit(curr) {
+		case classDigit:
 			return l.readInteger()
-		} else if typ, ok := byteTokens[curr]; ok {
+		case classByteToken:
 			l.pos++
-			return l.buildConstantToken(typ)
+			return l.buildConstantToken(byteTokenTypes[curr]), true
 		}
 		switch curr {
 		case '=':
 			l.pos++
-			if l.curr() == '=' {
+			if !l.empty() && l.curr() == '=' {
 				l.pos++
-				return l.buildConstantToken(token.TokEquals)
+				return l.buildConstantToken(token.TokEquals), true
 			}
-			return l.buildConstantToken(token.TokAssign)
+			return l.buildConstantToken(token.TokAssign), true
 		case '!':
 			l.pos++
-			if l.curr() == '=' {
+			if !l.empty() && l.curr() == '=' {
 				l.pos++
-				return l.buildConstantToken(token.TokNotEqual)
+				return l.buildConstantToken(token.TokNotEqual), true
 			}
-			return l.buildConstantToken(token.TokNot)
+			return l.buildConstantToken(token.TokNot), true
+		case '\'':
+			return l.readCharacter()
+		case '"':
+			return l.readString()
+		case '`':
+			return l.readRawString()
 		default:
-			l.error(fmt.Sprintf(
-				"[%s:%d] unexpected %s",
-				l.fname,
-				l.line,
-				string(curr)))
+			l.errorf("unexpected %s", string(curr))
 			break loop
 		}
 	}
-	return nil
+	if l.err == nil && l.endsStatement() {
+		l.start = l.pos
+		return l.buildConstantToken(token.TokSemiColon), true
+	}
+	return token.Token{}, false
+}
+
+// allowedSpace checks the whitespace at the current position against the tab
+// policy, reporting an error if it isn't allowed.
+func (l *lexerState) allowedSpace() bool {
+	curr := l.curr()
+	switch l.config.Tabs {
+	case NoTabs:
+		if curr == '\t' {
+			l.start = l.pos
+			l.errorf("tab at column %d is not allowed", l.column())
+			return false
+		}
+	case NoMixedIndentation:
+		if (curr == ' ' || curr == '\t') && l.inIndentation() && l.source[l.lineStart] != curr {
+			l.start = l.pos
+			l.errorf("mixed tabs and spaces in indentation at column %d", l.column())
+			return false
+		}
+	}
+	return true
+}
+
+// inIndentation checks if the current position is in the indentation at the
+// start of a line.
+func (l *lexerState) inIndentation() bool {
+	for i := l.lineStart; i < l.pos; i++ {
+		if l.source[i] != ' ' && l.source[i] != '\t' {
+			return false
+		}
+	}
+	return true
 }
 
 func isSpace(b byte) bool {
@@ -172,6 +586,83 @@ func isDigit(b byte) bool {
 	return b >= '0' && b <= '9'
 }
 
+func isOctalDigit(b byte) bool {
+	return b >= '0' && b <= '7'
+}
+
+func isHexDigit(b byte) bool {
+	return isDigit(b) || b >= 'a' && b <= 'f' || b >= 'A' && b <= 'F'
+}
+
+// byteClass classifies the byte a token starts with, saying how the rest of
+// the token is read.
+type byteClass uint8
+
+// Definitions for the classes of bytes.
+const (
+	// classOther bytes are either handled individually or invalid.
+	classOther byteClass = iota
+	classSpace
+	classAlpha
+	classDigit
+	// classByteToken bytes are a token on their own, found in byteTokens.
+	classByteToken
+)
+
+// byteClasses and byteTokenTypes hold the class of every byte and the type of
+// every single byte token, so that scanning a token starts with one lookup
+// rather than a chain of checks.
+var (
+	byteClasses    [256]byteClass
+	byteTokenTypes [256]token.Type
+)
+
+func init() {
+	for i := 0; i < 256; i++ {
+		b := byte(i)
+		switch {
+		case isSpace(b):
+			byteClasses[b] = classSpace
+		case isAlpha(b):
+			byteClasses[b] = classAlpha
+		case isDigit(b):
+			byteClasses[b] = classDigit
+		}
+	}
+	for b, typ := range byteTokens {
+		byteClasses[b] = classByteToken
+		byteTokenTypes[b] = typ
+	}
+}
+
+// statementEnds contains the token types that a statement could end with,
+// for semicolon insertion.
+var statementEnds = map[token.Type]bool{
+	token.TokIdentifier:   true,
+	token.TokInteger:      true,
+	token.TokCharacter:    true,
+	token.TokString:       true,
+	token.TokRawString:    true,
+	token.TokNil:          true,
+	token.TokRightBracket: true,
+	token.TokRightSquare:  true,
+	token.TokRightCurly:   true,
+	token.TokBreak:        true,
+	token.TokContinue:     true,
+}
+
+// escapes maps the byte following a backslash to the byte it represents, for
+// the escape sequences that don't take any further characters.
+var escapes = map[byte]byte{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'\\': '\\',
+	'\'': '\'',
+	'"':  '"',
+}
+
 // NB: tokens such as '=' are not in here as they could potentially
 // be a multibyte token.
 var byteTokens = map[byte]token.Type{
@@ -189,4 +680,7 @@ var byteTokens = map[byte]token.Type{
 	'<': token.TokLessThan,
 	'>': token.TokGreaterThan,
 	'&': token.TokAmpersand,
+	',': token.TokComma,
+	':': token.TokColon,
+	'.': token.TokDot,
 }
@@ -1,9 +1,14 @@
 package lexer
 
 import (
+	"fmt"
+	"math/rand"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/cmgn/compiler/diag"
 	"github.com/cmgn/compiler/token"
 )
 
@@ -18,8 +23,20 @@ func TestIntegerLex(t *testing.T) {
 	runTests(in, out, t)
 }
 
+func TestHexIntegerLex(t *testing.T) {
+	in := "0x10 0XfF 0x 0"
+	out := []*token.Token{
+		tok(token.TokInteger, "0x10"),
+		tok(token.TokInteger, "0XfF"),
+		tok(token.TokInteger, "0"),
+		tok(token.TokIdentifier, "x"),
+		tok(token.TokInteger, "0"),
+	}
+	runTests(in, out, t)
+}
+
 func TestIdentifierLex(t *testing.T) {
-	in := "abc def g hi if while else var of array ptr int to char"
+	in := "abc def g hi if while else var of array ptr int to char nil func assert switch case default printf defer"
 	out := []*token.Token{
 		tok(token.TokIdentifier, "abc"),
 		tok(token.TokIdentifier, "def"),
@@ -35,12 +52,47 @@ func TestIdentifierLex(t *testing.T) {
 		tok(token.TokInt, "int"),
 		tok(token.TokTo, "to"),
 		tok(token.TokChar, "char"),
+		tok(token.TokNil, "nil"),
+		tok(token.TokFunc, "func"),
+		tok(token.TokAssert, "assert"),
+		tok(token.TokSwitch, "switch"),
+		tok(token.TokCase, "case"),
+		tok(token.TokDefault, "default"),
+		tok(token.TokPrintf, "printf"),
+		tok(token.TokDefer, "defer"),
 	}
 	runTests(in, out, t)
 }
 
+func TestOffsets(t *testing.T) {
+	in := "var a int = 10;\n\tif a == 'x' {\n\t\tb = \"s\\n\" + a; // c\n}\n"
+	tokens, err := Lex("test", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := -1
+	for _, tok := range tokens {
+		off := tok.Source.Offset
+		text := tok.Value
+		switch tok.Type {
+		case token.TokCharacter:
+			text = "'"
+		case token.TokString:
+			text = "\""
+		}
+		if off <= prev || !strings.HasPrefix(in[off:], text) {
+			t.Error(
+				"For", tok,
+				"expected", "an increasing offset at "+text,
+				"got", off, prev,
+			)
+		}
+		prev = off
+	}
+}
+
 func TestSymbolLex(t *testing.T) {
-	in := "+-{}[]=*/==><;&!!="
+	in := "+-{}[]=*/==><;&!!=,:"
 	out := []*token.Token{
 		tok(token.TokPlus, "+"),
 		tok(token.TokDash, "-"),
@@ -58,10 +110,101 @@ func TestSymbolLex(t *testing.T) {
 		tok(token.TokAmpersand, "&"),
 		tok(token.TokNot, "!"),
 		tok(token.TokNotEqual, "!="),
+		tok(token.TokComma, ","),
+		tok(token.TokColon, ":"),
+	}
+	runTests(in, out, t)
+}
+
+func TestCharacterLex(t *testing.T) {
+	in := `'a' '\n' '\x41' '\'' '\u{7e}' '\101' '\0' '\377'`
+	out := []*token.Token{
+		tok(token.TokCharacter, "a"),
+		tok(token.TokCharacter, "\n"),
+		tok(token.TokCharacter, "A"),
+		tok(token.TokCharacter, "'"),
+		tok(token.TokCharacter, "~"),
+		tok(token.TokCharacter, "A"),
+		tok(token.TokCharacter, "\x00"),
+		tok(token.TokCharacter, "\xff"),
+	}
+	runTests(in, out, t)
+}
+
+func TestStringLex(t *testing.T) {
+	in := `"abc" "a\tb\\" "\x00\x7f" "caf\u{e9}" "\u{1F600}" "\0121\08" "\1234"`
+	out := []*token.Token{
+		tok(token.TokString, "abc"),
+		tok(token.TokString, "a\tb\\"),
+		tok(token.TokString, "\x00\x7f"),
+		tok(token.TokString, "café"),
+		tok(token.TokString, "\U0001F600"),
+		tok(token.TokString, "\n1\x008"),
+		tok(token.TokString, "S4"),
 	}
 	runTests(in, out, t)
 }
 
+func TestRawStringLex(t *testing.T) {
+	in := "`a\\tb\\` \"a\\tb\" `\"x\"` `two\nlines` a"
+	out := []*token.Token{
+		tok(token.TokRawString, `a\tb\`),
+		tok(token.TokString, "a\tb"),
+		tok(token.TokRawString, `"x"`),
+		tok(token.TokRawString, "two\nlines"),
+		tok(token.TokIdentifier, "a"),
+	}
+	runTests(in, out, t)
+	tokens, err := Lex("test", in)
+	if err != nil || tokens[4].Source.Line != 2 || tokens[4].Source.Column != 8 {
+		t.Error(
+			"For", in,
+			"expected", "a at line 2, column 8",
+			"got", tokens, err,
+		)
+	}
+	in = "printf `abc;\n\n"
+	if _, err := Lex("test", in); err == nil || err.Error() != "[test:1] unterminated raw string literal" {
+		t.Error(
+			"For", in,
+			"expected", "[test:1] unterminated raw string literal",
+			"got", err,
+		)
+	}
+}
+
+func TestInvalidEscapes(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{`'\xZZ'`, `[test:1] invalid escape sequence, \x must be followed by two hexadecimal digits`},
+		{`"\x4"`, `[test:1] invalid escape sequence, \x must be followed by two hexadecimal digits`},
+		{`"\u{110000}"`, `[test:1] escape sequence \u{110000} is not a valid code point`},
+		{`"\u{d800}"`, `[test:1] escape sequence \u{d800} is not a valid code point`},
+		{`"\u{}"`, `[test:1] invalid escape sequence, \u{...} must contain one to six hexadecimal digits`},
+		{`"\u41"`, `[test:1] invalid escape sequence, \u must be followed by '{'`},
+		{`"\q"`, `[test:1] unknown escape sequence \q`},
+		{`"\400"`, `[test:1] octal escape sequence \400 is greater than 255`},
+		{`"\12"`, `[test:1] invalid escape sequence, octal escapes must have three digits`},
+		{`'\7'`, `[test:1] invalid escape sequence, octal escapes must have three digits`},
+		{"a\n'\\u{e9}'", `[test:2] character literal must contain exactly one byte`},
+		{`'ab'`, `[test:1] character literal must contain exactly one byte`},
+		{`"abc`, `[test:1] unterminated string literal`},
+		{"'a\n'", `[test:1] unterminated character literal`},
+	}
+	for _, test := range tests {
+		_, err := Lex("test", test.in)
+		if err == nil || err.Error() != test.err {
+			t.Error(
+				"For", test.in,
+				"expected", test.err,
+				"got", err,
+			)
+		}
+	}
+}
+
 func TestComplexExpression(t *testing.T) {
 	in := "1 + ((2 * abc) - (def + abc[123] / 743))"
 	out := []*token.Token{
@@ -190,6 +333,258 @@ func TestInvalidLex(t *testing.T) {
 	}
 }
 
+func TestLexWithDefaults(t *testing.T) {
+	in := generateProgram(5)
+	tokens, err := Lex("test", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	with, err := LexWith("test", in, DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tokens, with) {
+		t.Error(
+			"For", "generateProgram(5)",
+			"expected", typesOf(tokens),
+			"got", typesOf(with),
+		)
+	}
+}
+
+func TestLexWithRecovery(t *testing.T) {
+	in := "a @ b\nc = 'xy' $\nd = \"abc\ne"
+	tokens, errs := LexWithRecovery("test", in, DefaultConfig)
+	expected := "'a' 'b' 'c' '=' 'd' '=' 'e'"
+	if out := typesOf(tokens); out != expected {
+		t.Error(
+			"For", strconv.Quote(in),
+			"expected", expected,
+			"got", out,
+		)
+	}
+	expectedErrs := []string{
+		"[test:1] unexpected @",
+		"[test:2] character literal must contain exactly one byte",
+		"[test:2] unexpected $",
+		"[test:3] unterminated string literal",
+	}
+	strs := make([]string, len(errs))
+	for i, err := range errs {
+		strs[i] = err.Error()
+	}
+	if strings.Join(strs, "\n") != strings.Join(expectedErrs, "\n") {
+		t.Error(
+			"For", strconv.Quote(in),
+			"expected", expectedErrs,
+			"got", strs,
+		)
+	}
+}
+
+func TestTabWidth(t *testing.T) {
+	tests := []struct {
+		in       string
+		tabWidth int
+		column   int
+	}{
+		{"\tx", 1, 2},
+		{"\tx", 4, 5},
+		{"ab\tx", 4, 5},
+		{"abcd\tx", 4, 9},
+		{"a\n\t\tx", 8, 17},
+	}
+	for _, test := range tests {
+		cfg := DefaultConfig
+		cfg.TabWidth = test.tabWidth
+		tokens, err := LexWith("test", test.in, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := tokens[len(tokens)-1]
+		if last.Source.Column != test.column {
+			t.Error(
+				"For", strconv.Quote(test.in),
+				"expected", test.column,
+				"got", last.Source.Column,
+			)
+		}
+		lines := strings.Split(diag.Caret(test.in, last.Source, test.tabWidth), "\n")
+		if strings.Index(lines[0], "x") != strings.Index(lines[1], "^") {
+			t.Error(
+				"For", strconv.Quote(test.in),
+				"expected", "caret under x",
+				"got", strconv.Quote(strings.Join(lines, "\n")),
+			)
+		}
+	}
+}
+
+func TestTabPolicy(t *testing.T) {
+	tests := []struct {
+		in     string
+		policy TabPolicy
+		err    string
+	}{
+		{"a\n\tb;", AllowTabs, ""},
+		{"a\n \tb;", AllowTabs, ""},
+		{"a\nb;", NoTabs, ""},
+		{"a\n  b\t;", NoTabs, "[test:2] tab at column 4 is not allowed"},
+		{"a\n\t\tb;\n    c;", NoMixedIndentation, ""},
+		{"a\n\tb\t;", NoMixedIndentation, ""},
+		{"a\n\t b;", NoMixedIndentation, "[test:2] mixed tabs and spaces in indentation at column 2"},
+		{"a;\n  \tb;", NoMixedIndentation, "[test:2] mixed tabs and spaces in indentation at column 3"},
+	}
+	for _, test := range tests {
+		cfg := DefaultConfig
+		cfg.Tabs = test.policy
+		_, err := LexWith("test", test.in, cfg)
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Error(
+				"For", strconv.Quote(test.in),
+				"expected", test.err,
+				"got", err,
+			)
+		}
+	}
+}
+
+func TestReservedWords(t *testing.T) {
+	tests := []struct {
+		in       string
+		reserved map[string]bool
+		err      string
+	}{
+		{"return;", nil, ""},
+		{"return;", token.Reserved, "[test:1] reserved word return cannot be used as identifier"},
+		{"a = returns;", token.Reserved, ""},
+		{"while x for;", token.Reserved, "[test:1] reserved word for cannot be used as identifier"},
+		{"if x;", map[string]bool{"x": true}, "[test:1] reserved word x cannot be used as identifier"},
+	}
+	for _, test := range tests {
+		cfg := DefaultConfig
+		cfg.Reserved = test.reserved
+		tokens, err := LexWith("test", test.in, cfg)
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Error(
+				"For", test.in,
+				"expected", test.err,
+				"got", err,
+			)
+		}
+		if err == nil && test.reserved == nil && tokens[0].Type != token.TokIdentifier {
+			t.Error(
+				"For", test.in,
+				"expected", token.TokIdentifier,
+				"got", tokens[0].Type,
+			)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	in := "a / b // c / d\n// e\nf"
+	tokens, err := Lex("test", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := typesOf(tokens); out != "'a' '/' 'b' 'f'" {
+		t.Error(
+			"For", strconv.Quote(in),
+			"expected", "'a' '/' 'b' 'f'",
+			"got", out,
+		)
+	}
+	cfg := DefaultConfig
+	cfg.Comments = true
+	cfg.InsertSemiColons = true
+	tokens, err = LexWith("test", in, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*token.Token{
+		tok(token.TokIdentifier, "a"),
+		tok(token.TokFwdSlash, "/"),
+		tok(token.TokIdentifier, "b"),
+		tok(token.TokSemiColon, ";"),
+		tok(token.TokComment, "// c / d"),
+		tok(token.TokComment, "// e"),
+		tok(token.TokIdentifier, "f"),
+		tok(token.TokSemiColon, ";"),
+	}
+	if len(tokens) != len(expected) {
+		t.Fatal(
+			"For", strconv.Quote(in),
+			"expected", expected,
+			"got", tokens,
+		)
+	}
+	for i, tok := range tokens {
+		if tok.Type != expected[i].Type || tok.Value != expected[i].Value {
+			t.Error(
+				"For", strconv.Quote(in),
+				"expected", expected[i],
+				"got", tok,
+			)
+		}
+	}
+}
+
+func TestInsertSemiColons(t *testing.T) {
+	tests := []struct {
+		in      string
+		without string
+		with    string
+	}{
+		{
+			"var a int\na = 1\n",
+			"'var' 'a' 'int' 'a' '=' '1'",
+			"'var' 'a' 'int' 'a' '=' '1' ';'",
+		},
+		{
+			"while a < 10 {\n\ta = a + 1\n}",
+			"'while' 'a' '<' '10' '{' 'a' '=' 'a' '+' '1' '}'",
+			"'while' 'a' '<' '10' '{' 'a' '=' 'a' '+' '1' ';' '}' ';'",
+		},
+		{
+			"a = (1 +\n\tb\n)\nc[\n0\n] = 'x'",
+			"'a' '=' '(' '1' '+' 'b' ')' 'c' '[' '0' ']' '=' character",
+			"'a' '=' '(' '1' '+' 'b' ')' ';' 'c' '[' '0' ']' '=' character ';'",
+		},
+		{
+			"a;\n\nb\n\n",
+			"'a' ';' 'b'",
+			"'a' ';' 'b' ';'",
+		},
+	}
+	for _, test := range tests {
+		without, err := Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := DefaultConfig
+		cfg.InsertSemiColons = true
+		with, err := LexWith("test", test.in, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out := typesOf(without); out != test.without {
+			t.Error(
+				"For", strconv.Quote(test.in),
+				"expected", test.without,
+				"got", out,
+			)
+		}
+		if out := typesOf(with); out != test.with {
+			t.Error(
+				"For", strconv.Quote(test.in),
+				"expected", test.with,
+				"got", out,
+			)
+		}
+	}
+}
+
 func TestLineNumbering(t *testing.T) {
 	in := "12\n34\n56"
 	lexer := makeLexer(in)
@@ -220,8 +615,8 @@ func TestMakesError(t *testing.T) {
 func runTests(in string, out []*token.Token, t *testing.T) {
 	lexer := makeLexer(in)
 	for _, token := range out {
-		next := lexer.next()
-		if !tokenMatches(next, token) {
+		next, ok := lexer.next()
+		if !ok || !tokenMatches(&next, token) {
 			t.Error(
 				"For", in,
 				"expected", token,
@@ -249,3 +644,228 @@ func tok(typ token.Type, val string) *token.Token {
 		Value: val,
 	}
 }
+
+func typesOf(tokens []*token.Token) string {
+	strs := make([]string, len(tokens))
+	for i, tok := range tokens {
+		strs[i] = tok.String()
+	}
+	return strings.Join(strs, " ")
+}
+
+func TestRender(t *testing.T) {
+	tests := []string{
+		generateProgram(3),
+		"a = 0;\nb = 1;\nwhile (a < b) {\n\ta = a + b;\n\tb = a - b;\n}",
+		"if a == = b != ! = c { x = - -1; } var p ptr to array(0x1F) of char = nil;",
+		"x = a / / b; // a comment\ny = 1; // another",
+		"printf \"%d\\n\\t\\\"q\\\"\", 'a', '\\'', '\\x7f'; printf `raw\n\"string\"`;",
+		"printf \"\\x0012\\0a\\101\";",
+		"switch x { case 1: a; default: b; } defer { f(1, 2,); }",
+	}
+	cfg := DefaultConfig
+	cfg.Comments = true
+	for _, in := range tests {
+		tokens, err := LexWith("test", in, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rendered := token.Render(tokens)
+		again, err := LexWith("test", rendered, cfg)
+		if err != nil || !sameValues(tokens, again) {
+			t.Error(
+				"For", in,
+				"expected", typesOf(tokens),
+				"got", rendered, typesOf(again), err,
+			)
+		}
+	}
+}
+
+// sameValues checks that two token streams have the same types and values,
+// wherever they came from in the source.
+func sameValues(a, b []*token.Token) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Type != b[i].Type || a[i].Value != b[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLexValues(t *testing.T) {
+	in := generateProgram(200)
+	tokens, err := Lex("test", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := LexValues("test", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != len(tokens) {
+		t.Fatal(
+			"For", "generated program",
+			"expected", len(tokens), "tokens",
+			"got", len(values),
+		)
+	}
+	for i := range tokens {
+		if values[i] != *tokens[i] {
+			t.Error(
+				"For", "generated program",
+				"expected", *tokens[i],
+				"got", values[i],
+			)
+		}
+	}
+}
+
+// referenceToken lexes a byte followed by a space in the way scan did before
+// it looked bytes up in byteClasses, with a chain of checks. It gives nil for
+// a space, and false for a byte scan handles on its own.
+func referenceToken(b byte) (*token.Token, bool) {
+	if isSpace(b) {
+		return nil, true
+	} else if isAlpha(b) {
+		return tok(token.TokIdentifier, string(b)), true
+	} else if isDigit(b) {
+		return tok(token.TokInteger, string(b)), true
+	} else if typ, ok := byteTokens[b]; ok {
+		return tok(typ, token.ConstantTokens[typ]), true
+	}
+	return nil, false
+}
+
+// TestByteClasses checks that lexing programs made of the bytes that start
+// a token gives the same tokens as classifying each byte with a chain of
+// checks, as scan used to.
+func TestByteClasses(t *testing.T) {
+	var bytes []byte
+	for i := 0; i < 256; i++ {
+		if _, ok := referenceToken(byte(i)); ok {
+			bytes = append(bytes, byte(i))
+		}
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		var in strings.Builder
+		var out []*token.Token
+		for j := 0; j < 50; j++ {
+			b := bytes[rng.Intn(len(bytes))]
+			in.WriteByte(b)
+			in.WriteByte(' ')
+			if expected, _ := referenceToken(b); expected != nil {
+				out = append(out, expected)
+			}
+		}
+		tokens, err := Lex("test", in.String())
+		if err != nil || len(tokens) != len(out) {
+			t.Error(
+				"For", strconv.Quote(in.String()),
+				"expected", typesOf(out),
+				"got", typesOf(tokens), err,
+			)
+			continue
+		}
+		for j := range tokens {
+			if !tokenMatches(tokens[j], out[j]) {
+				t.Error(
+					"For", strconv.Quote(in.String()),
+					"expected", out[j],
+					"got", tokens[j],
+				)
+				break
+			}
+		}
+	}
+}
+
+// multiByteOperators lists the operators that aren't in byteTokens because
+// they begin a longer operator, so scan has to look at the next byte before
+// deciding what they are.
+var multiByteOperators = map[token.Type]string{
+	// '=' may begin "==".
+	token.TokAssign: "==",
+	// '!' may begin "!=".
+	token.TokNot: "!=",
+}
+
+// TestOperatorCoverage checks that the lexer can lex every operator in
+// token.ConstantTokens on its own, so that an operator can't be added to the
+// token package without being wired into the lexer.
+func TestOperatorCoverage(t *testing.T) {
+	for typ, str := range token.ConstantTokens {
+		if _, ok := token.Keywords[str]; ok {
+			continue
+		}
+		_, inBytes := byteTokens[str[0]]
+		_, multi := multiByteOperators[typ]
+		if len(str) == 1 && inBytes == multi {
+			t.Error(
+				"For", str,
+				"expected", "either a byte token or a listed multi-byte operator",
+				"got", inBytes, multi,
+			)
+		}
+		tokens, err := Lex("test", str)
+		if err != nil || len(tokens) != 1 || tokens[0].Type != typ {
+			t.Error(
+				"For", str,
+				"expected", typ,
+				"got", tokens, err,
+			)
+		}
+	}
+}
+
+func BenchmarkLex(b *testing.B) {
+	in := generateProgram(1000)
+	b.SetBytes(int64(len(in)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Lex("bench", in); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLexValues(b *testing.B) {
+	in := generateProgram(1000)
+	b.SetBytes(int64(len(in)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := LexValues("bench", in); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLexOperators(b *testing.B) {
+	in := strings.Repeat("(a+b)*[c-d]/{e<f>g};&h,i:j\n", 10000)
+	b.SetBytes(int64(len(in)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := LexValues("bench", in); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// generateProgram generates a program using most kinds of token, made up of
+// n copies of a loop.
+func generateProgram(n int) string {
+	var buf strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&buf, "var a%d array(10) of int;\n", i)
+		fmt.Fprintf(&buf, "var c%d char = '\\n';\n", i)
+		fmt.Fprintf(&buf, "while i < %d {\n", i)
+		fmt.Fprintf(&buf, "\ta%d[i] = (i + 1) * 2 / 3 - *p;\n", i)
+		buf.WriteString("\tif i == 0 { x = &y; } else if i != 1 { x = nil; }\n")
+		buf.WriteString("}\n")
+	}
+	return buf.String()
+}
@@ -0,0 +1,101 @@
+package lexer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cmgn/compiler/token"
+)
+
+// Relex updates the tokens prev, produced by Lex from oldSrc, so that they
+// match newSrc, which must be oldSrc with the bytes from editStart up to
+// editEnd replaced. Only the tokens around the edit are lexed again; the
+// tokens following it are reused with their positions adjusted. The result
+// is the same as lexing newSrc with Lex.
+func Relex(prev []*token.Token, oldSrc, newSrc string, editStart, editEnd int) ([]*token.Token, error) {
+	if editStart < 0 || editStart > editEnd || editEnd > len(oldSrc) {
+		return nil, fmt.Errorf("invalid edit range %d-%d", editStart, editEnd)
+	}
+	delta := len(newSrc) - len(oldSrc)
+	newEditEnd := editEnd + delta
+	if newEditEnd < editStart || newSrc[:editStart] != oldSrc[:editStart] ||
+		newSrc[newEditEnd:] != oldSrc[editEnd:] {
+		return nil, fmt.Errorf("edit range %d-%d does not match the sources", editStart, editEnd)
+	}
+
+	oldLines := lineStarts(oldSrc)
+	offsets := make([]int, len(prev))
+	for i, tok := range prev {
+		offsets[i] = tok.Source.Offset
+	}
+
+	// The last token starting before the edit may be extended by it, so
+	// lexing restarts from there.
+	first := 0
+	for first < len(prev) && offsets[first] < editStart {
+		first++
+	}
+	if first > 0 {
+		first--
+	}
+	lexer := &lexerState{
+		source: newSrc,
+		line:   1,
+		config: DefaultConfig,
+	}
+	if len(prev) > 0 {
+		lexer.fname = prev[0].Source.FileName
+	}
+	if first > 0 {
+		lexer.line = prev[first].Source.Line
+		lexer.lineStart = oldLines[lexer.line-1]
+		lexer.pos = offsets[first]
+	}
+
+	editEndLine := lexer.line + strings.Count(newSrc[lexer.pos:newEditEnd], "\n")
+	lineDelta := strings.Count(newSrc[editStart:newEditEnd], "\n") -
+		strings.Count(oldSrc[editStart:editEnd], "\n")
+
+	tokens := make([]*token.Token, first, len(prev)+1)
+	copy(tokens, prev[:first])
+	old := first
+	for !lexer.empty() {
+		tok, ok := lexer.next()
+		if !ok {
+			break
+		}
+		// Once a token past the edit starts where a previous token started,
+		// the rest of the tokens are unchanged. Only tokens on later lines
+		// than the edit are reused so that their columns are unaffected.
+		if lexer.start >= newEditEnd && tok.Source.Line > editEndLine {
+			for old < len(prev) && offsets[old] < lexer.start-delta {
+				old++
+			}
+			if old < len(prev) && offsets[old] == lexer.start-delta {
+				for _, tok := range prev[old:] {
+					moved := *tok
+					moved.Source.Line += lineDelta
+					moved.Source.Offset += delta
+					tokens = append(tokens, &moved)
+				}
+				return tokens, nil
+			}
+		}
+		tokens = append(tokens, &tok)
+	}
+	if lexer.err != nil {
+		return nil, lexer.err
+	}
+	return tokens, nil
+}
+
+// lineStarts gets the position in the string at which each line starts.
+func lineStarts(src string) []int {
+	starts := []int{0}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
@@ -0,0 +1,91 @@
+package lexer
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cmgn/compiler/token"
+)
+
+func TestRelex(t *testing.T) {
+	src := "var a int;\nvar bc int;\nwhile a < bc {\n\ta = a + 1;\n}\nbc = 'x';\n"
+	tests := []struct {
+		name   string
+		start  int
+		end    int
+		insert string
+	}{
+		{"insert into identifier", 15, 15, "d"},
+		{"merge two tokens", 14, 16, ""},
+		{"split a token", 15, 15, " "},
+		{"insert new line", 11, 11, "var d int;\n"},
+		{"remove a line", 0, 11, ""},
+		{"span token boundaries", 21, 29, " < "},
+		{"turn '=' into '=='", 42, 42, "="},
+		{"edit at start", 0, 0, "x;"},
+		{"edit at end", len(src), len(src), "y;"},
+		{"join lines", 10, 11, ""},
+		{"replace everything", 0, len(src), "a;\n\nb;"},
+	}
+	prev, err := Lex("test", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		newSrc := src[:test.start] + test.insert + src[test.end:]
+		expected, err := Lex("test", newSrc)
+		if err != nil {
+			t.Fatal(test.name, err)
+		}
+		out, err := Relex(prev, src, newSrc, test.start, test.end)
+		if err != nil {
+			t.Error(
+				"For", test.name,
+				"expected", "no error",
+				"got", err,
+			)
+			continue
+		}
+		if describe(out) != describe(expected) {
+			t.Error(
+				"For", test.name,
+				"expected", describe(expected),
+				"got", describe(out),
+			)
+		}
+	}
+}
+
+func TestRelexError(t *testing.T) {
+	src := "a = b;\nc = d;\n"
+	prev, err := Lex("test", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSrc := "a = @;\nc = d;\n"
+	if out, err := Relex(prev, src, newSrc, 4, 5); err == nil {
+		t.Error(
+			"For", newSrc,
+			"expected", "error",
+			"got", describe(out),
+		)
+	}
+	if out, err := Relex(prev, src, newSrc, 0, 1); err == nil {
+		t.Error(
+			"For", "mismatched edit range",
+			"expected", "error",
+			"got", describe(out),
+		)
+	}
+}
+
+// describe renders tokens along with their positions.
+func describe(tokens []*token.Token) string {
+	strs := make([]string, len(tokens))
+	for i, tok := range tokens {
+		strs[i] = tok.Source.String() + ":" + strconv.Itoa(tok.Source.Column) +
+			"@" + strconv.Itoa(tok.Source.Offset) + " " + tok.String()
+	}
+	return strings.Join(strs, ", ")
+}
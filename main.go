@@ -3,48 +3,214 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
+	"strings"
 
+	"github.com/cmgn/compiler/ast"
+	"github.com/cmgn/compiler/interp"
 	"github.com/cmgn/compiler/lexer"
 	"github.com/cmgn/compiler/parser"
+	"github.com/cmgn/compiler/sema"
+	"github.com/cmgn/compiler/token"
 )
 
-func runString(filename, str string) {
+// session is a REPL session. Each line of input runs in the same interpreter,
+// so that the variables declared by one line can be used by the next.
+type session struct {
+	out io.Writer
+	in  *interp.Interpreter
+	// stmts holds the statements of every line run so far. Each line is
+	// checked along with them, as though the lines were one program.
+	stmts []ast.Statement
+}
+
+// newSession creates a REPL session with no variables, writing its output to
+// out.
+func newSession(out io.Writer) *session {
+	cfg := interp.DefaultConfig
+	cfg.Output = out
+	return &session{out: out, in: interp.NewWith(cfg)}
+}
+
+// runString checks and runs a line of input in the session. A line that is
+// invalid, or fails when it is run, is reported and leaves the session as it
+// was before the line. A line may end in an integer or character expression
+// without a ';', whose value is printed once the rest of the line has run.
+func (s *session) runString(filename, str string) {
 	tokens, err := lexer.Lex(filename, str)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(s.out, err)
 		return
 	}
-	stmts, err := parser.Parse(tokens)
+	cfg := parser.DefaultConfig
+	cfg.TrailingExpression = true
+	result, err := parser.ParseWith(tokens, cfg)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(s.out, err)
 		return
 	}
-	for _, stmt := range stmts {
-		fmt.Println(stmt.String())
+	stmts := append(s.stmts[:len(s.stmts):len(s.stmts)], result.Statements...)
+	info, err := sema.Analyze(stmts, sema.DefaultConfig)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	run, expr := result.Statements, trailingExpression(tokens, result.Statements, info)
+	if expr != nil {
+		run = run[:len(run)-1]
+	}
+	snap := s.in.Snapshot()
+	if err := s.in.EvalWith(run, info); err != nil {
+		s.in.Restore(snap)
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	if expr != nil {
+		n, err := s.in.EvalExpression(expr, info)
+		if err != nil {
+			s.in.Restore(snap)
+			fmt.Fprintln(s.out, err)
+			return
+		}
+		if isPrimitive(info.TypeOf(expr), ast.CharType) {
+			fmt.Fprintln(s.out, token.Quote(string(byte(n)), '\''))
+		} else {
+			fmt.Fprintln(s.out, n)
+		}
+	}
+	s.stmts = stmts
+}
+
+// trailingExpression gets the expression a line ends in if it has no ';' after
+// it and holds an integer or a character, or nil if it doesn't.
+func trailingExpression(tokens []*token.Token, stmts []ast.Statement, info *sema.Info) ast.Expression {
+	if len(tokens) == 0 || tokens[len(tokens)-1].Type == token.TokSemiColon || len(stmts) == 0 {
+		return nil
+	}
+	stmt, ok := stmts[len(stmts)-1].(*ast.ExpressionStatement)
+	if !ok {
+		return nil
+	}
+	if typ := info.TypeOf(stmt.Expression); !isPrimitive(typ, ast.IntType) && !isPrimitive(typ, ast.CharType) {
+		return nil
 	}
+	return stmt.Expression
 }
 
-func mustRead(filename string) string {
-	contents, err := ioutil.ReadFile(filename)
+// isPrimitive checks if a type is the given primitive type.
+func isPrimitive(typ ast.Type, prim ast.PrimitiveType) bool {
+	p, ok := typ.(*ast.Primitive)
+	return ok && p.Type == prim
+}
+
+// replCommands maps the names of the REPL's meta-commands to the functions
+// that handle them. Each function is given the rest of the line after the
+// command's name.
+var replCommands = map[string]func(out io.Writer, arg string){
+	"tokens": func(out io.Writer, arg string) {
+		tokens, err := lexer.Lex("<stdin>", arg)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return
+		}
+		strs := make([]string, len(tokens))
+		for i, tok := range tokens {
+			strs[i] = tok.String()
+		}
+		fmt.Fprintln(out, strings.Join(strs, " "))
+	},
+	"ast": func(out io.Writer, arg string) {
+		expr, err := parseExpression(arg)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return
+		}
+		fmt.Fprintln(out, expr.String())
+	},
+	"group": func(out io.Writer, arg string) {
+		expr, err := parseExpression(arg)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return
+		}
+		fmt.Fprint(out, ast.Grouping(expr))
+	},
+}
+
+// typeOf writes the type of an expression to the session's output. The
+// expression is checked after the session's statements, so it can use the
+// variables and types they declare.
+func (s *session) typeOf(arg string) {
+	expr, err := parseExpression(arg)
 	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(1)
+		fmt.Fprintln(s.out, err)
+		return
 	}
-	return string(contents)
+	stmt := &ast.ExpressionStatement{Expression: expr}
+	info, err := sema.Analyze(append(s.stmts[:len(s.stmts):len(s.stmts)], stmt), sema.DefaultConfig)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	fmt.Fprintln(s.out, sema.TypeName(info.TypeOf(expr)))
+}
+
+func parseExpression(str string) (ast.Expression, error) {
+	tokens, err := lexer.Lex("<stdin>", str)
+	if err != nil {
+		return nil, err
+	}
+	return parser.ParseExpression(tokens)
+}
+
+// runLine runs a line of input to the REPL, writing any output to the
+// session's output. Lines starting with a colon are meta-commands, anything
+// else is run as part of the session's program. It returns false if the REPL
+// should exit.
+func (s *session) runLine(line string) bool {
+	out := s.out
+	if !strings.HasPrefix(line, ":") {
+		s.runString("<stdin>", line)
+		return true
+	}
+	fields := strings.SplitN(strings.TrimSpace(line[1:]), " ", 2)
+	name, arg := fields[0], ""
+	if len(fields) == 2 {
+		arg = fields[1]
+	}
+	if name == "quit" {
+		return false
+	}
+	if name == "type" {
+		s.typeOf(arg)
+		return true
+	}
+	cmd, ok := replCommands[name]
+	if !ok {
+		fmt.Fprintf(out, "unknown command :%s\n", name)
+		return true
+	}
+	cmd(out, arg)
+	return true
 }
 
 func main() {
 	if len(os.Args) == 1 {
 		scanner := bufio.NewScanner(os.Stdin)
+		repl := newSession(os.Stdout)
 		for scanner.Scan() {
-			runString("<stdin>", scanner.Text())
+			if !repl.runLine(scanner.Text()) {
+				return
+			}
 		}
 		return
 	}
 
-	for _, filename := range os.Args[1:] {
-		runString(filename, mustRead(filename))
+	if err := dispatch(os.Stdout, os.Args[1:]); err != nil {
+		if err != errReported {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cmgn/compiler/sema"
+)
+
+func TestRunLine(t *testing.T) {
+	tests := []struct {
+		in   string
+		out  string
+		more bool
+	}{
+		{":tokens a = 1;", "'a' '=' '1' ';'\n", true},
+		{":ast 1 + 2 * a", "BinaryOperator['+', 1, BinaryOperator['*', 2, a]]\n", true},
+		{":type &'a'", "[<stdin>:1] cannot take address of non-lvalue\n", true},
+		{":type 1 < 2", "int\n", true},
+		{":type 'a'", "char\n", true},
+		{":type nil", "nil\n", true},
+		{":type a", "[<stdin>:1] undeclared variable a\n", true},
+		{":ast 1 2", "[<stdin>:1] unexpected '2'\n", true},
+		{":group a - b * c", "(a - (b * c)): '-' precedence 3, left-associative\n(b * c): '*' precedence 4, left-associative\n", true},
+		{":group a", "", true},
+		{":bogus", "unknown command :bogus\n", true},
+		{"a = 1;", "[<stdin>:1] undeclared variable a\n", true},
+		{"printf \"%d\", 1 + 2;", "3", true},
+		{":quit", "", false},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		more := newSession(&out).runLine(test.in)
+		if out.String() != test.out || more != test.more {
+			t.Error(
+				"For", test.in,
+				"expected", test.out, test.more,
+				"got", out.String(), more,
+			)
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	lines := []struct {
+		in  string
+		out string
+	}{
+		{"var a int = 1;", ""},
+		{"var b array(2) of int = {a, a + 1}; a = b[1] * 10;", ""},
+		{"printf \"%d\\n\", a;", "20\n"},
+		{"var a char;", "[<stdin>:1] redeclaration of a\n"},
+		{"c = 1;", "[<stdin>:1] undeclared variable c\n"},
+		{"a = 5; var d int = 1; assert a == 6;", "[<stdin>:1] assertion failed: a == 6\n"},
+		{"var d int = a + b[0];", ""},
+		{"printf \"%d %d\\n\", a, d;", "20 21\n"},
+		{"a + d", "41\n"},
+		{"a + d;", ""},
+		{"d = a; 'x'", "'x'\n"},
+		{"printf \"%d\\n\", d; d * 2", "20\n40\n"},
+		{"var p ptr to int;", ""},
+		{"p = p + 1;", "[<stdin>:1] arithmetic on nil pointer\n"},
+		{":type a", "int\n"},
+		{":type b", "array(2) of int\n"},
+		{":type &b[0] + d", "ptr to int\n"},
+	}
+	var out bytes.Buffer
+	repl := newSession(&out)
+	for _, line := range lines {
+		out.Reset()
+		if !repl.runLine(line.in) || out.String() != line.out {
+			t.Error(
+				"For", line.in,
+				"expected", line.out,
+				"got", out.String(),
+			)
+		}
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	valid := tempFile(t, "var a int = 1;\nassert a == 1;")
+	defer os.Remove(valid)
+	failing := tempFile(t, "assert 1 == 2;")
+	defer os.Remove(failing)
+	tests := []struct {
+		args []string
+		out  string
+		err  string
+	}{
+		{[]string{"lex", valid}, "'var' 'a' 'int' '=' '1' ';' 'assert' 'a' '==' '1' ';'\n", ""},
+		{[]string{"parse", valid}, "Declaration[a, 'int', 1]\nAssert[BinaryOperator['==', a, 1]]\n", ""},
+		{[]string{"run", valid}, "", ""},
+		{[]string{"run", failing}, "", "[" + failing + ":1] assertion failed: 1 == 2"},
+		{[]string{"build", valid}, "", "build: code generation is not supported yet"},
+		{[]string{"parse"}, "", "usage: compiler parse [flags] <file>"},
+		{[]string{"bogus", valid}, "", "unknown command bogus"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		err := dispatch(&out, test.args)
+		errStr := ""
+		if err != nil {
+			errStr = err.Error()
+		}
+		if out.String() != test.out || errStr != test.err {
+			t.Error(
+				"For", test.args,
+				"expected", test.out, test.err,
+				"got", out.String(), errStr,
+			)
+		}
+	}
+}
+
+func TestCheckDiagnostics(t *testing.T) {
+	clean := tempFile(t, "var a int = 1;\nassert a == 1;")
+	defer os.Remove(clean)
+	typeError := tempFile(t, "var a int;\nvar p ptr to int = a;")
+	defer os.Remove(typeError)
+	unused := tempFile(t, "var a int = 1;\nvar b int;\nassert a == 1;")
+	defer os.Remove(unused)
+	syntaxError := tempFile(t, "var a int\n= ;")
+	defer os.Remove(syntaxError)
+	several := tempFile(t, "var a int = 1\nvar b int = c;\nvar d char = e;")
+	defer os.Remove(several)
+	tests := []struct {
+		filename string
+		strict   bool
+		out      []string
+		status   int
+	}{
+		{clean, false, []string{}, 0},
+		{typeError, false, []string{"[" + typeError + ":2] cannot assign int to ptr to int"}, 1},
+		{unused, false, []string{"warning: [" + unused + ":2] b declared but never used"}, 0},
+		{unused, true, []string{"[" + unused + ":2] b declared but never used"}, 1},
+		{syntaxError, false, []string{"[" + syntaxError + ":2] unexpected ';'"}, 1},
+		{several, false, []string{
+			"[" + several + ":1] missing ';'",
+			"[" + several + ":2] undeclared variable c",
+		}, 1},
+	}
+	for _, test := range tests {
+		_, opts := newFlagSet(ioutil.Discard, "check")
+		if test.strict {
+			opts.sema.Strict = sema.Categories
+		}
+		diagnostics, status := checkDiagnostics([]string{test.filename}, opts)
+		out := make([]string, len(diagnostics))
+		for i, d := range diagnostics {
+			out[i] = d.String()
+		}
+		if strings.Join(out, "\n") != strings.Join(test.out, "\n") || status != test.status {
+			t.Error(
+				"For", test.filename, test.strict,
+				"expected", test.out, test.status,
+				"got", out, status,
+			)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := dispatch(&out, []string{"check", typeError}); err != errReported ||
+		out.String() != "["+typeError+":2] cannot assign int to ptr to int\n" {
+		t.Error(
+			"For", "check", typeError,
+			"expected", "the error to be written to the output",
+			"got", out.String(), err,
+		)
+	}
+	out.Reset()
+	if err := dispatch(&out, []string{"check", clean}); err != nil || out.String() != "" {
+		t.Error(
+			"For", "check", clean,
+			"expected", "no output",
+			"got", out.String(), err,
+		)
+	}
+}
+
+func TestDispatchProgram(t *testing.T) {
+	a := tempFile(t, "var n int = 3;")
+	defer os.Remove(a)
+	b := tempFile(t, "var m int = n * 2;\nprintf \"%d\\n\", m;")
+	defer os.Remove(b)
+	redeclared := tempFile(t, "var n char;")
+	defer os.Remove(redeclared)
+	several := tempFile(t, "var a int = 1\nvar b int = c;")
+	defer os.Remove(several)
+	tests := []struct {
+		args []string
+		out  string
+		err  string
+	}{
+		{[]string{"run", a, b}, "6\n", ""},
+		{[]string{"run", b, a}, "", "[" + b + ":1] undeclared variable n"},
+		{[]string{"check", a, b}, "", ""},
+		{[]string{"check", a, redeclared}, "[" + redeclared + ":1] redeclaration of n, already declared at " + a + ":1\n", errReported.Error()},
+		{[]string{"run"}, "", "usage: compiler run [flags] <file>..."},
+		{[]string{"run", several}, "", "[" + several + ":1] missing ';'\n[" + several + ":2] undeclared variable c"},
+		{[]string{"build", a, several}, "", "[" + several + ":1] missing ';'\n[" + several + ":2] undeclared variable c"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		err := dispatch(&out, test.args)
+		errStr := ""
+		if err != nil {
+			errStr = err.Error()
+		}
+		if out.String() != test.out || errStr != test.err {
+			t.Error(
+				"For", test.args,
+				"expected", test.out, test.err,
+				"got", out.String(), errStr,
+			)
+		}
+	}
+}
+
+func TestDispatchFlags(t *testing.T) {
+	filename := tempFile(t, "a = 1\nb = 2\n")
+	defer os.Remove(filename)
+	var out bytes.Buffer
+	err := dispatch(&out, []string{"parse", "-semicolons", filename})
+	expected := "Assignment[a, 1]\nAssignment[b, 2]\n"
+	if err != nil || out.String() != expected {
+		t.Error(
+			"For", "parse -semicolons",
+			"expected", expected,
+			"got", out.String(), err,
+		)
+	}
+}
+
+func TestDispatchStrict(t *testing.T) {
+	filename := tempFile(t, "var a int = 1;\nvar b int;\nassert a == 1;")
+	defer os.Remove(filename)
+	warning := "[" + filename + ":2] b declared but never used"
+	tests := []struct {
+		args []string
+		out  string
+		err  string
+	}{
+		{[]string{"run", filename}, "warning: " + warning + "\n", ""},
+		{[]string{"run", "-strict", filename}, "", warning},
+		{[]string{"run", "-strict=unused", filename}, "", warning},
+		{[]string{"run", "-strict=shadow", filename}, "warning: " + warning + "\n", ""},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		err := dispatch(&out, test.args)
+		errStr := ""
+		if err != nil {
+			errStr = err.Error()
+		}
+		if out.String() != test.out || errStr != test.err {
+			t.Error(
+				"For", test.args,
+				"expected", test.out, test.err,
+				"got", out.String(), errStr,
+			)
+		}
+	}
+	var out bytes.Buffer
+	err := dispatch(&out, []string{"run", "-strict=bogus", filename})
+	if err == nil || !strings.Contains(err.Error(), "unknown warning category bogus") {
+		t.Error(
+			"For", "-strict=bogus",
+			"expected", "unknown warning category bogus",
+			"got", err,
+		)
+	}
+}
+
+func TestDispatchDiagnostics(t *testing.T) {
+	lexError := tempFile(t, "var a int;\na = 1 # 2;")
+	defer os.Remove(lexError)
+	parseError := tempFile(t, "var a int;\na = ;")
+	defer os.Remove(parseError)
+	unused := tempFile(t, "var a int;")
+	defer os.Remove(unused)
+	tests := []struct {
+		args []string
+		out  string
+	}{
+		{
+			[]string{"lex", "-diagnostics=json", lexError},
+			`{"file":"` + lexError + `","line":2,"column":7,"endLine":2,"endColumn":7,"severity":"error","message":"unexpected #"}` + "\n",
+		},
+		{
+			[]string{"parse", "-diagnostics=json", parseError},
+			`{"file":"` + parseError + `","line":2,"column":5,"endLine":2,"endColumn":5,"severity":"error","message":"unexpected ';'"}` + "\n",
+		},
+		{
+			[]string{"run", "-diagnostics=json", unused},
+			`{"file":"` + unused + `","line":1,"column":1,"endLine":1,"endColumn":1,"severity":"warning","message":"a declared but never used"}` + "\n",
+		},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		err := dispatch(&out, test.args)
+		if out.String() != test.out {
+			t.Error(
+				"For", test.args,
+				"expected", test.out,
+				"got", out.String(), err,
+			)
+		}
+	}
+	var out bytes.Buffer
+	if err := dispatch(&out, []string{"parse", "-diagnostics=json", parseError}); err != errReported {
+		t.Error(
+			"For", "-diagnostics=json",
+			"expected", errReported,
+			"got", err,
+		)
+	}
+}
+
+func TestDispatchBoundsCheck(t *testing.T) {
+	filename := tempFile(t, "var a array(2) of array(2) of int;\nvar i int = 2;\na[0][i] = 1;\nassert a[1][0] == 1;")
+	defer os.Remove(filename)
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"run", filename}, "[" + filename + ":3] index 2 out of range for array(2) of int"},
+		{[]string{"run", "-no-bounds-check", filename}, ""},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		err := dispatch(&out, test.args)
+		errStr := ""
+		if err != nil {
+			errStr = err.Error()
+		}
+		if errStr != test.err {
+			t.Error(
+				"For", test.args,
+				"expected", test.err,
+				"got", errStr,
+			)
+		}
+	}
+}
+
+func TestDispatchTime(t *testing.T) {
+	filename := tempFile(t, "var a int = 1;\nassert a == 1;")
+	defer os.Remove(filename)
+	var timings bytes.Buffer
+	timingOutput = &timings
+	defer func() { timingOutput = os.Stderr }()
+	tests := []struct {
+		args   []string
+		phases []string
+	}{
+		{[]string{"run", filename}, nil},
+		{[]string{"run", "-time", filename}, []string{"lex", "parse", "check", "run", "total"}},
+		{[]string{"parse", "-time", filename}, []string{"lex", "parse", "total"}},
+	}
+	for _, test := range tests {
+		timings.Reset()
+		var out bytes.Buffer
+		if err := dispatch(&out, test.args); err != nil {
+			t.Fatal(err)
+		}
+		var phases []string
+		for _, line := range strings.Split(strings.TrimSpace(timings.String()), "\n") {
+			if fields := strings.Fields(line); len(fields) == 2 {
+				phases = append(phases, fields[0])
+			}
+		}
+		if strings.Join(phases, " ") != strings.Join(test.phases, " ") {
+			t.Error(
+				"For", test.args,
+				"expected", test.phases,
+				"got", timings.String(),
+			)
+		}
+	}
+}
+
+func tempFile(t *testing.T, contents string) string {
+	f, err := ioutil.TempFile("", "compiler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
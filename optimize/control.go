@@ -0,0 +1,92 @@
+package optimize
+
+import "github.com/cmgn/compiler/ast"
+
+// SimplifyControlFlow removes branches that can never be taken. An if
+// statement whose condition folds to a constant is replaced by the branch that
+// is taken, and a while statement whose condition folds to zero is removed.
+func SimplifyControlFlow(stmts []ast.Statement) []ast.Statement {
+	simplified := make([]ast.Statement, 0, len(stmts))
+	for _, stmt := range stmts {
+		if stmt = simplify(stmt); stmt != nil {
+			simplified = append(simplified, stmt)
+		}
+	}
+	return simplified
+}
+
+// simplify simplifies a single statement, returning nil if it should be
+// removed entirely.
+func simplify(stmt ast.Statement) ast.Statement {
+	switch stmt := stmt.(type) {
+	case *ast.IfStatement:
+		cond := Fold(stmt.Condition)
+		if val, ok := constant(cond); ok {
+			taken := stmt.Statement2
+			if val != 0 {
+				taken = stmt.Statement1
+			}
+			if _, ok := taken.(*ast.Empty); ok {
+				return nil
+			}
+			return simplify(scoped(taken))
+		}
+		return &ast.IfStatement{
+			Source:     stmt.Source,
+			End:        stmt.End,
+			Condition:  cond,
+			Statement1: simplifyBranch(stmt.Statement1),
+			Statement2: simplifyBranch(stmt.Statement2),
+		}
+	case *ast.WhileStatement:
+		cond := Fold(stmt.Condition)
+		if val, ok := constant(cond); ok && val == 0 {
+			if stmt.Else != nil {
+				return simplify(scoped(stmt.Else))
+			}
+			return nil
+		}
+		loop := &ast.WhileStatement{
+			Source:    stmt.Source,
+			End:       stmt.End,
+			Condition: cond,
+			Statement: simplifyBranch(stmt.Statement),
+		}
+		if stmt.Else != nil {
+			loop.Else = simplifyBranch(stmt.Else)
+		}
+		return loop
+	case *ast.BlockStatement:
+		return &ast.BlockStatement{
+			Source:     stmt.Source,
+			End:        stmt.End,
+			Statements: SimplifyControlFlow(stmt.Statements),
+		}
+	}
+	return stmt
+}
+
+// simplifyBranch simplifies the branch of an if or while statement, which must
+// remain a statement even if it is removed.
+func simplifyBranch(stmt ast.Statement) ast.Statement {
+	simplified := simplify(stmt)
+	if simplified == nil {
+		return &ast.Empty{Source: *stmt.SourceInfo()}
+	}
+	return simplified
+}
+
+// scoped wraps a branch in a block, since a branch is a scope of its own
+// even without braces. Variables it declares then stay out of the enclosing
+// scope once the branch replaces the statement it belonged to, and
+// statements it defers still run when the branch ends.
+func scoped(stmt ast.Statement) ast.Statement {
+	if _, ok := stmt.(*ast.BlockStatement); ok {
+		return stmt
+	}
+	return &ast.BlockStatement{
+		Source:     *stmt.SourceInfo(),
+		End:        stmt.Span().End,
+		Statements: []ast.Statement{stmt},
+	}
+}
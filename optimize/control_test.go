@@ -0,0 +1,51 @@
+package optimize_test
+
+import (
+	"testing"
+
+	"github.com/cmgn/compiler/interp"
+	"github.com/cmgn/compiler/lexer"
+	"github.com/cmgn/compiler/optimize"
+	"github.com/cmgn/compiler/parser"
+	"github.com/cmgn/compiler/sema"
+)
+
+// TestSimplifyControlFlowBehavior checks that simplified programs leave
+// their variables with the same values as the programs they came from. This
+// is an external test, as the interpreter depends on this package.
+func TestSimplifyControlFlowBehavior(t *testing.T) {
+	tests := []string{
+		"var x int; { if 1 defer x = 1; x = 2; }",
+		"var x int; { if 0 x = 5; else defer x = 1; x = 2; }",
+		"var x int = 1; if 1 var x int = 2;",
+		"var x int; var i int; while i < 3 { if 1 { defer x = x + i; } i = i + 1; }",
+	}
+	for _, in := range tests {
+		toks, err := lexer.Lex("test", in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmts, err := parser.Parse(toks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sema.Check(stmts); err != nil {
+			t.Fatal(err)
+		}
+		before, after := interp.New(), interp.New()
+		if err := before.Eval(stmts); err != nil {
+			t.Fatal(err)
+		}
+		if err := after.Eval(optimize.SimplifyControlFlow(stmts)); err != nil {
+			t.Fatal(err)
+		}
+		want, _ := before.Value("x")
+		if got, _ := after.Value("x"); got != want {
+			t.Error(
+				"For", in,
+				"expected", want,
+				"got", got,
+			)
+		}
+	}
+}
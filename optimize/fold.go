@@ -0,0 +1,236 @@
+// Package optimize provides optimisation passes over the syntax tree provided
+// by package ast.
+package optimize
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/cmgn/compiler/arith"
+	"github.com/cmgn/compiler/ast"
+)
+
+// Config holds the options that control how expressions are folded.
+type Config struct {
+	// BigIntegers makes folding use arbitrary precision arithmetic instead of
+	// 64 bit arithmetic, so folded constants may not fit in an int. They are
+	// checked when they are finally converted with Integer.Int64.
+	BigIntegers bool
+	// Overflow says what happens when 64 bit arithmetic overflows. With
+	// arith.Trap, expressions that overflow are left for the program to fail
+	// on at run time.
+	Overflow arith.Overflow
+	// ReportOverflow treats 64 bit arithmetic that overflows as a mistake
+	// rather than folding it according to Overflow. The expression is left
+	// unfolded, and FoldChecked reports it as an error.
+	ReportOverflow bool
+}
+
+// DefaultConfig is the configuration used by Fold.
+var DefaultConfig = Config{}
+
+// Fold evaluates the constant parts of an expression at compile time,
+// returning the simplified expression. The expression passed in is not
+// modified.
+func Fold(expr ast.Expression) ast.Expression {
+	return FoldWith(expr, DefaultConfig)
+}
+
+// FoldWith folds an expression in the same way as Fold, but using the options
+// given in cfg.
+func FoldWith(expr ast.Expression, cfg Config) ast.Expression {
+	f := &folder{config: cfg}
+	return ast.Rewrite(expr, f.fold).(ast.Expression)
+}
+
+// FoldChecked folds an expression in the same way as FoldWith, but also
+// returns an error for the first operation found to overflow if
+// cfg.ReportOverflow is set.
+func FoldChecked(expr ast.Expression, cfg Config) (ast.Expression, error) {
+	f := &folder{config: cfg}
+	folded := ast.Rewrite(expr, f.fold).(ast.Expression)
+	return folded, f.err
+}
+
+// folder holds the state of constant folding.
+type folder struct {
+	config Config
+	// err is the first overflow found if overflows are being reported.
+	err error
+}
+
+// mode gets the overflow behaviour to fold with. Overflows that are being
+// reported are trapped so that they are left unfolded.
+func (f *folder) mode() arith.Overflow {
+	if f.config.ReportOverflow {
+		return arith.Trap
+	}
+	return f.config.Overflow
+}
+
+// overflow records that folding an expression overflowed, if overflows are
+// being reported.
+func (f *folder) overflow(expr ast.Expression) {
+	if f.config.ReportOverflow && f.err == nil {
+		f.err = fmt.Errorf("[%s] constant %s overflows int", expr.SourceInfo().String(), ast.FormatExpression(expr))
+	}
+}
+
+// fold folds a single node whose children have already been folded.
+func (f *folder) fold(node ast.Node) ast.Node {
+	if f.config.BigIntegers {
+		return foldBig(node)
+	}
+	switch node := node.(type) {
+	case *ast.BinaryOperator:
+		l, lok := constant(node.Left)
+		r, rok := constant(node.Right)
+		if lok && rok {
+			val, err := foldBinary(f.mode(), node.Type, l, r)
+			if err == nil {
+				return integer(node, val)
+			}
+			if err == arith.ErrOverflow {
+				f.overflow(node)
+			}
+		}
+	case *ast.UnaryOperator:
+		if v, ok := constant(node.Value); ok && node.Type == ast.UnaryMinus {
+			val, err := arith.Neg(f.mode(), v)
+			if err == nil {
+				return integer(node, val)
+			}
+			f.overflow(node)
+		}
+	}
+	return node
+}
+
+// foldBig folds a single node using arbitrary precision arithmetic.
+func foldBig(node ast.Node) ast.Node {
+	switch node := node.(type) {
+	case *ast.BinaryOperator:
+		l, lok := bigConstant(node.Left)
+		r, rok := bigConstant(node.Right)
+		if lok && rok {
+			if val, ok := foldBigBinary(node.Type, l, r); ok {
+				return &ast.Integer{
+					Source: *node.SourceInfo(),
+					Value:  val.String(),
+				}
+			}
+		}
+	case *ast.UnaryOperator:
+		if v, ok := bigConstant(node.Value); ok && node.Type == ast.UnaryMinus {
+			return &ast.Integer{
+				Source: *node.SourceInfo(),
+				Value:  v.Neg(v).String(),
+			}
+		}
+	}
+	return node
+}
+
+// constant gets the value of an expression if it is an integer literal.
+func constant(expr ast.Expression) (int64, bool) {
+	i, ok := expr.(*ast.Integer)
+	if !ok {
+		return 0, false
+	}
+	val, err := i.Int64()
+	if err != nil {
+		return 0, false
+	}
+	return val, true
+}
+
+// bigConstant gets the arbitrary precision value of an expression if it is an
+// integer literal.
+func bigConstant(expr ast.Expression) (*big.Int, bool) {
+	i, ok := expr.(*ast.Integer)
+	if !ok {
+		return nil, false
+	}
+	return i.Big()
+}
+
+// integer creates an integer literal with the given value, taking its source
+// information from the expression it replaces.
+func integer(expr ast.Expression, val int64) *ast.Integer {
+	return &ast.Integer{
+		Source: *expr.SourceInfo(),
+		Value:  strconv.FormatInt(val, 10),
+	}
+}
+
+// foldBinary applies a binary operator to two constants. An error is returned
+// if the operation cannot be performed at compile time, which is
+// arith.ErrOverflow if it overflowed.
+func foldBinary(mode arith.Overflow, typ ast.BinaryOperatorType, l, r int64) (int64, error) {
+	switch typ {
+	case ast.BinaryAdd:
+		return arith.Add(mode, l, r)
+	case ast.BinarySub:
+		return arith.Sub(mode, l, r)
+	case ast.BinaryMul:
+		return arith.Mul(mode, l, r)
+	case ast.BinaryDiv:
+		if r == 0 {
+			return 0, errDivisionByZero
+		}
+		return arith.Div(mode, l, r)
+	case ast.BinaryLessThan:
+		return boolean(l < r), nil
+	case ast.BinaryGreaterThan:
+		return boolean(l > r), nil
+	case ast.BinaryEqual:
+		return boolean(l == r), nil
+	case ast.BinaryNotEqual:
+		return boolean(l != r), nil
+	}
+	return 0, errNotConstant
+}
+
+// Errors for operations that can't be folded.
+var (
+	errDivisionByZero = errors.New("division by zero")
+	errNotConstant    = errors.New("operator can't be folded")
+)
+
+// foldBigBinary applies a binary operator to two arbitrary precision
+// constants, in the same way as foldBinary.
+func foldBigBinary(typ ast.BinaryOperatorType, l, r *big.Int) (*big.Int, bool) {
+	switch typ {
+	case ast.BinaryAdd:
+		return new(big.Int).Add(l, r), true
+	case ast.BinarySub:
+		return new(big.Int).Sub(l, r), true
+	case ast.BinaryMul:
+		return new(big.Int).Mul(l, r), true
+	case ast.BinaryDiv:
+		if r.Sign() == 0 {
+			return nil, false
+		}
+		// Quo truncates towards zero like fixed-width division does.
+		return new(big.Int).Quo(l, r), true
+	case ast.BinaryLessThan:
+		return big.NewInt(boolean(l.Cmp(r) < 0)), true
+	case ast.BinaryGreaterThan:
+		return big.NewInt(boolean(l.Cmp(r) > 0)), true
+	case ast.BinaryEqual:
+		return big.NewInt(boolean(l.Cmp(r) == 0)), true
+	case ast.BinaryNotEqual:
+		return big.NewInt(boolean(l.Cmp(r) != 0)), true
+	}
+	return nil, false
+}
+
+// boolean converts a boolean into its integer representation.
+func boolean(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
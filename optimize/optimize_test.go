@@ -0,0 +1,223 @@
+package optimize
+
+import (
+	"testing"
+
+	"github.com/cmgn/compiler/arith"
+	"github.com/cmgn/compiler/ast"
+	"github.com/cmgn/compiler/lexer"
+	"github.com/cmgn/compiler/parser"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"1 + 2 * 3;", "7"},
+		{"(10 - 4) / 2;", "3"},
+		{"1 < 2;", "1"},
+		{"3 == 4;", "0"},
+		{"-(2 + 3);", "-5"},
+		{"1 / 0;", "BinaryOperator['/', 1, 0]"},
+		{"a + 2 * 3;", "BinaryOperator['+', a, 6]"},
+		{"0x10 + 0xa;", "26"},
+		{"-0x10 + 0;", "-16"},
+	}
+	for _, test := range tests {
+		stmts := parse(t, test.in)
+		expr := stmts[0].(*ast.ExpressionStatement).Expression
+		if out := Fold(expr).String(); out != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", out,
+			)
+		}
+	}
+}
+
+func TestFoldBigIntegers(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"3037000500 * 3037000500;", "9223372037000250000"},
+		{"9223372036854775807 + 1;", "9223372036854775808"},
+		{"(99999999999999999999 - 99999999999999999998) * -7 / 2;", "-3"},
+		{"18446744073709551616 > 9223372036854775807;", "1"},
+	}
+	for _, test := range tests {
+		stmts := parse(t, test.in)
+		expr := stmts[0].(*ast.ExpressionStatement).Expression
+		folded := FoldWith(expr, Config{BigIntegers: true})
+		if folded.String() != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", folded.String(),
+			)
+		}
+	}
+}
+
+func TestBigIntegerOverflow(t *testing.T) {
+	in := "3037000500 * 3037000500;"
+	stmts := parse(t, in)
+	expr := stmts[0].(*ast.ExpressionStatement).Expression
+	folded := FoldWith(expr, Config{BigIntegers: true})
+	if _, err := folded.(*ast.Integer).Int64(); err == nil {
+		t.Error(
+			"For", in,
+			"expected", "overflow error",
+			"got", "nil",
+		)
+	}
+}
+
+func TestFoldOverflow(t *testing.T) {
+	in := "9223372036854775807 + 1;"
+	tests := []struct {
+		mode arith.Overflow
+		out  string
+	}{
+		{arith.Wrap, "-9223372036854775808"},
+		{arith.Saturate, "9223372036854775807"},
+		{arith.Trap, "BinaryOperator['+', 9223372036854775807, 1]"},
+	}
+	for _, test := range tests {
+		expr := parse(t, in)[0].(*ast.ExpressionStatement).Expression
+		if out := FoldWith(expr, Config{Overflow: test.mode}).String(); out != test.out {
+			t.Error(
+				"For", in, test.mode,
+				"expected", test.out,
+				"got", out,
+			)
+		}
+	}
+}
+
+func TestFoldReportOverflow(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+		err string
+	}{
+		{
+			"10000000 * 10000000 * 10000000;",
+			"BinaryOperator['*', 100000000000000, 10000000]",
+			"[test:1] constant 100000000000000 * 10000000 overflows int",
+		},
+		{
+			"-(-9223372036854775808) + 1;",
+			"BinaryOperator['+', UnaryOperator['-', -9223372036854775808], 1]",
+			"[test:1] constant -(-9223372036854775808) overflows int",
+		},
+		{"1000 * 1000 * 1000;", "1000000000", ""},
+		{"1 / 0;", "BinaryOperator['/', 1, 0]", ""},
+	}
+	cfg := Config{ReportOverflow: true}
+	for _, test := range tests {
+		expr := parse(t, test.in)[0].(*ast.ExpressionStatement).Expression
+		if out := FoldWith(expr, cfg).String(); out != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", out,
+			)
+		}
+		folded, err := FoldChecked(expr, cfg)
+		errStr := ""
+		if err != nil {
+			errStr = err.Error()
+		}
+		if folded.String() != test.out || errStr != test.err {
+			t.Error(
+				"For", test.in,
+				"expected", test.out, test.err,
+				"got", folded.String(), errStr,
+			)
+		}
+	}
+	in := "10000000 * 10000000 * 10000000;"
+	expr := parse(t, in)[0].(*ast.ExpressionStatement).Expression
+	if folded, err := FoldChecked(expr, Config{}); err != nil || folded.String() != "3875820019684212736" {
+		t.Error(
+			"For", in,
+			"expected", "3875820019684212736",
+			"got", folded, err,
+		)
+	}
+}
+
+func TestSimplifyControlFlow(t *testing.T) {
+	tests := []struct {
+		in  string
+		out []string
+	}{
+		{
+			"if 1 { a; } else { b; }",
+			[]string{"Block[ExpressionStatement[a]]"},
+		},
+		{
+			"if 0 { a; } else { b; }",
+			[]string{"Block[ExpressionStatement[b]]"},
+		},
+		{
+			"if 1 - 1 { a; } c;",
+			[]string{"ExpressionStatement[c]"},
+		},
+		{
+			"while 0 { a; } c;",
+			[]string{"ExpressionStatement[c]"},
+		},
+		{
+			"if 1 var a int;",
+			[]string{"Block[Declaration[a, 'int']]"},
+		},
+		{
+			"if 1 a; else b;",
+			[]string{"Block[ExpressionStatement[a]]"},
+		},
+		{
+			"if 0 a; else defer b;",
+			[]string{"Block[Defer[ExpressionStatement[b]]]"},
+		},
+		{
+			"while a { if 0 b; }",
+			[]string{"While[a, Block[]]"},
+		},
+	}
+	for _, test := range tests {
+		stmts := SimplifyControlFlow(parse(t, test.in))
+		if len(stmts) != len(test.out) {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", stmts,
+			)
+			continue
+		}
+		for i, stmt := range stmts {
+			if stmt.String() != test.out[i] {
+				t.Error(
+					"For", test.in,
+					"expected", test.out[i],
+					"got", stmt.String(),
+				)
+			}
+		}
+	}
+}
+
+func parse(t *testing.T, src string) []ast.Statement {
+	toks, err := lexer.Lex("test", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := parser.Parse(toks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stmts
+}
@@ -0,0 +1,56 @@
+package parser
+
+import "github.com/cmgn/compiler/ast"
+
+// arenaBlock is the number of nodes of each kind that an arena allocates at
+// once.
+const arenaBlock = 128
+
+// arena allocates the most common kinds of node in blocks rather than one at
+// a time, which saves a lot of allocations on large programs. A block is kept
+// alive for as long as any of its nodes are. A nil arena allocates each node
+// separately.
+type arena struct {
+	integers  []ast.Integer
+	variables []ast.Variable
+	binaries  []ast.BinaryOperator
+}
+
+// integer allocates an integer literal node.
+func (a *arena) integer() *ast.Integer {
+	if a == nil {
+		return &ast.Integer{}
+	}
+	if len(a.integers) == 0 {
+		a.integers = make([]ast.Integer, arenaBlock)
+	}
+	n := &a.integers[0]
+	a.integers = a.integers[1:]
+	return n
+}
+
+// variable allocates a variable node.
+func (a *arena) variable() *ast.Variable {
+	if a == nil {
+		return &ast.Variable{}
+	}
+	if len(a.variables) == 0 {
+		a.variables = make([]ast.Variable, arenaBlock)
+	}
+	n := &a.variables[0]
+	a.variables = a.variables[1:]
+	return n
+}
+
+// binary allocates a binary operator node.
+func (a *arena) binary() *ast.BinaryOperator {
+	if a == nil {
+		return &ast.BinaryOperator{}
+	}
+	if len(a.binaries) == 0 {
+		a.binaries = make([]ast.BinaryOperator, arenaBlock)
+	}
+	n := &a.binaries[0]
+	a.binaries = a.binaries[1:]
+	return n
+}
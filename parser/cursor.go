@@ -0,0 +1,47 @@
+package parser
+
+import "github.com/cmgn/compiler/token"
+
+// cursor walks through a slice of tokens, keeping the bounds checks needed to
+// look at the tokens around the current position in one place.
+type cursor struct {
+	toks []*token.Token
+	pos  int
+}
+
+// empty checks if every token has been consumed.
+func (c *cursor) empty() bool {
+	return c.pos >= len(c.toks)
+}
+
+// peek gets the token n places after the current one, so peek(0) is the
+// current token and peek(-1) the one before it. Looking past either end of
+// the tokens gives nil.
+func (c *cursor) peek(n int) *token.Token {
+	i := c.pos + n
+	if i < 0 || i >= len(c.toks) {
+		return nil
+	}
+	return c.toks[i]
+}
+
+// curr gets the current token, or nil if every token has been consumed.
+func (c *cursor) curr() *token.Token {
+	return c.peek(0)
+}
+
+// prev gets the most recently consumed token, or nil if none have been
+// consumed yet.
+func (c *cursor) prev() *token.Token {
+	return c.peek(-1)
+}
+
+// advance consumes the current token and returns it, or returns nil without
+// moving if every token has already been consumed.
+func (c *cursor) advance() *token.Token {
+	tok := c.curr()
+	if tok != nil {
+		c.pos++
+	}
+	return tok
+}
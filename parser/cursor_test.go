@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/cmgn/compiler/token"
+)
+
+func TestCursor(t *testing.T) {
+	c := &cursor{toks: toks(tok(token.TokIdentifier, "a"), tok(token.TokSemiColon, ";"))}
+	if prev := c.prev(); prev != nil {
+		t.Error(
+			"For", "prev at the start",
+			"expected", nil,
+			"got", prev,
+		)
+	}
+	if next := c.peek(1); next == nil || next.Type != token.TokSemiColon {
+		t.Error(
+			"For", "peek(1)",
+			"expected", "';'",
+			"got", next,
+		)
+	}
+	if beyond := c.peek(2); beyond != nil {
+		t.Error(
+			"For", "peek beyond the end",
+			"expected", nil,
+			"got", beyond,
+		)
+	}
+	c.advance()
+	c.advance()
+	if tok := c.advance(); tok != nil || !c.empty() || c.pos != 2 {
+		t.Error(
+			"For", "advance at the end",
+			"expected", "nil without moving",
+			"got", tok, c.pos,
+		)
+	}
+	if prev := c.prev(); prev == nil || prev.Type != token.TokSemiColon {
+		t.Error(
+			"For", "prev at the end",
+			"expected", "';'",
+			"got", prev,
+		)
+	}
+}
+
+func TestEndOfEmptyInput(t *testing.T) {
+	p := makeParser(nil)
+	if p.expect(token.TokSemiColon) || p.err == nil {
+		t.Error(
+			"For", "expect with no tokens",
+			"expected", "an error",
+			"got", p.err,
+		)
+	}
+}
@@ -0,0 +1,238 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/cmgn/compiler/ast"
+	"github.com/cmgn/compiler/lexer"
+)
+
+// formatSource is the program formatted by TestFormat. It is laid out
+// unevenly on purpose so that each style has to lay it out afresh.
+const formatSource = `// globals
+var a array(3) of int = {1, 2, 3};
+var p ptr to int = &a[0];
+
+
+var c char = '\n';
+if a[0] < 2 {
+a[1] = (a[0] + 1) * 2 - (3 - 1); // tidy
+} else if *p == 1 p = nil; else {
+	;
+}
+while c != '\0'
+	{ c = c - 1; } else printf "done %d\t\"%c\"\n", a[0] / (2 / 1), 'x';
+switch a[2] {
+case 1: defer printf "%%";
+default: { assert -(a[0] - 1) > -5; }
+}
+`
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		style ast.Style
+		out   string
+	}{
+		{
+			ast.DefaultStyle,
+			`// globals
+var a array(3) of int = {1, 2, 3};
+var p ptr to int = &a[0];
+
+var c char = '\n';
+if a[0] < 2 {
+	a[1] = (a[0] + 1) * 2 - (3 - 1); // tidy
+} else if *p == 1
+	p = nil;
+else {
+	;
+}
+while c != '\0' {
+	c = c - 1;
+} else
+	printf "done %d\t\"%c\"\n", a[0] / (2 / 1), 'x';
+switch a[2] {
+case 1:
+	defer printf "%%";
+default:
+	{
+		assert -(a[0] - 1) > -5;
+	}
+}`,
+		},
+		{
+			ast.Style{IndentWidth: 2, Braces: ast.BracesAllman},
+			`// globals
+var a array(3) of int = {1, 2, 3};
+var p ptr to int = &a[0];
+
+var c char = '\n';
+if a[0]<2
+{
+  a[1] = (a[0]+1)*2-(3-1); // tidy
+}
+else if *p==1
+  p = nil;
+else
+{
+  ;
+}
+while c!='\0'
+{
+  c = c-1;
+}
+else
+  printf "done %d\t\"%c\"\n", a[0]/(2/1), 'x';
+switch a[2]
+{
+case 1:
+  defer printf "%%";
+default:
+  {
+    assert -(a[0]-1)>-5;
+  }
+}`,
+		},
+	}
+	parse := func(in string) []ast.Statement {
+		lexCfg := lexer.DefaultConfig
+		lexCfg.Comments = true
+		tokens, err := lexer.LexWith("test", in, lexCfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := DefaultConfig
+		cfg.LoopElse = true
+		cfg.Trivia = true
+		result, err := ParseWith(tokens, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.Statements
+	}
+	stmts := parse(formatSource)
+	for _, test := range tests {
+		out := ast.Format(stmts, test.style)
+		if out != test.out {
+			t.Error(
+				"For", test.style,
+				"expected", test.out,
+				"got", out,
+			)
+			continue
+		}
+		reparsed := parse(out)
+		if len(reparsed) != len(stmts) {
+			t.Fatal(reparsed)
+		}
+		for i := range stmts {
+			if d := ast.Diff(stmts[i], reparsed[i]); d != "" {
+				t.Error(
+					"For", test.style,
+					"expected", stmts[i],
+					"got", reparsed[i], d,
+				)
+			}
+		}
+	}
+}
+
+// TestFormatRawString checks that raw strings are formatted as raw strings,
+// keeping their backslashes.
+func TestFormatRawString(t *testing.T) {
+	in := "printf `%d\\n`, 1; printf \"%d\\n\", 1;"
+	out := "printf `%d\\n`, 1;\nprintf \"%d\\n\", 1;"
+	tokens, err := lexer.Lex("test", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := Parse(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str := ast.FormatDefault(stmts); str != out {
+		t.Error(
+			"For", in,
+			"expected", out,
+			"got", str,
+		)
+	}
+}
+
+func TestFormatStatementExpression(t *testing.T) {
+	in := "if a { x = ({ var y int = 1; y = y + 1; y * 2 }) + 1; }"
+	out := "if a {\n\tx = ({\n\t\tvar y int = 1;\n\t\ty = y + 1;\n\t\ty * 2\n\t}) + 1;\n}"
+	tokens, err := lexer.Lex("test", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := Parse(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := ast.FormatDefault(stmts)
+	if str != out {
+		t.Error(
+			"For", in,
+			"expected", out,
+			"got", str,
+		)
+	}
+	tokens, err = lexer.Lex("test", str)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Parse(tokens)
+	if err != nil || len(again) != 1 || !ast.Equal(stmts[0], again[0]) {
+		t.Error(
+			"For", str,
+			"expected", stmts,
+			"got", again, err,
+		)
+	}
+}
+
+func TestFormatStruct(t *testing.T) {
+	tests := []string{
+		"var s struct { c char; n array(2) of int; };",
+		"var e struct {};",
+		"type node struct { value int; next ptr to node; };",
+	}
+	for _, in := range tests {
+		tokens, err := lexer.Lex("test", in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmts, err := Parse(tokens)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if str := ast.FormatDefault(stmts); str != in {
+			t.Error(
+				"For", in,
+				"expected", in,
+				"got", str,
+			)
+		}
+	}
+}
+
+func TestFormatBranches(t *testing.T) {
+	in := "outer: while a { while b continue outer; break; }"
+	out := "outer: while a {\n\twhile b\n\t\tcontinue outer;\n\tbreak;\n}"
+	tokens, err := lexer.Lex("test", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := Parse(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str := ast.FormatDefault(stmts); str != out {
+		t.Error(
+			"For", in,
+			"expected", out,
+			"got", str,
+		)
+	}
+}
@@ -0,0 +1,192 @@
+package parser
+
+import (
+	"reflect"
+
+	"github.com/cmgn/compiler/ast"
+	"github.com/cmgn/compiler/token"
+)
+
+// Edit describes a change to a source: the bytes from Start up to OldEnd in
+// the old source were replaced by the bytes from Start up to NewEnd in the new
+// source.
+type Edit struct {
+	Start  int
+	OldEnd int
+	NewEnd int
+}
+
+// Reparse parses newToks, the tokens of a source after an edit, reusing as
+// much as it can of prevStmts, which were parsed from prevToks, the tokens
+// before the edit. The tokens after the edit must be the same in both, as
+// they are when newToks comes from lexer.Relex.
+//
+// Only the top-level statements whose source the edit touches are parsed
+// again. The statements before them are reused as they are, and the
+// statements after them are copied with their positions moved to match
+// newToks. If the statements parsed again have errors, or the edit changes
+// where a statement ends, the whole of newToks is parsed instead. Either way
+// the result is the same as parsing newToks with ParseWithRecovery.
+func Reparse(prevStmts []ast.Statement, prevToks, newToks []*token.Token, edit Edit) ([]ast.Statement, []error) {
+	ends, ok := statementEnds(prevStmts, prevToks)
+	if !ok {
+		return ParseWithRecovery(newToks)
+	}
+	// Statement i takes up the bytes after the end of statement i-1 up to
+	// and including its own end, and the last runs to the end of the
+	// source, so an edit between two statements touches the one after it.
+	// An edit ending just before a statement might join its first token to
+	// the one before, so counts as touching it. Statements end with ';' or
+	// '}', which can't be joined to what follows them, so an edit starting
+	// just after a statement doesn't touch it.
+	first, last := -1, -1
+	for i := range prevStmts {
+		start := 0
+		if i > 0 {
+			start = prevToks[ends[i-1]].Source.Offset + 1
+		}
+		end := prevToks[ends[i]].Source.Offset + 1
+		if i == len(prevStmts)-1 {
+			end = edit.Start + 1
+		}
+		if edit.Start < end && edit.OldEnd >= start {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+		if edit.OldEnd < start {
+			break
+		}
+	}
+
+	from := 0
+	if first > 0 {
+		from = ends[first-1] + 1
+	}
+	to := len(prevToks)
+	if last < len(prevStmts)-1 {
+		to = ends[last] + 1
+	}
+	newTo, ok := matchSuffix(prevToks[to:], newToks, edit.NewEnd-edit.OldEnd)
+	if !ok || from > newTo || !samePrefix(prevToks[:from], newToks) {
+		return ParseWithRecovery(newToks)
+	}
+
+	parsed, errs := ParseWithRecovery(newToks[from:newTo])
+	if len(errs) > 0 {
+		return ParseWithRecovery(newToks)
+	}
+	stmts := make([]ast.Statement, 0, first+len(parsed)+len(prevStmts)-last-1)
+	stmts = append(stmts, prevStmts[:first]...)
+	stmts = append(stmts, parsed...)
+	moved := movedSources(prevToks[to:], newToks[newTo:])
+	for _, stmt := range prevStmts[last+1:] {
+		if moved != nil {
+			stmt = ast.Rewrite(stmt, func(node ast.Node) ast.Node {
+				moveSources(reflect.ValueOf(node).Elem(), moved)
+				return node
+			}).(ast.Statement)
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts, nil
+}
+
+// statementEnds finds the index in toks of the last token of each statement,
+// which is where its span ends.
+func statementEnds(stmts []ast.Statement, toks []*token.Token) ([]int, bool) {
+	ends := make([]int, len(stmts))
+	i := 0
+	for j, stmt := range stmts {
+		end := stmt.Span().End.Offset
+		for i < len(toks) && toks[i].Source.Offset < end {
+			i++
+		}
+		if i == len(toks) || toks[i].Source.Offset != end {
+			return nil, false
+		}
+		ends[j] = i
+		i++
+	}
+	return ends, len(stmts) > 0
+}
+
+// samePrefix checks that the tokens before an edit are unchanged at the start
+// of newToks.
+func samePrefix(prefix, newToks []*token.Token) bool {
+	if len(prefix) > len(newToks) {
+		return false
+	}
+	for i, tok := range prefix {
+		if !sameToken(tok, newToks[i], 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSuffix finds where the tokens after an edit, suffix, start in newToks,
+// checking that they are unchanged other than being moved by delta bytes.
+func matchSuffix(suffix, newToks []*token.Token, delta int) (int, bool) {
+	start := len(newToks) - len(suffix)
+	if start < 0 {
+		return 0, false
+	}
+	for i, tok := range suffix {
+		if !sameToken(tok, newToks[start+i], delta) {
+			return 0, false
+		}
+	}
+	return start, true
+}
+
+// sameToken checks if two tokens are the same, with the second moved by delta
+// bytes.
+func sameToken(a, b *token.Token, delta int) bool {
+	return a.Type == b.Type && a.Value == b.Value && a.Source.Offset+delta == b.Source.Offset
+}
+
+// movedSources maps the offset of each token after an edit to its new source
+// information, or gives nil if none of them have moved.
+func movedSources(prevToks, newToks []*token.Token) map[int]token.SourceInformation {
+	var moved map[int]token.SourceInformation
+	for i, tok := range prevToks {
+		if tok.Source == newToks[i].Source {
+			continue
+		}
+		if moved == nil {
+			moved = make(map[int]token.SourceInformation, len(prevToks))
+		}
+		moved[tok.Source.Offset] = newToks[i].Source
+	}
+	return moved
+}
+
+// sourceType is the type of the source information fields of nodes.
+var sourceType = reflect.TypeOf(token.SourceInformation{})
+
+// moveSources updates the source information held directly by a node, or a
+// part of one such as a switch case, that has been copied. Child nodes are
+// left alone, as ast.Rewrite visits them separately.
+func moveSources(v reflect.Value, moved map[int]token.SourceInformation) {
+	nodeType := reflect.TypeOf((*ast.Node)(nil)).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		switch {
+		case field.Type() == sourceType:
+			src := field.Interface().(token.SourceInformation)
+			if to, ok := moved[src.Offset]; ok {
+				field.Set(reflect.ValueOf(to))
+			}
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Ptr &&
+			!field.Type().Elem().Implements(nodeType):
+			for j := 0; j < field.Len(); j++ {
+				moveSources(field.Index(j).Elem(), moved)
+			}
+		}
+	}
+}
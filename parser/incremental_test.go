@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cmgn/compiler/ast"
+	"github.com/cmgn/compiler/lexer"
+)
+
+func TestReparse(t *testing.T) {
+	old := "var a int = 1;\nif a { a = 2; }\nwhile a < 3 a = a + 1;\nswitch a { case 1: ; default: a = 4; }\nassert a;"
+	tests := []struct {
+		name string
+		// old is replaced by replacement where it first appears.
+		old, replacement string
+		// reused is the number of statements at the start of the result
+		// that should be the same as before the edit.
+		reused int
+	}{
+		{"one statement", "a < 3", "a - 1 < 3", 2},
+		{"two statements", "a = 2; }\nwhile a", "b = 2; }\nwhile b", 1},
+		{"first statement", "1;", "10;", 0},
+		{"last statement", "assert a", "assert a + 1", 4},
+		{"new lines", "\nif", "\n\n\nif", 1},
+		{"between statements", "\nwhile", "\nvar b int; while", 2},
+		{"unbalanced", "2; }", "2;", 0},
+		{"joined to the statement before", "}\nwhile", "} else while", 0},
+	}
+	for _, test := range tests {
+		prevToks, err := lexer.Lex("test", old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev, err := Parse(prevToks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := strings.Index(old, test.old)
+		end := start + len(test.old)
+		src := old[:start] + test.replacement + old[end:]
+		newToks, err := lexer.Relex(prevToks, old, src, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edit := Edit{Start: start, OldEnd: end, NewEnd: start + len(test.replacement)}
+		stmts, errs := Reparse(prev, prevToks, newToks, edit)
+		full, fullErrs := ParseWithRecovery(newToks)
+		if len(stmts) != len(full) || len(errs) != len(fullErrs) {
+			t.Error(
+				"For", test.name,
+				"expected", full, fullErrs,
+				"got", stmts, errs,
+			)
+			continue
+		}
+		for i := range full {
+			if d := ast.Diff(full[i], stmts[i]); d != "" || full[i].Span() != stmts[i].Span() {
+				t.Error(
+					"For", test.name,
+					"expected", full[i], full[i].Span(),
+					"got", stmts[i], stmts[i].Span(), d,
+				)
+			}
+		}
+		for i := 0; i < test.reused && i < len(stmts); i++ {
+			if stmts[i] != prev[i] {
+				t.Error(
+					"For", test.name,
+					"expected", "statement", i, "to be reused",
+					"got", stmts[i],
+				)
+			}
+		}
+	}
+}
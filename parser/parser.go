@@ -4,105 +4,431 @@ package parser
 
 import (
 	"fmt"
-	"strconv"
+	"math"
 
 	"github.com/cmgn/compiler/ast"
+	"github.com/cmgn/compiler/diag"
 	"github.com/cmgn/compiler/token"
 )
 
+// Config holds the options that control how tokens are parsed.
+type Config struct {
+	// Recover makes the parser carry on after an invalid statement by
+	// skipping to the end of it, collecting every error encountered.
+	Recover bool
+	// MaxErrors stops a recovering parser once it has found this many
+	// errors. Zero means there is no limit.
+	MaxErrors int
+	// MaxDepth is the deepest that statements and expressions may be
+	// nested, so that deeply nested input can't exhaust the stack. Zero
+	// means there is no limit.
+	MaxDepth int
+	// LoopElse allows a while loop to be followed by an else, which runs
+	// once the loop's condition is false. Without it an else after a while
+	// loop belongs to an enclosing if statement.
+	LoopElse bool
+	// TrailingExpression allows the last statement to be an expression
+	// without a semicolon, as typed into a REPL.
+	TrailingExpression bool
+	// Trivia attaches the comments and blank lines around each statement in
+	// a list of statements as its trivia. Comments that don't come before a
+	// statement, such as those at the end of a block, are dropped.
+	Trivia bool
+}
+
+// DefaultConfig is the configuration used by Parse.
+var DefaultConfig = Config{}
+
+// Result holds the outcome of parsing a program.
+type Result struct {
+	// Statements holds the statements that were parsed. When recovering
+	// from errors, the invalid statements are left out.
+	Statements []ast.Statement
+	// Errors holds every error encountered, in the order they were found.
+	Errors []error
+}
+
 // Parse parses a slice of tokens into a syntax tree. If the input is invalid
 // then nil, error is returned.
 func Parse(tokens []*token.Token) ([]ast.Statement, error) {
-	parser := &parser{toks: tokens}
-	statements := make([]ast.Statement, 0)
-	for !parser.empty() {
-		stmt := parser.statement()
-		if stmt == nil {
-			break
-		}
-		statements = append(statements, stmt)
+	result, err := ParseWith(tokens, DefaultConfig)
+	if err != nil {
+		return nil, err
+	}
+	return result.Statements, nil
+}
+
+// ParseWith parses a slice of tokens in the same way as Parse, but using the
+// options given in cfg. The error returned is the first in the result, if
+// there are any.
+func ParseWith(tokens []*token.Token, cfg Config) (*Result, error) {
+	parser := newParser(tokens)
+	parser.config = cfg
+	statements := parser.program()
+	if parser.err != nil {
+		parser.errs = append(parser.errs, parser.err)
+	}
+	result := &Result{Statements: statements, Errors: parser.errs}
+	if len(result.Errors) > 0 {
+		return result, result.Errors[0]
+	}
+	return result, nil
+}
+
+// ParseWithRecovery parses a slice of tokens in the same way as Parse, but
+// carries on after an invalid statement by skipping to the end of it. It
+// returns the statements that could be parsed along with every error
+// encountered.
+func ParseWithRecovery(tokens []*token.Token) ([]ast.Statement, []error) {
+	cfg := DefaultConfig
+	cfg.Recover = true
+	result, _ := ParseWith(tokens, cfg)
+	return result.Statements, result.Errors
+}
+
+// ParseWithTrivia parses a slice of tokens in the same way as Parse, but
+// also attaches the trivia around each statement as described for
+// Config.Trivia.
+func ParseWithTrivia(tokens []*token.Token) ([]ast.Statement, error) {
+	cfg := DefaultConfig
+	cfg.Trivia = true
+	result, err := ParseWith(tokens, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return result.Statements, nil
+}
+
+// ParseExpression parses a slice of tokens into a single expression. It is an
+// error for any tokens to remain after the expression.
+func ParseExpression(tokens []*token.Token) (ast.Expression, error) {
+	parser := newParser(tokens)
+	if len(parser.toks) == 0 {
+		return nil, fmt.Errorf("unexpected end of input, expected expression")
+	}
+	expr := parser.expression()
+	if parser.err != nil {
+		return nil, parser.err
+	}
+	if !parser.empty() {
+		parser.unexpected(parser.curr())
+		return nil, parser.err
 	}
+	return expr, nil
+}
+
+// ParseType parses a slice of tokens into a single type. It is an error for
+// any tokens to remain after the type.
+func ParseType(tokens []*token.Token) (ast.Type, error) {
+	parser := newParser(tokens)
+	if len(parser.toks) == 0 {
+		return nil, fmt.Errorf("unexpected end of input, expected type")
+	}
+	typ := parser.typedecl()
 	if parser.err != nil {
 		return nil, parser.err
 	}
-	return statements, nil
+	if !parser.empty() {
+		parser.unexpected(parser.curr())
+		return nil, parser.err
+	}
+	return typ, nil
 }
 
 type parser struct {
-	toks []*token.Token
-	pos  int
-	err  error
+	cursor
+	err error
+	// config holds the options the parser was created with.
+	config Config
+	// errs holds the errors that have been recovered from.
+	errs []error
+	// depth is how deeply nested the statement or expression being parsed
+	// is.
+	depth int
+	// comments holds the comments that were removed from the tokens, keyed
+	// by the index of the token that follows them.
+	comments map[int][]*token.Token
+	// arena allocates the parser's nodes.
+	arena *arena
 }
 
-func (p *parser) empty() bool {
-	return p.pos >= len(p.toks)
+// newParser creates a parser for a slice of tokens, setting aside any
+// comments.
+func newParser(tokens []*token.Token) *parser {
+	p := &parser{
+		cursor:   cursor{toks: tokens},
+		comments: make(map[int][]*token.Token),
+		arena:    &arena{},
+	}
+	if !hasComments(tokens) {
+		return p
+	}
+	p.toks = make([]*token.Token, 0, len(tokens))
+	for _, tok := range tokens {
+		if tok.Type == token.TokComment {
+			p.comments[len(p.toks)] = append(p.comments[len(p.toks)], tok)
+			continue
+		}
+		p.toks = append(p.toks, tok)
+	}
+	return p
 }
 
-func (p *parser) curr() *token.Token {
-	if p.empty() {
-		return nil
+// hasComments checks if there are any comments in a slice of tokens.
+func hasComments(tokens []*token.Token) bool {
+	for _, tok := range tokens {
+		if tok.Type == token.TokComment {
+			return true
+		}
+	}
+	return false
+}
+
+// attachTrivia attaches trivia to a statement in a list of statements that
+// began at start, if the parser is recording it. The comments before the
+// statement are leading comments, unless they were taken by the statement
+// before as its trailing comment.
+func (p *parser) attachTrivia(stmt ast.Statement, start int) {
+	holder, ok := stmt.(ast.HasTrivia)
+	if !p.config.Trivia || !ok {
+		return
 	}
-	return p.toks[p.pos]
+	trivia := &ast.Trivia{}
+	prevLine := 0
+	if start > 0 {
+		prevLine = p.toks[start-1].Source.Line
+	}
+	firstLine := p.toks[start].Source.Line
+	for _, comment := range p.comments[start] {
+		trivia.Leading = append(trivia.Leading, comment.Value)
+	}
+	if len(trivia.Leading) > 0 {
+		firstLine = p.comments[start][0].Source.Line
+	}
+	if firstLine-prevLine > 1 {
+		trivia.BlankLines = firstLine - prevLine - 1
+	}
+	after := p.comments[p.pos]
+	if len(after) > 0 && after[0].Source.Line == p.prev().Source.Line {
+		trivia.Trailing = after[0].Value
+		p.comments[p.pos] = after[1:]
+	}
+	holder.SetTrivia(trivia)
 }
 
 func (p *parser) expect(typ token.Type) bool {
 	curr := p.curr()
 	if curr == nil {
-		curr = p.toks[p.pos-1]
-		p.err = fmt.Errorf("[%s] unexpected end of input after %s, expected %s",
-			curr.Source.String(), curr.String(), typ.String())
+		p.endError(", expected " + typ.String())
 		return false
 	}
 	if curr.Type != typ {
-		p.err = fmt.Errorf("[%s] expected %s, got %s",
-			curr.Source.String(), typ.String(), curr.String())
+		p.err = diag.Errorf(curr.Source, "expected %s, got %s",
+			typ.String(), curr.String())
+		return false
+	}
+	p.advance()
+	return true
+}
+
+// expectSemiColon consumes the ';' that ends a statement. When recovering
+// from errors, a missing ';' is recorded, with a fix that inserts it, and
+// parsing carries on as though it were there, so long as the next token
+// clearly starts something else: a new line, a statement keyword or the end
+// of the enclosing block.
+func (p *parser) expectSemiColon() bool {
+	curr := p.curr()
+	if !p.config.Recover || curr != nil && curr.Type == token.TokSemiColon {
+		return p.expect(token.TokSemiColon)
+	}
+	prev := p.prev()
+	if curr != nil && curr.Type != token.TokRightCurly &&
+		!statementOnly[curr.Type] && curr.Source.Line == prev.Source.Line {
+		return p.expect(token.TokSemiColon)
+	}
+	end := token.EndOf(prev)
+	p.errs = append(p.errs, &diag.Error{
+		Source:  end,
+		End:     end,
+		Message: "missing ';'",
+		Fix:     ";",
+	})
+	return true
+}
+
+// closingBrackets maps each opening bracket type to its closing bracket type.
+var closingBrackets = map[token.Type]token.Type{
+	token.TokLeftBracket: token.TokRightBracket,
+	token.TokLeftCurly:   token.TokRightCurly,
+	token.TokLeftSquare:  token.TokRightSquare,
+}
+
+// isClosingBracket checks if a token type is any kind of closing bracket.
+func isClosingBracket(typ token.Type) bool {
+	return typ == token.TokRightBracket ||
+		typ == token.TokRightCurly ||
+		typ == token.TokRightSquare
+}
+
+// expectClosing expects the closing bracket matching the opening bracket
+// open. If a closing bracket of a different kind is found instead then the
+// error refers back to where open occurred.
+func (p *parser) expectClosing(open *token.Token) bool {
+	curr := p.curr()
+	want := closingBrackets[open.Type]
+	if curr != nil && curr.Type != want && isClosingBracket(curr.Type) {
+		p.err = diag.Errorf(curr.Source, "unmatched %s opened at line %d, found %s at line %d",
+			open.String(), open.Source.Line, curr.String(), curr.Source.Line)
+		return false
+	}
+	if !p.expect(want) {
+		// The error covers everything from the opening bracket, which
+		// may be several lines before where its closing bracket was
+		// expected.
+		if err, ok := p.err.(*diag.Error); ok && open.Source.Offset < err.Source.Offset {
+			err.Source = open.Source
+		}
 		return false
 	}
-	p.pos++
 	return true
 }
 
 func (p *parser) unexpected(curr *token.Token) {
-	p.err = fmt.Errorf("[%s] unexpected %s", curr.Source.String(), curr.String())
+	p.err = diag.Errorf(curr.Source, "unexpected %s", curr.String())
 }
 
 func (p *parser) unexpectedEnd() bool {
 	if p.empty() {
-		prev := p.toks[p.pos-1]
-		p.err = fmt.Errorf("[%s] unexpected end of input after %s", prev.Source.String(), prev.String())
+		p.endError("")
 		return true
 	}
 	return false
 }
 
-func (p *parser) next() *token.Token {
-	p.pos++
-	if p.empty() {
+// endError reports that the input ended too soon, referring to the last token
+// if there was one. The detail is appended to the message.
+func (p *parser) endError(detail string) {
+	prev := p.prev()
+	if prev == nil {
+		p.err = fmt.Errorf("unexpected end of input%s", detail)
+		return
+	}
+	p.err = diag.Errorf(prev.Source, "unexpected end of input after %s%s",
+		prev.String(), detail)
+}
+
+// synchronize records the current error and skips the rest of the invalid
+// statement that began at start, stopping just after the next ';' or just
+// before the next '}'. If the statement couldn't even begin then only its
+// first token is skipped. There is no current error if the statement was
+// abandoned because a block inside it reached MaxErrors.
+func (p *parser) synchronize(start int) {
+	if p.err != nil {
+		p.errs = append(p.errs, p.err)
+		p.err = nil
+	}
+	if p.pos == start {
+		p.advance()
+		return
+	}
+	for !p.empty() {
+		switch p.curr().Type {
+		case token.TokSemiColon:
+			p.advance()
+			return
+		case token.TokRightCurly:
+			return
+		}
+		p.advance()
+	}
+}
+
+// program
+// | {statement}
+func (p *parser) program() []ast.Statement {
+	statements := make([]ast.Statement, 0)
+	for !p.empty() {
+		start := p.pos
+		stmt := p.progressed(start, p.statement())
+		if stmt == nil {
+			if !p.config.Recover {
+				break
+			}
+			p.synchronize(start)
+			if p.tooManyErrors() {
+				break
+			}
+			continue
+		}
+		p.attachTrivia(stmt, start)
+		statements = append(statements, stmt)
+	}
+	return statements
+}
+
+// tooManyErrors checks if a recovering parser has found as many errors as
+// MaxErrors allows, and so should stop.
+func (p *parser) tooManyErrors() bool {
+	return p.config.MaxErrors > 0 && len(p.errs) >= p.config.MaxErrors
+}
+
+// enter notes that the parser is entering a nested statement or expression,
+// returning false with an error set if that nests too deeply. Each successful
+// call must be matched by a call to leave.
+func (p *parser) enter() bool {
+	if p.config.MaxDepth > 0 && p.depth >= p.config.MaxDepth {
+		at := p.curr()
+		if at == nil {
+			at = p.prev()
+		}
+		p.err = diag.Errorf(at.Source, "nesting is deeper than %d levels", p.config.MaxDepth)
+		return false
+	}
+	p.depth++
+	return true
+}
+
+// leave notes that the parser has finished a nested statement or expression.
+func (p *parser) leave() {
+	p.depth--
+}
+
+// progressed checks that parsing a statement which began at start consumed
+// at least one token, so that the loops parsing sequences of statements can't
+// spin forever on a production that matches nothing. It returns nil with an
+// error set if no progress was made.
+func (p *parser) progressed(start int, stmt ast.Statement) ast.Statement {
+	if stmt != nil && p.pos == start {
+		p.err = diag.Errorf(p.curr().Source, "internal error: %s parsed without consuming any input",
+			stmt.String())
 		return nil
 	}
-	return p.curr()
+	return stmt
 }
 
 // statement
 // | expression '=' expression ';'
 // | expression ';'
-// | 'var' identifier typedecl ';'
+// | 'var' identifier typedecl ['=' initializer] ';'
 // | 'if' expression statement ['else' statement]
 // | 'while' expression statement
+// | 'assert' expression ';'
+// | switch
 // | block
 // | ';'
 func (p *parser) statement() ast.Statement {
-	if p.unexpectedEnd() {
+	if p.unexpectedEnd() || !p.enter() {
 		return nil
 	}
+	defer p.leave()
 
 	curr := p.curr()
 	switch curr.Type {
 	case token.TokSemiColon:
-		p.pos++
+		p.advance()
 		return &ast.Empty{Source: curr.Source}
 	case token.TokVar:
-		p.pos++
+		p.advance()
 		name := p.curr()
 		if !p.expect(token.TokIdentifier) {
 			return nil
@@ -111,46 +437,44 @@ func (p *parser) statement() ast.Statement {
 		if typ == nil {
 			return nil
 		}
-		if !p.expect(token.TokSemiColon) {
+		var value ast.Expression
+		if !p.empty() && p.curr().Type == token.TokAssign {
+			p.expect(token.TokAssign)
+			if value = p.initializer(); value == nil {
+				return nil
+			}
+		}
+		if !p.expectSemiColon() {
 			return nil
 		}
 		return &ast.Declaration{
 			Source: curr.Source,
+			End:    p.prev().Source,
 			Name:   name.Value,
 			Type:   typ,
+			Value:  value,
 		}
-	case token.TokIf:
-		p.expect(token.TokIf)
-		cond := p.expression()
-		if cond == nil {
-			return nil
-		}
-		stmt1 := p.statement()
-		if stmt1 == nil {
+	case token.TokType:
+		p.advance()
+		name := p.curr()
+		if !p.expect(token.TokIdentifier) {
 			return nil
 		}
-		if p.empty() || p.curr().Type != token.TokElse {
-			return &ast.IfStatement{
-				Source:     curr.Source,
-				Condition:  cond,
-				Statement1: stmt1,
-				Statement2: &ast.Empty{},
-			}
-		}
-		p.expect(token.TokElse)
-		stmt2 := p.statement()
-		if stmt2 == nil {
+		typ := p.typedecl()
+		if typ == nil || !p.expectSemiColon() {
 			return nil
 		}
-		return &ast.IfStatement{
-			Source:     curr.Source,
-			Condition:  cond,
-			Statement1: stmt1,
-			Statement2: stmt2,
+		return &ast.TypeDeclaration{
+			Source: curr.Source,
+			End:    p.prev().Source,
+			Name:   name.Value,
+			Type:   typ,
 		}
+	case token.TokIf:
+		return p.ifStatement()
 	case token.TokWhile:
 		p.expect(token.TokWhile)
-		cond := p.expression()
+		cond := p.condition()
 		if cond == nil {
 			return nil
 		}
@@ -158,17 +482,91 @@ func (p *parser) statement() ast.Statement {
 		if stmt == nil {
 			return nil
 		}
-		return &ast.WhileStatement{
+		loop := &ast.WhileStatement{
+			Source:    curr.Source,
+			End:       stmt.Span().End,
+			Condition: cond,
+			Statement: stmt,
+		}
+		if p.config.LoopElse && !p.empty() && p.curr().Type == token.TokElse {
+			p.advance()
+			loop.Else = p.statement()
+			if loop.Else == nil {
+				return nil
+			}
+			loop.End = loop.Else.Span().End
+		}
+		return loop
+	case token.TokAssert:
+		p.expect(token.TokAssert)
+		cond := p.condition()
+		if cond == nil || !p.expectSemiColon() {
+			return nil
+		}
+		return &ast.AssertStatement{
 			Source:    curr.Source,
+			End:       p.prev().Source,
 			Condition: cond,
+		}
+	case token.TokPrintf:
+		return p.printfStatement()
+	case token.TokDefer:
+		p.expect(token.TokDefer)
+		stmt := p.statement()
+		if stmt == nil {
+			return nil
+		}
+		return &ast.DeferStatement{
+			Source:    curr.Source,
 			Statement: stmt,
 		}
+	case token.TokSwitch:
+		return p.switchStatement()
 	case token.TokLeftCurly:
 		return p.block()
+	case token.TokBreak, token.TokContinue:
+		return p.branchStatement()
+	case token.TokIdentifier:
+		if p.atLabel() {
+			return p.labeledStatement()
+		}
 	}
 
 	expr := p.expression()
-	if expr == nil || p.unexpectedEnd() {
+	if expr == nil {
+		return nil
+	}
+	if p.empty() && p.config.TrailingExpression {
+		return &ast.ExpressionStatement{
+			End:        p.prev().Source,
+			Expression: expr,
+		}
+	}
+	return p.simpleStatement(expr)
+}
+
+// condition parses the condition of an if, while or assert statement. A
+// condition that stops at an '=', with or without brackets around it, is
+// almost certainly a mistyped '==', since there is no assignment expression,
+// so that is reported along with a fix that completes the '=='.
+func (p *parser) condition() ast.Expression {
+	cond := p.expression()
+	if curr := p.curr(); curr != nil && curr.Type == token.TokAssign {
+		p.err = &diag.Error{
+			Source:  curr.Source,
+			End:     curr.Source,
+			Message: "assignment in condition, did you mean '=='?",
+			Fix:     "=",
+		}
+		return nil
+	}
+	return cond
+}
+
+// simpleStatement parses the rest of a statement that starts with an
+// expression, which is either an assignment to it or the expression alone.
+func (p *parser) simpleStatement(expr ast.Expression) ast.Statement {
+	if p.unexpectedEnd() {
 		return nil
 	}
 
@@ -179,23 +577,175 @@ func (p *parser) statement() ast.Statement {
 		if right == nil {
 			return nil
 		}
-		if !p.expect(token.TokSemiColon) {
+		if !p.expectSemiColon() {
 			return nil
 		}
 		return &ast.Assignment{
 			Left:   expr,
 			Right:  right,
 			Source: middle.Source,
+			End:    p.prev().Source,
 		}
 	}
-	if p.expect(token.TokSemiColon) {
+	if p.expectSemiColon() {
 		return &ast.ExpressionStatement{
+			End:        p.prev().Source,
 			Expression: expr,
 		}
 	}
 	return nil
 }
 
+// ifStatement
+// | 'if' expression statement ['else' statement | elif]
+//
+// elif
+// | 'elif' expression statement ['else' statement | elif]
+//
+// An elif is parsed as though it were 'else if', so the two give the same
+// tree.
+func (p *parser) ifStatement() ast.Statement {
+	curr := p.curr()
+	p.advance()
+	cond := p.condition()
+	if cond == nil {
+		return nil
+	}
+	stmt1 := p.statement()
+	if stmt1 == nil {
+		return nil
+	}
+	var stmt2 ast.Statement
+	switch next := p.curr(); {
+	case next != nil && next.Type == token.TokElse:
+		p.advance()
+		stmt2 = p.statement()
+	case next != nil && next.Type == token.TokElif:
+		// Each elif is nested in the one before it, so a long chain
+		// is as deep as the same number of nested blocks.
+		if !p.enter() {
+			return nil
+		}
+		stmt2 = p.ifStatement()
+		p.leave()
+	default:
+		return &ast.IfStatement{
+			Source:     curr.Source,
+			End:        stmt1.Span().End,
+			Condition:  cond,
+			Statement1: stmt1,
+			Statement2: &ast.Empty{},
+		}
+	}
+	if stmt2 == nil {
+		return nil
+	}
+	return &ast.IfStatement{
+		Source:     curr.Source,
+		End:        stmt2.Span().End,
+		Condition:  cond,
+		Statement1: stmt1,
+		Statement2: stmt2,
+	}
+}
+
+// atLabel checks if the parser is at the label of a labeled statement, an
+// identifier followed by a ':'.
+func (p *parser) atLabel() bool {
+	curr, next := p.curr(), p.peek(1)
+	return curr != nil && curr.Type == token.TokIdentifier &&
+		next != nil && next.Type == token.TokColon
+}
+
+// labeledStatement
+// | identifier ':' statement
+func (p *parser) labeledStatement() ast.Statement {
+	label := p.curr()
+	p.advance()
+	p.advance()
+	stmt := p.statement()
+	if stmt == nil {
+		return nil
+	}
+	return &ast.LabeledStatement{
+		Source:    label.Source,
+		Label:     label.Value,
+		Statement: stmt,
+	}
+}
+
+// branchStatement
+// | 'break' [identifier] ';'
+// | 'continue' [identifier] ';'
+func (p *parser) branchStatement() ast.Statement {
+	keyword := p.curr()
+	p.advance()
+	var label string
+	if curr := p.curr(); curr != nil && curr.Type == token.TokIdentifier {
+		label = curr.Value
+		p.advance()
+	}
+	if !p.expectSemiColon() {
+		return nil
+	}
+	if keyword.Type == token.TokContinue {
+		return &ast.ContinueStatement{
+			Source: keyword.Source,
+			End:    p.prev().Source,
+			Label:  label,
+		}
+	}
+	return &ast.BreakStatement{
+		Source: keyword.Source,
+		End:    p.prev().Source,
+		Label:  label,
+	}
+}
+
+// printfStatement
+// | 'printf' string {',' expression} ';'
+func (p *parser) printfStatement() ast.Statement {
+	curr := p.curr()
+	if !p.expect(token.TokPrintf) {
+		return nil
+	}
+	format := p.stringLiteral()
+	if format == nil {
+		return nil
+	}
+	var args []ast.Expression
+	for !p.empty() && p.curr().Type == token.TokComma {
+		p.advance()
+		arg := p.expression()
+		if arg == nil {
+			return nil
+		}
+		args = append(args, arg)
+	}
+	if !p.expectSemiColon() {
+		return nil
+	}
+	return &ast.PrintfStatement{
+		Source:    curr.Source,
+		End:       p.prev().Source,
+		Format:    format,
+		Arguments: args,
+	}
+}
+
+// stringLiteral parses a string literal, which may be raw.
+func (p *parser) stringLiteral() *ast.StringLiteral {
+	curr := p.curr()
+	if curr != nil && curr.Type == token.TokRawString {
+		p.advance()
+		return &ast.StringLiteral{Source: curr.Source, Value: curr.Value, Raw: true, Length: curr.Length}
+	}
+	if !p.expect(token.TokString) {
+		return nil
+	}
+	return &ast.StringLiteral{Source: curr.Source, Value: curr.Value, Length: curr.Length}
+}
+
 // block
 // | '{' {statement} '}'
 func (p *parser) block() ast.Statement {
@@ -204,31 +754,123 @@ func (p *parser) block() ast.Statement {
 		return nil
 	}
 	statements := make([]ast.Statement, 0)
-	for !p.empty() && p.curr().Type != token.TokRightCurly {
-		stmt := p.statement()
+	for !p.empty() && !isClosingBracket(p.curr().Type) {
+		start := p.pos
+		stmt := p.progressed(start, p.statement())
 		if stmt == nil {
-			return nil
+			if !p.config.Recover {
+				return nil
+			}
+			p.synchronize(start)
+			if p.tooManyErrors() {
+				return nil
+			}
+			continue
 		}
+		p.attachTrivia(stmt, start)
 		statements = append(statements, stmt)
 	}
-	if !p.expect(token.TokRightCurly) {
+	if !p.expectClosing(curr) {
 		return nil
 	}
 	return &ast.BlockStatement{
 		Source:     curr.Source,
+		End:        p.prev().Source,
 		Statements: statements,
 	}
 }
 
+// switch
+// | 'switch' expression '{' {case} '}'
+//
+// case
+// | 'case' expression ':' {statement}
+// | 'default' ':' {statement}
+func (p *parser) switchStatement() ast.Statement {
+	curr := p.curr()
+	if !p.expect(token.TokSwitch) {
+		return nil
+	}
+	value := p.expression()
+	if value == nil {
+		return nil
+	}
+	open := p.curr()
+	if !p.expect(token.TokLeftCurly) {
+		return nil
+	}
+	cases := make([]*ast.SwitchCase, 0)
+	var def *token.Token
+	for !p.empty() && !isClosingBracket(p.curr().Type) {
+		start := p.curr()
+		var caseValue ast.Expression
+		switch start.Type {
+		case token.TokCase:
+			p.expect(token.TokCase)
+			if caseValue = p.expression(); caseValue == nil {
+				return nil
+			}
+		case token.TokDefault:
+			if def != nil {
+				p.err = diag.Errorf(start.Source, "multiple defaults in switch, first at %s",
+					def.Source.String())
+				return nil
+			}
+			def = start
+			p.expect(token.TokDefault)
+		default:
+			p.err = diag.Errorf(start.Source, "expected %s or %s, got %s",
+				token.TokCase.String(), token.TokDefault.String(), start.String())
+			return nil
+		}
+		if !p.expect(token.TokColon) {
+			return nil
+		}
+		stmts := make([]ast.Statement, 0)
+		for !p.empty() && !isCaseEnd(p.curr().Type) {
+			start := p.pos
+			stmt := p.progressed(start, p.statement())
+			if stmt == nil {
+				return nil
+			}
+			p.attachTrivia(stmt, start)
+			stmts = append(stmts, stmt)
+		}
+		cases = append(cases, &ast.SwitchCase{
+			Source:     start.Source,
+			Value:      caseValue,
+			Statements: stmts,
+		})
+	}
+	if !p.expectClosing(open) {
+		return nil
+	}
+	return &ast.SwitchStatement{
+		Source: curr.Source,
+		End:    p.prev().Source,
+		Value:  value,
+		Cases:  cases,
+	}
+}
+
+// isCaseEnd checks if a token type ends the statements of a switch case.
+func isCaseEnd(typ token.Type) bool {
+	return typ == token.TokCase || typ == token.TokDefault || isClosingBracket(typ)
+}
+
 // typedecl
 // | 'int'
 // | 'char'
-// | 'array' '(' integer ')' 'of' typedecl
+// | 'array' ['(' signedInteger ')'] 'of' typedecl
+// | 'ptr' 'to' typedecl
+// | 'func' '(' [typedecl {',' typedecl} [',']] ')' [typedecl]
 // | '(' typedecl ')'
+// | identifier
 func (p *parser) typedecl() ast.Type {
-	if p.unexpectedEnd() {
+	if p.unexpectedEnd() || !p.enter() {
 		return nil
 	}
+	defer p.leave()
 	curr := p.curr()
 	switch curr.Type {
 	case token.TokLeftBracket:
@@ -255,15 +897,14 @@ func (p *parser) typedecl() ast.Type {
 		}
 	case token.TokArray:
 		p.expect(token.TokArray)
-		if !p.expect(token.TokLeftBracket) {
-			return nil
-		}
-		size := p.curr()
-		if !p.expect(token.TokInteger) {
-			return nil
-		}
-		if !p.expect(token.TokRightBracket) {
-			return nil
+		length := ast.UnknownLength
+		if !p.empty() && p.curr().Type == token.TokLeftBracket {
+			p.expect(token.TokLeftBracket)
+			size, ok := p.arraySize()
+			if !ok || !p.expect(token.TokRightBracket) {
+				return nil
+			}
+			length = size
 		}
 		if !p.expect(token.TokOf) {
 			return nil
@@ -272,14 +913,9 @@ func (p *parser) typedecl() ast.Type {
 		if typ == nil {
 			return nil
 		}
-		sizeInt, err := strconv.Atoi(size.Value)
-		if err != nil {
-			p.err = fmt.Errorf("[%s] invalid static array size '%s'",
-				size.Source.String(), size.Value)
-		}
 		return &ast.ArrayType{
 			Type:   typ,
-			Length: sizeInt,
+			Length: length,
 			Source: curr.Source,
 		}
 	case token.TokPtr:
@@ -295,14 +931,157 @@ func (p *parser) typedecl() ast.Type {
 			Source: curr.Source,
 			Type:   typ,
 		}
+	case token.TokFunc:
+		return p.functionType()
+	case token.TokStruct:
+		return p.structType()
+	case token.TokIdentifier:
+		p.advance()
+		return &ast.NamedType{
+			Source: curr.Source,
+			Name:   curr.Value,
+		}
 	}
 	p.unexpected(curr)
 	return nil
 }
 
+// functionType
+// | 'func' '(' [typedecl {',' typedecl} [',']] ')' [typedecl]
+func (p *parser) functionType() ast.Type {
+	curr := p.curr()
+	if !p.expect(token.TokFunc) {
+		return nil
+	}
+	open := p.curr()
+	if !p.expect(token.TokLeftBracket) {
+		return nil
+	}
+	params := make([]ast.Type, 0)
+	ok := p.parseCommaList(token.TokRightBracket, func() bool {
+		param := p.typedecl()
+		params = append(params, param)
+		return param != nil
+	})
+	if !ok || !p.expectClosing(open) {
+		return nil
+	}
+	fn := &ast.FunctionType{
+		Source:     curr.Source,
+		End:        p.prev().Source,
+		Parameters: params,
+	}
+	if !p.empty() && typeStarts[p.curr().Type] {
+		if fn.Return = p.typedecl(); fn.Return == nil {
+			return nil
+		}
+	}
+	return fn
+}
+
+// structType
+// | 'struct' '{' {identifier typedecl ';'} '}'
+func (p *parser) structType() ast.Type {
+	curr := p.curr()
+	if !p.expect(token.TokStruct) {
+		return nil
+	}
+	open := p.curr()
+	if !p.expect(token.TokLeftCurly) {
+		return nil
+	}
+	fields := make([]*ast.StructField, 0)
+	for !p.empty() && p.curr().Type != token.TokRightCurly {
+		name := p.curr()
+		if !p.expect(token.TokIdentifier) {
+			return nil
+		}
+		typ := p.typedecl()
+		if typ == nil || !p.expect(token.TokSemiColon) {
+			return nil
+		}
+		fields = append(fields, &ast.StructField{
+			Source: name.Source,
+			Name:   name.Value,
+			Type:   typ,
+		})
+	}
+	if !p.expectClosing(open) {
+		return nil
+	}
+	return &ast.StructType{
+		Source: curr.Source,
+		End:    p.prev().Source,
+		Fields: fields,
+	}
+}
+
+// typeStarts contains the token types that can begin a type.
+var typeStarts = map[token.Type]bool{
+	token.TokInt:         true,
+	token.TokChar:        true,
+	token.TokArray:       true,
+	token.TokPtr:         true,
+	token.TokFunc:        true,
+	token.TokStruct:      true,
+	token.TokLeftBracket: true,
+	token.TokIdentifier:  true,
+}
+
+// parseCommaList parses a list of elements separated by commas, stopping
+// before a token of the closing type. The list may be empty, and may end with
+// a comma. Each element is parsed by calling element, which gives false if it
+// fails. A comma where an element should be, at the start of the list or after
+// another comma, is left for element to report.
+func (p *parser) parseCommaList(closing token.Type, element func() bool) bool {
+	for !p.empty() && p.curr().Type != closing {
+		if !element() {
+			return false
+		}
+		if p.empty() || p.curr().Type != token.TokComma {
+			break
+		}
+		p.advance()
+	}
+	return true
+}
+
+// initializer
+// | '{' [initializer {',' initializer} [',']] '}'
+// | expression
+func (p *parser) initializer() ast.Expression {
+	if p.empty() || p.curr().Type != token.TokLeftCurly {
+		return p.expression()
+	}
+	if !p.enter() {
+		return nil
+	}
+	defer p.leave()
+	open := p.curr()
+	p.advance()
+	elements := make([]ast.Expression, 0)
+	ok := p.parseCommaList(token.TokRightCurly, func() bool {
+		elem := p.initializer()
+		elements = append(elements, elem)
+		return elem != nil
+	})
+	if !ok || !p.expectClosing(open) {
+		return nil
+	}
+	return &ast.ArrayLiteral{
+		Source:   open.Source,
+		End:      p.prev().Source,
+		Elements: elements,
+	}
+}
+
 // expression
 // | equality
 func (p *parser) expression() ast.Expression {
+	if !p.enter() {
+		return nil
+	}
+	defer p.leave()
 	return p.equality()
 }
 
@@ -325,22 +1104,14 @@ loop:
 			if right == nil {
 				return nil
 			}
-			left = &ast.BinaryOperator{
-				Type:  ast.BinaryEqual,
-				Left:  left,
-				Right: right,
-			}
+			left = p.binary(ast.BinaryEqual, curr, left, right)
 		case token.TokNotEqual:
 			p.expect(token.TokNotEqual)
 			right := p.comparison()
 			if right == nil {
 				return nil
 			}
-			left = &ast.BinaryOperator{
-				Type:  ast.BinaryNotEqual,
-				Left:  left,
-				Right: right,
-			}
+			left = p.binary(ast.BinaryNotEqual, curr, left, right)
 		default:
 			break loop
 		}
@@ -367,26 +1138,28 @@ func (p *parser) comparison() ast.Expression {
 		if right == nil {
 			return nil
 		}
-		return &ast.BinaryOperator{
-			Type:  ast.BinaryLessThan,
-			Left:  left,
-			Right: right,
-		}
+		return p.binary(ast.BinaryLessThan, curr, left, right)
 	case token.TokGreaterThan:
 		p.expect(token.TokGreaterThan)
 		right := p.summation()
 		if right == nil {
 			return nil
 		}
-		return &ast.BinaryOperator{
-			Type:  ast.BinaryGreaterThan,
-			Left:  left,
-			Right: right,
-		}
+		return p.binary(ast.BinaryGreaterThan, curr, left, right)
 	}
 	return left
 }
 
+// binary creates a binary operator node for the operator token op.
+func (p *parser) binary(typ ast.BinaryOperatorType, op *token.Token, left, right ast.Expression) *ast.BinaryOperator {
+	n := p.arena.binary()
+	n.Source = op.Source
+	n.Type = typ
+	n.Left = left
+	n.Right = right
+	return n
+}
+
 // summation
 // | summation '+' product
 // | summation '-' product
@@ -406,22 +1179,14 @@ loop:
 			if right == nil {
 				return nil
 			}
-			prod = &ast.BinaryOperator{
-				Type:  ast.BinaryAdd,
-				Left:  prod,
-				Right: right,
-			}
+			prod = p.binary(ast.BinaryAdd, curr, prod, right)
 		case token.TokDash:
 			p.expect(token.TokDash)
 			right := p.product()
 			if right == nil {
 				return nil
 			}
-			prod = &ast.BinaryOperator{
-				Type:  ast.BinarySub,
-				Left:  prod,
-				Right: right,
-			}
+			prod = p.binary(ast.BinarySub, curr, prod, right)
 		default:
 			break loop
 		}
@@ -430,11 +1195,11 @@ loop:
 }
 
 // product
-// | product '*' subscript
-// | product '/' subscript
-// | subscript
+// | product '*' unary
+// | product '/' unary
+// | unary
 func (p *parser) product() ast.Expression {
-	term := p.subscript()
+	term := p.unary()
 	if term == nil {
 		return nil
 	}
@@ -444,26 +1209,18 @@ loop:
 		switch curr.Type {
 		case token.TokStar:
 			p.expect(token.TokStar)
-			right := p.subscript()
+			right := p.unary()
 			if right == nil {
 				return nil
 			}
-			term = &ast.BinaryOperator{
-				Type:  ast.BinaryMul,
-				Left:  term,
-				Right: right,
-			}
+			term = p.binary(ast.BinaryMul, curr, term, right)
 		case token.TokFwdSlash:
 			p.expect(token.TokFwdSlash)
-			right := p.subscript()
+			right := p.unary()
 			if right == nil {
 				return nil
 			}
-			term = &ast.BinaryOperator{
-				Type:  ast.BinaryDiv,
-				Left:  term,
-				Right: right,
-			}
+			term = p.binary(ast.BinaryDiv, curr, term, right)
 		default:
 			break loop
 		}
@@ -471,29 +1228,156 @@ loop:
 	return term
 }
 
-// subscript
-// | subscript '[' expression ']'
+// unary
+// | '-' unary
+// | '*' unary
+// | '&' unary
+// | postfix
+func (p *parser) unary() ast.Expression {
+	if p.unexpectedEnd() {
+		return nil
+	}
+	var typ ast.UnaryOperatorType
+	switch p.curr().Type {
+	case token.TokStar:
+		typ = ast.UnaryDereference
+	case token.TokDash:
+		if next := p.peek(1); next != nil && next.Type == token.TokInteger {
+			return p.signedInteger()
+		}
+		typ = ast.UnaryMinus
+	case token.TokAmpersand:
+		typ = ast.UnaryAddress
+	default:
+		return p.postfix()
+	}
+	if !p.enter() {
+		return nil
+	}
+	defer p.leave()
+	op := p.curr()
+	p.advance()
+	value := p.unary()
+	if value == nil {
+		return nil
+	}
+	return &ast.UnaryOperator{
+		Source: op.Source,
+		Type:   typ,
+		Value:  value,
+	}
+}
+
+// signedInteger
+// | integer
+// | '-' integer
+//
+// A '-' is only part of the literal where an operand is expected, so a-5 is
+// still a subtraction but a - -5 subtracts the literal -5.
+func (p *parser) signedInteger() *ast.Integer {
+	if p.unexpectedEnd() {
+		return nil
+	}
+	start := p.curr()
+	sign := ""
+	if start.Type == token.TokDash {
+		p.advance()
+		sign = "-"
+	}
+	curr := p.curr()
+	if !p.expect(token.TokInteger) {
+		return nil
+	}
+	n := p.arena.integer()
+	n.Source = start.Source
+	n.Value = sign + curr.Value
+	return n
+}
+
+// arraySize parses the size of a static array, which must be an integer or
+// character constant. Its value is found in the same way as when the constant
+// is folded.
+func (p *parser) arraySize() (int, bool) {
+	if p.unexpectedEnd() {
+		return 0, false
+	}
+	curr := p.curr()
+	switch curr.Type {
+	case token.TokCharacter:
+		p.advance()
+		return int(curr.Value[0]), true
+	case token.TokInteger, token.TokDash:
+		size := p.signedInteger()
+		if size == nil {
+			return 0, false
+		}
+		val, err := size.Int64()
+		if err != nil || val < 0 || val > math.MaxInt32 {
+			p.err = diag.Errorf(size.Source, "invalid static array size '%s'", size.Value)
+			return 0, false
+		}
+		return int(val), true
+	}
+	p.err = diag.Errorf(curr.Source, "array size must be an integer constant, got %s", curr.String())
+	return 0, false
+}
+
+// postfix
+// | postfix '[' expression ']'
+// | postfix '.' identifier
 // | terminal
-func (p *parser) subscript() ast.Expression {
-	term := p.terminal()
-	for !p.empty() && p.curr().Type == token.TokLeftSquare {
-		p.expect(token.TokLeftSquare)
-		index := p.expression()
-		if !p.expect(token.TokRightSquare) {
-			return nil
+//
+// Postfix operators apply from left to right, so a[0][1] subscripts a[0] and
+// a.b[0] subscripts a.b.
+func (p *parser) postfix() ast.Expression {
+	expr := p.terminal()
+	for expr != nil {
+		curr := p.curr()
+		if curr == nil {
+			return expr
+		}
+		switch curr.Type {
+		case token.TokLeftSquare:
+			expr = p.subscript(expr)
+		case token.TokDot:
+			expr = p.fieldAccess(expr)
+		default:
+			return expr
 		}
-		term = &ast.Subscript{Value: term, Index: index}
 	}
-	return term
+	return nil
+}
+
+// subscript parses the '[' expression ']' following a value being
+// subscripted.
+func (p *parser) subscript(value ast.Expression) ast.Expression {
+	open := p.curr()
+	p.expect(token.TokLeftSquare)
+	index := p.expression()
+	if index == nil || !p.expectClosing(open) {
+		return nil
+	}
+	return &ast.Subscript{Value: value, Index: index, End: p.prev().Source}
+}
+
+// fieldAccess parses the '.' identifier following a struct whose field is
+// being accessed.
+func (p *parser) fieldAccess(value ast.Expression) ast.Expression {
+	p.expect(token.TokDot)
+	field := p.curr()
+	if !p.expect(token.TokIdentifier) {
+		return nil
+	}
+	return &ast.FieldAccess{Value: value, Field: field.Value, End: field.Source}
 }
 
 // terminal
 // | integer
+// | character
+// | 'nil'
 // | variable
 // | '(' expression ')'
-// | '-' terminal
-// | '*' terminal
-// | '&' terminal
+// | statementExpression
 func (p *parser) terminal() ast.Expression {
 	if p.unexpectedEnd() {
 		return nil
@@ -501,60 +1385,115 @@ func (p *parser) terminal() ast.Expression {
 	curr := p.curr()
 	switch curr.Type {
 	case token.TokInteger:
-		p.pos++
-		return &ast.Integer{
+		p.advance()
+		n := p.arena.integer()
+		n.Source = curr.Source
+		n.Value = curr.Value
+		return n
+	case token.TokCharacter:
+		p.advance()
+		return &ast.Character{
 			Source: curr.Source,
-			Value:  curr.Value,
+			Value:  curr.Value[0],
+			Length: curr.Length,
 		}
+	case token.TokNil:
+		p.advance()
+		return &ast.NilLiteral{Source: curr.Source}
 	case token.TokIdentifier:
-		p.pos++
-		return &ast.Variable{
-			Source: curr.Source,
-			Value:  curr.Value,
-		}
+		p.advance()
+		n := p.arena.variable()
+		n.Source = curr.Source
+		n.Value = curr.Value
+		return n
 	case token.TokLeftBracket:
+		if next := p.peek(1); next != nil && next.Type == token.TokLeftCurly {
+			return p.statementExpression()
+		}
 		if !p.expect(token.TokLeftBracket) {
 			return nil
 		}
+		// Brackets only group an expression; there is no empty expression
+		// for them to hold.
+		if next := p.curr(); next != nil && next.Type == token.TokRightBracket {
+			p.err = diag.Errorf(next.Source, "expected expression, got %s", next.String())
+			return nil
+		}
 		expr := p.expression()
 		if expr == nil {
 			return nil
 		}
-		if !p.expect(token.TokRightBracket) {
+		if !p.expectClosing(curr) {
 			return nil
 		}
 		return expr
-	case token.TokStar:
-		p.expect(token.TokStar)
-		term := p.terminal()
-		if term == nil {
+	}
+	p.unexpected(curr)
+	return nil
+}
+
+// statementOnly contains the token types that can only begin a statement, not
+// an expression.
+var statementOnly = map[token.Type]bool{
+	token.TokSemiColon: true,
+	token.TokVar:       true,
+	token.TokIf:        true,
+	token.TokWhile:     true,
+	token.TokAssert:    true,
+	token.TokPrintf:    true,
+	token.TokDefer:     true,
+	token.TokSwitch:    true,
+	token.TokLeftCurly: true,
+	token.TokBreak:     true,
+	token.TokContinue:  true,
+	token.TokType:      true,
+}
+
+// statementExpression
+// | '(' '{' {statement} expression '}' ')'
+func (p *parser) statementExpression() ast.Expression {
+	open := p.curr()
+	p.advance()
+	curly := p.curr()
+	p.advance()
+	statements := make([]ast.Statement, 0)
+	var value ast.Expression
+	for value == nil {
+		if p.unexpectedEnd() {
 			return nil
 		}
-		return &ast.UnaryOperator{
-			Type:  ast.UnaryDereference,
-			Value: term,
-		}
-	case token.TokDash:
-		p.expect(token.TokDash)
-		term := p.terminal()
-		if term == nil {
+		curr := p.curr()
+		if isClosingBracket(curr.Type) {
+			p.err = diag.Errorf(curr.Source,
+				"statement expression must end with an expression, found %s", curr.String())
 			return nil
 		}
-		return &ast.UnaryOperator{
-			Type:  ast.UnaryMinus,
-			Value: term,
+		var stmt ast.Statement
+		if statementOnly[curr.Type] || p.atLabel() {
+			stmt = p.statement()
+		} else {
+			expr := p.expression()
+			if expr == nil {
+				return nil
+			}
+			if next := p.curr(); next != nil && next.Type == token.TokRightCurly {
+				value = expr
+				break
+			}
+			stmt = p.simpleStatement(expr)
 		}
-	case token.TokAmpersand:
-		p.expect(token.TokAmpersand)
-		term := p.terminal()
-		if term == nil {
+		if stmt == nil {
 			return nil
 		}
-		return &ast.UnaryOperator{
-			Type:  ast.UnaryAddress,
-			Value: term,
-		}
+		statements = append(statements, stmt)
+	}
+	if !p.expectClosing(curly) || !p.expectClosing(open) {
+		return nil
+	}
+	return &ast.StatementExpression{
+		Source:     open.Source,
+		End:        p.prev().Source,
+		Statements: statements,
+		Value:      value,
 	}
-	p.unexpected(curr)
-	return nil
 }
@@ -2,9 +2,13 @@ package parser
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/cmgn/compiler/ast"
+	"github.com/cmgn/compiler/diag"
+	"github.com/cmgn/compiler/lexer"
 	"github.com/cmgn/compiler/token"
 )
 
@@ -34,6 +38,237 @@ func TestTerminalVariable(t *testing.T) {
 	}
 }
 
+func TestTerminalCharacter(t *testing.T) {
+	in := toks(tok(token.TokCharacter, "A"))
+	parser := makeParser(in)
+	term := parser.terminal()
+	if char, ok := term.(*ast.Character); !ok || char.Value != 'A' {
+		t.Error(
+			"For", "'A'",
+			"expected", "character",
+			"got", term,
+		)
+	}
+}
+
+func TestTerminalNil(t *testing.T) {
+	in := toks(tok(token.TokNil, "nil"))
+	parser := makeParser(in)
+	term := parser.terminal()
+	if _, ok := term.(*ast.NilLiteral); !ok {
+		t.Error(
+			"For", "nil",
+			"expected", "nil literal",
+			"got", term,
+		)
+	}
+}
+
+func TestDeclarationInitializer(t *testing.T) {
+	in := toks(
+		tok(token.TokVar, "var"),
+		tok(token.TokIdentifier, "p"),
+		tok(token.TokPtr, "ptr"),
+		tok(token.TokTo, "to"),
+		tok(token.TokInt, "int"),
+		tok(token.TokAssign, "="),
+		tok(token.TokNil, "nil"),
+		tok(token.TokSemiColon, ";"),
+	)
+	parser := makeParser(in)
+	stmt := parser.statement()
+	decl, ok := stmt.(*ast.Declaration)
+	if !ok {
+		t.Error(
+			"For", "var p ptr to int = nil;",
+			"expected", "declaration",
+			"got", stmt,
+		)
+		return
+	}
+	if _, ok := decl.Value.(*ast.NilLiteral); !ok {
+		t.Error(
+			"For", "var p ptr to int = nil;",
+			"expected", "nil initializer",
+			"got", decl.Value,
+		)
+	}
+}
+
+func TestArrayLiteral(t *testing.T) {
+	decl := func(tail ...*token.Token) []*token.Token {
+		return append(toks(
+			tok(token.TokVar, "var"),
+			tok(token.TokIdentifier, "a"),
+			tok(token.TokArray, "array"),
+			tok(token.TokLeftBracket, "("),
+			tok(token.TokInteger, "3"),
+			tok(token.TokRightBracket, ")"),
+			tok(token.TokOf, "of"),
+			tok(token.TokInt, "int"),
+			tok(token.TokAssign, "="),
+		), tail...)
+	}
+	tests := []struct {
+		name string
+		in   []*token.Token
+		out  string
+	}{
+		{
+			"var a array(3) of int = {1, 2, 3};",
+			decl(
+				tok(token.TokLeftCurly, "{"),
+				tok(token.TokInteger, "1"),
+				tok(token.TokComma, ","),
+				tok(token.TokInteger, "2"),
+				tok(token.TokComma, ","),
+				tok(token.TokInteger, "3"),
+				tok(token.TokRightCurly, "}"),
+				tok(token.TokSemiColon, ";"),
+			),
+			"Declaration[a, Array[3, 'int'], ArrayLiteral[1, 2, 3]]",
+		},
+		{
+			"var a array(3) of int = {1, {b},};",
+			decl(
+				tok(token.TokLeftCurly, "{"),
+				tok(token.TokInteger, "1"),
+				tok(token.TokComma, ","),
+				tok(token.TokLeftCurly, "{"),
+				tok(token.TokIdentifier, "b"),
+				tok(token.TokRightCurly, "}"),
+				tok(token.TokComma, ","),
+				tok(token.TokRightCurly, "}"),
+				tok(token.TokSemiColon, ";"),
+			),
+			"Declaration[a, Array[3, 'int'], ArrayLiteral[1, ArrayLiteral[b]]]",
+		},
+		{
+			"var a array(3) of int = {};",
+			decl(
+				tok(token.TokLeftCurly, "{"),
+				tok(token.TokRightCurly, "}"),
+				tok(token.TokSemiColon, ";"),
+			),
+			"Declaration[a, Array[3, 'int'], ArrayLiteral[]]",
+		},
+	}
+	for _, test := range tests {
+		stmts, err := Parse(test.in)
+		if err != nil || len(stmts) != 1 || stmts[0].String() != test.out {
+			t.Error(
+				"For", test.name,
+				"expected", test.out,
+				"got", stmts, err,
+			)
+		}
+	}
+}
+
+func TestArrayLiteralMissingComma(t *testing.T) {
+	in := toks(
+		tok(token.TokVar, "var"),
+		tok(token.TokIdentifier, "a"),
+		tok(token.TokInt, "int"),
+		tok(token.TokAssign, "="),
+		tok(token.TokLeftCurly, "{"),
+		tok(token.TokInteger, "1"),
+		tok(token.TokInteger, "2"),
+		tok(token.TokRightCurly, "}"),
+		tok(token.TokSemiColon, ";"),
+	)
+	if stmts, err := Parse(in); err == nil {
+		t.Error(
+			"For", "var a int = {1 2};",
+			"expected", "error",
+			"got", stmts,
+		)
+	}
+}
+
+func TestCommaList(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+		err string
+	}{
+		{"var f func(int, char) int;", "Declaration[f, Function[('int', 'char'), 'int']]", ""},
+		{"var f func(int, char,) int;", "Declaration[f, Function[('int', 'char'), 'int']]", ""},
+		{"var f func(int,);", "Declaration[f, Function[('int'), void]]", ""},
+		{"var f func(, int);", "", "[test:1] unexpected ','"},
+		{"var f func(int,, char);", "", "[test:1] unexpected ','"},
+		{"var f func(,);", "", "[test:1] unexpected ','"},
+		{"var a array of int = {1, 2};", "Declaration[a, Array[?, 'int'], ArrayLiteral[1, 2]]", ""},
+		{"var a array of int = {1, 2,};", "Declaration[a, Array[?, 'int'], ArrayLiteral[1, 2]]", ""},
+		{"var a array of int = {, 1};", "", "[test:1] unexpected ','"},
+		{"var a array of int = {1,, 2};", "", "[test:1] unexpected ','"},
+		{"var a array of int = {,};", "", "[test:1] unexpected ','"},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmts, err := Parse(tokens)
+		out, errStr := "", ""
+		if len(stmts) == 1 {
+			out = stmts[0].String()
+		}
+		if err != nil {
+			errStr = err.Error()
+		}
+		if out != test.out || errStr != test.err {
+			t.Error(
+				"For", test.in,
+				"expected", test.out, test.err,
+				"got", out, errStr,
+			)
+		}
+	}
+}
+
+func TestStatementExpression(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+		err string
+	}{
+		{
+			"x = ({ var y int = 1; y = y + 1; y * 2 });",
+			"Assignment[x, StatementExpression[Declaration[y, 'int', 1], Assignment[y, BinaryOperator['+', y, 1]], BinaryOperator['*', y, 2]]]",
+			"",
+		},
+		{"x = ({ 1 }) + 2;", "Assignment[x, BinaryOperator['+', StatementExpression[1], 2]]", ""},
+		{"x = ({ if a b; ; ({ c; d }) });", "Assignment[x, StatementExpression[If[a, ExpressionStatement[b], Empty[]], Empty[], StatementExpression[ExpressionStatement[c], d]]]", ""},
+		{"x = ({ a; b; });", "", "[test:1] statement expression must end with an expression, found '}'"},
+		{"x = ({ var y int; });", "", "[test:1] statement expression must end with an expression, found '}'"},
+		{"x = ({});", "", "[test:1] statement expression must end with an expression, found '}'"},
+		{"x = ({ a );", "", "[test:1] expected ';', got ')'"},
+		{"x = ({ a } + 1;", "", "[test:1] expected ')', got '+'"},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmts, err := Parse(tokens)
+		out, errStr := "", ""
+		if len(stmts) == 1 {
+			out = stmts[0].String()
+		}
+		if err != nil {
+			errStr = err.Error()
+		}
+		if out != test.out || errStr != test.err {
+			t.Error(
+				"For", test.in,
+				"expected", test.out, test.err,
+				"got", out, errStr,
+			)
+		}
+	}
+}
+
 func TestTerminalBrackets(t *testing.T) {
 	in := toks(
 		tok(token.TokLeftBracket, "("),
@@ -121,6 +356,615 @@ func TestAssignmentStatement(t *testing.T) {
 	}
 }
 
+func TestAssertStatement(t *testing.T) {
+	in := toks(
+		tok(token.TokAssert, "assert"),
+		tok(token.TokInteger, "1"),
+		tok(token.TokEquals, "=="),
+		tok(token.TokInteger, "1"),
+		tok(token.TokSemiColon, ";"),
+	)
+	parser := makeParser(in)
+	stmt := parser.statement()
+	if _, ok := stmt.(*ast.AssertStatement); !ok {
+		t.Error(
+			"For", "assert 1 == 1;",
+			"expected", "assert",
+			"got", stmt,
+		)
+	}
+}
+
+func TestAssertMissingSemiColon(t *testing.T) {
+	in := toks(
+		tok(token.TokAssert, "assert"),
+		tok(token.TokInteger, "1"),
+	)
+	if stmts, err := Parse(in); err == nil {
+		t.Error(
+			"For", "assert 1",
+			"expected", "error",
+			"got", stmts,
+		)
+	}
+}
+
+func TestSwitchStatement(t *testing.T) {
+	in := toks(
+		tok(token.TokSwitch, "switch"),
+		tok(token.TokIdentifier, "x"),
+		tok(token.TokLeftCurly, "{"),
+		tok(token.TokCase, "case"),
+		tok(token.TokInteger, "1"),
+		tok(token.TokColon, ":"),
+		tok(token.TokIdentifier, "a"),
+		tok(token.TokSemiColon, ";"),
+		tok(token.TokDefault, "default"),
+		tok(token.TokColon, ":"),
+		tok(token.TokCase, "case"),
+		tok(token.TokInteger, "2"),
+		tok(token.TokColon, ":"),
+		tok(token.TokIdentifier, "b"),
+		tok(token.TokSemiColon, ";"),
+		tok(token.TokIdentifier, "c"),
+		tok(token.TokSemiColon, ";"),
+		tok(token.TokRightCurly, "}"),
+	)
+	stmts, err := Parse(in)
+	expected := "Switch[x, Case[1, [ExpressionStatement[a]]], Default[], " +
+		"Case[2, [ExpressionStatement[b], ExpressionStatement[c]]]]"
+	if err != nil || len(stmts) != 1 || stmts[0].String() != expected {
+		t.Error(
+			"For", "switch x { case 1: a; default: case 2: b; c; }",
+			"expected", expected,
+			"got", stmts, err,
+		)
+	}
+}
+
+func TestCharSwitch(t *testing.T) {
+	in := "switch c { case 'a': a; case '\\n': case 'b': b; }"
+	tokens, err := lexer.Lex("test", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := Parse(tokens)
+	expected := "Switch[c, Case['a', [ExpressionStatement[a]]], Case['\\n', []], " +
+		"Case['b', [ExpressionStatement[b]]]]"
+	if err != nil || len(stmts) != 1 || stmts[0].String() != expected {
+		t.Error(
+			"For", in,
+			"expected", expected,
+			"got", stmts, err,
+		)
+	}
+}
+
+func TestSwitchMultipleDefaults(t *testing.T) {
+	in := toks(
+		tok(token.TokSwitch, "switch"),
+		tok(token.TokIdentifier, "x"),
+		tok(token.TokLeftCurly, "{"),
+		tok(token.TokDefault, "default"),
+		tok(token.TokColon, ":"),
+		tok(token.TokDefault, "default"),
+		tok(token.TokColon, ":"),
+		tok(token.TokRightCurly, "}"),
+	)
+	if stmts, err := Parse(in); err == nil {
+		t.Error(
+			"For", "switch x { default: default: }",
+			"expected", "error",
+			"got", stmts,
+		)
+	}
+}
+
+func TestNoProgress(t *testing.T) {
+	parser := makeParser(toks(tok(token.TokIdentifier, "a"), tok(token.TokSemiColon, ";")))
+	// A statement that consumed nothing would be parsed again and again.
+	if stmt := parser.progressed(0, &ast.Empty{}); stmt != nil || parser.err == nil {
+		t.Error(
+			"For", "a statement that consumed no tokens",
+			"expected", "an error",
+			"got", stmt, parser.err,
+		)
+	}
+	parser = makeParser(toks(tok(token.TokIdentifier, "a"), tok(token.TokSemiColon, ";")))
+	stmt := parser.statement()
+	if parser.progressed(0, stmt) != stmt || parser.err != nil {
+		t.Error(
+			"For", "a;",
+			"expected", stmt,
+			"got", parser.err,
+		)
+	}
+}
+
+func TestParseWith(t *testing.T) {
+	tests := []struct {
+		in    string
+		cfg   Config
+		stmts int
+		errs  []string
+	}{
+		{"a = ; b; c = ;", Config{}, 0, []string{"[test:1] unexpected ';'"}},
+		{"a = ; b; c = ;", Config{Recover: true}, 1, []string{"[test:1] unexpected ';'", "[test:1] unexpected ';'"}},
+		{"a = ; b; c = ;", Config{Recover: true, MaxErrors: 1}, 0, []string{"[test:1] unexpected ';'"}},
+		{"{ a = ; b = ; c = ; } d;", Config{Recover: true, MaxErrors: 2}, 0, []string{"[test:1] unexpected ';'", "[test:1] unexpected ';'"}},
+		{"while 1 { { a = ; } b = ; } c = ; d;", Config{Recover: true, MaxErrors: 1}, 0, []string{"[test:1] unexpected ';'"}},
+		{"{ a = ; b = ; } d;", Config{Recover: true, MaxErrors: 3}, 2, []string{"[test:1] unexpected ';'", "[test:1] unexpected ';'"}},
+		{"a = ((1));", Config{MaxDepth: 4}, 1, nil},
+		{"a = (((1)));", Config{MaxDepth: 4}, 0, []string{"[test:1] nesting is deeper than 4 levels"}},
+		{"a = ----1;", Config{MaxDepth: 4}, 0, []string{"[test:1] nesting is deeper than 4 levels"}},
+		{"{ { a; } }", Config{MaxDepth: 2}, 0, []string{"[test:1] nesting is deeper than 2 levels"}},
+		{"var a int = " + strings.Repeat("{", 9) + "1" + strings.Repeat("}", 9) + ";", Config{MaxDepth: 12}, 1, nil},
+		{"var a int = " + strings.Repeat("{", 51) + "1" + strings.Repeat("}", 51) + ";", Config{MaxDepth: 10}, 0, []string{"[test:1] nesting is deeper than 10 levels"}},
+		{"var p " + strings.Repeat("ptr to ", 8) + "int;", Config{MaxDepth: 10}, 1, nil},
+		{"var p " + strings.Repeat("ptr to ", 51) + "int;", Config{MaxDepth: 10}, 0, []string{"[test:1] nesting is deeper than 10 levels"}},
+		{"var p " + strings.Repeat("struct { f ", 51) + "int;" + strings.Repeat(" };", 51), Config{MaxDepth: 10}, 0, []string{"[test:1] nesting is deeper than 10 levels"}},
+		{"var p " + strings.Repeat("func(", 51) + "int" + strings.Repeat(")", 51) + ";", Config{MaxDepth: 10}, 0, []string{"[test:1] nesting is deeper than 10 levels"}},
+		{"if a b;" + strings.Repeat(" elif a b;", 20), Config{MaxDepth: 100}, 1, nil},
+		{"if a b;" + strings.Repeat(" elif a b;", 2000), Config{MaxDepth: 100}, 0, []string{"[test:1] nesting is deeper than 100 levels"}},
+		{"a; a + 1", Config{}, 1, []string{"[test:1] unexpected end of input after '1'"}},
+		{"a; a + 1", Config{TrailingExpression: true}, 2, nil},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := ParseWith(tokens, test.cfg)
+		errs := make([]string, len(result.Errors))
+		for i, err := range result.Errors {
+			errs[i] = err.Error()
+		}
+		if len(result.Statements) != test.stmts ||
+			strings.Join(errs, "\n") != strings.Join(test.errs, "\n") ||
+			(err == nil) != (len(test.errs) == 0) {
+			t.Error(
+				"For", test.in, test.cfg,
+				"expected", test.stmts, test.errs,
+				"got", result.Statements, errs,
+			)
+		}
+	}
+}
+
+func TestEmptyBrackets(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{"x = ();", "[test:1] expected expression, got ')'"},
+		{"x = (\n);", "[test:2] expected expression, got ')'"},
+		{"x = (());", "[test:1] expected expression, got ')'"},
+		{"x = (1);", ""},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Parse(tokens)
+		errStr := ""
+		if err != nil {
+			errStr = err.Error()
+		}
+		if errStr != test.err {
+			t.Error(
+				"For", test.in,
+				"expected", test.err,
+				"got", errStr,
+			)
+		}
+	}
+}
+
+func TestLoopElse(t *testing.T) {
+	tests := []struct {
+		in       string
+		loopElse bool
+		out      string
+	}{
+		{"while a b; else c;", true, "(while (var a) (expr (var b)) (expr (var c)))"},
+		{"while a b;", true, "(while (var a) (expr (var b)))"},
+		{"if a while b c; else d;", true, "(if (var a) (while (var b) (expr (var c)) (expr (var d))) (empty))"},
+		{"if a while b c; else d;", false, "(if (var a) (while (var b) (expr (var c))) (expr (var d)))"},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := ParseWith(tokens, Config{LoopElse: test.loopElse})
+		if err != nil || len(result.Statements) != 1 || ast.ToSExpr(result.Statements[0]) != test.out {
+			t.Error(
+				"For", test.in, test.loopElse,
+				"expected", test.out,
+				"got", result.Statements, err,
+			)
+		}
+	}
+	tokens, err := lexer.Lex("test", "while a b; else c;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(tokens); err == nil {
+		t.Error(
+			"For", "while a b; else c;",
+			"expected", "an error without LoopElse",
+			"got", err,
+		)
+	}
+}
+
+func TestElif(t *testing.T) {
+	tests := []struct {
+		elif   string
+		elseIf string
+	}{
+		{"if a b; elif c d;", "if a b; else if c d;"},
+		{"if a b; elif c d; else e;", "if a b; else if c d; else e;"},
+		{"if a b; elif c d; elif e f; else g;", "if a b; else if c d; else if e f; else g;"},
+		{"if a { b; } elif c { d; }", "if a { b; } else if c { d; }"},
+	}
+	parse := func(in string) []ast.Statement {
+		tokens, err := lexer.Lex("test", in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmts, err := Parse(tokens)
+		if err != nil {
+			t.Fatal(in, err)
+		}
+		return stmts
+	}
+	for _, test := range tests {
+		a, b := parse(test.elif), parse(test.elseIf)
+		if len(a) != 1 || len(b) != 1 || !ast.Equal(a[0], b[0]) {
+			t.Error(
+				"For", test.elif,
+				"expected", b,
+				"got", a,
+			)
+		}
+	}
+
+	tokens, err := lexer.Lex("test", "elif a b;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmts, err := Parse(tokens); err == nil {
+		t.Error(
+			"For", "elif a b;",
+			"expected", "error",
+			"got", stmts,
+		)
+	}
+}
+
+func TestBranchStatements(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"while a break;", "(while (var a) (break))"},
+		{"while a { continue; }", "(while (var a) (block (continue)))"},
+		{"outer: while a while b break outer;", "(label outer (while (var a) (while (var b) (break outer))))"},
+		{"outer: while a { inner: while b continue outer; }",
+			"(label outer (while (var a) (block (label inner (while (var b) (continue outer))))))"},
+		{"a: b = c;", "(label a (assign (var b) (var c)))"},
+		{"x = ({ a: while b break a; c });", "(assign (var x) (stmtexpr (label a (while (var b) (break a))) (var c)))"},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmts, err := Parse(tokens)
+		if err != nil || len(stmts) != 1 || ast.ToSExpr(stmts[0]) != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", stmts, err,
+			)
+		}
+	}
+	for _, in := range []string{"break a b;", "continue 1;", "a: ;b:"} {
+		tokens, err := lexer.Lex("test", in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stmts, err := Parse(tokens); err == nil {
+			t.Error(
+				"For", in,
+				"expected", "error",
+				"got", stmts,
+			)
+		}
+	}
+}
+
+func TestBlockRecovery(t *testing.T) {
+	in := toks(
+		tok(token.TokLeftCurly, "{"),
+		tok(token.TokIdentifier, "a"),
+		tok(token.TokSemiColon, ";"),
+		tok(token.TokIdentifier, "b"),
+		tok(token.TokAssign, "="),
+		tok(token.TokSemiColon, ";"),
+		tok(token.TokIdentifier, "c"),
+		tok(token.TokSemiColon, ";"),
+		tok(token.TokRightCurly, "}"),
+		tok(token.TokRightCurly, "}"),
+		tok(token.TokIdentifier, "d"),
+		tok(token.TokSemiColon, ";"),
+	)
+	stmts, errs := ParseWithRecovery(in)
+	expected := []string{
+		"Block[ExpressionStatement[a], ExpressionStatement[c]]",
+		"ExpressionStatement[d]",
+	}
+	if len(errs) != 2 || len(stmts) != len(expected) {
+		t.Error(
+			"For", "{ a; b = ; c; } } d;",
+			"expected", expected, "and 2 errors",
+			"got", stmts, errs,
+		)
+		return
+	}
+	for i, stmt := range stmts {
+		if stmt.String() != expected[i] {
+			t.Error(
+				"For", "{ a; b = ; c; } } d;",
+				"expected", expected[i],
+				"got", stmt.String(),
+			)
+		}
+	}
+	if _, err := Parse(in); err == nil {
+		t.Error(
+			"For", "{ a; b = ; c; } } d;",
+			"expected", "error without recovery",
+			"got", "nil",
+		)
+	}
+}
+
+func TestMissingSemiColonRecovery(t *testing.T) {
+	tests := []struct {
+		in    string
+		stmts []string
+		// errs holds the position and message of each error, followed
+		// by its fix if it has one.
+		errs []string
+	}{
+		{
+			"a = 1\nb = 2;",
+			[]string{"Assignment[a, 1]", "Assignment[b, 2]"},
+			[]string{"1:6 missing ';'", ";"},
+		},
+		{
+			"var x int = 'a'\nassert x printf \"%d\", x;",
+			[]string{"Declaration[x, 'int', 'a']", "Assert[x]", "Printf[\"%d\", x]"},
+			[]string{"1:16 missing ';'", ";", "2:9 missing ';'", ";"},
+		},
+		{
+			"{ a }",
+			[]string{"Block[ExpressionStatement[a]]"},
+			[]string{"1:4 missing ';'", ";"},
+		},
+		{
+			"a = 1",
+			[]string{"Assignment[a, 1]"},
+			[]string{"1:6 missing ';'", ";"},
+		},
+		{
+			"printf \"a\\x41\"\nb;",
+			[]string{"Printf[\"aA\"]", "ExpressionStatement[b]"},
+			[]string{"1:15 missing ';'", ";"},
+		},
+		{
+			"var x char = '\\x41'\nb;",
+			[]string{"Declaration[x, 'char', 'A']", "ExpressionStatement[b]"},
+			[]string{"1:20 missing ';'", ";"},
+		},
+		{
+			"a = 1 b; c;",
+			[]string{"ExpressionStatement[c]"},
+			[]string{"1:7 expected ';', got 'b'"},
+		},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmts, errs := ParseWithRecovery(tokens)
+		strs := make([]string, len(stmts))
+		for i, stmt := range stmts {
+			strs[i] = stmt.String()
+		}
+		var errStrs []string
+		for _, err := range errs {
+			derr := err.(*diag.Error)
+			errStrs = append(errStrs, fmt.Sprintf("%d:%d %s",
+				derr.Source.Line, derr.Source.Column, derr.Message))
+			if derr.Fix != "" {
+				errStrs = append(errStrs, derr.Fix)
+			}
+		}
+		if !reflect.DeepEqual(strs, test.stmts) || !reflect.DeepEqual(errStrs, test.errs) {
+			t.Error(
+				"For", test.in,
+				"expected", test.stmts, test.errs,
+				"got", strs, errStrs,
+			)
+		}
+		if _, err := Parse(tokens); err == nil {
+			t.Error(
+				"For", test.in,
+				"expected", "error without recovery",
+				"got", "nil",
+			)
+		}
+	}
+}
+
+func TestAssignmentInCondition(t *testing.T) {
+	tests := []struct {
+		in string
+		// column is where the '=' is, or 0 if there should be no error.
+		column int
+	}{
+		{"if (x = 5) y = 1;", 7},
+		{"if x = 5 y = 1;", 6},
+		{"while (x = 0) {}", 10},
+		{"assert x = 1;", 10},
+		{"if (x == 5) y = 1;", 0},
+		{"while x == 0 x = 1;", 0},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Parse(tokens)
+		if test.column == 0 {
+			if err != nil {
+				t.Error(
+					"For", test.in,
+					"expected", "no error",
+					"got", err,
+				)
+			}
+			continue
+		}
+		derr, ok := err.(*diag.Error)
+		if !ok || derr.Message != "assignment in condition, did you mean '=='?" ||
+			derr.Source.Column != test.column || derr.Fix != "=" {
+			t.Error(
+				"For", test.in,
+				"expected", "assignment in condition at column", test.column,
+				"got", err,
+			)
+		}
+	}
+}
+
+func TestParseWithTrivia(t *testing.T) {
+	in := `// first
+a = 1; // one
+b = 2;
+
+
+// about c
+// more about c
+{
+	c; // three
+}`
+	cfg := lexer.DefaultConfig
+	cfg.Comments = true
+	tokens, err := lexer.LexWith("test", in, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := ParseWithTrivia(tokens)
+	if err != nil || len(stmts) != 3 {
+		t.Fatal(stmts, err)
+	}
+	inner := stmts[2].(*ast.BlockStatement).Statements[0]
+	tests := []struct {
+		stmt ast.Statement
+		out  ast.Trivia
+	}{
+		{stmts[0], ast.Trivia{Leading: []string{"// first"}, Trailing: "// one"}},
+		{stmts[1], ast.Trivia{}},
+		{stmts[2], ast.Trivia{BlankLines: 2, Leading: []string{"// about c", "// more about c"}}},
+		{inner, ast.Trivia{Trailing: "// three"}},
+	}
+	for _, test := range tests {
+		trivia := test.stmt.(ast.HasTrivia).Trivia()
+		if trivia == nil || fmt.Sprint(*trivia) != fmt.Sprint(test.out) {
+			t.Error(
+				"For", test.stmt,
+				"expected", test.out,
+				"got", trivia,
+			)
+		}
+	}
+	if stmts, err := Parse(tokens); err != nil || stmts[0].(ast.HasTrivia).Trivia() != nil {
+		t.Error(
+			"For", in,
+			"expected", "no trivia without trivia mode",
+			"got", stmts, err,
+		)
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+		raw bool
+	}{
+		{`printf "a\\b\n";`, "a\\b\n", false},
+		{"printf `a\\b\\n`;", `a\b\n`, true},
+		{"printf `a\nb`;", "a\nb", true},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmts, err := Parse(tokens)
+		if err != nil {
+			t.Fatal(err)
+		}
+		format := stmts[0].(*ast.PrintfStatement).Format
+		if format.Value != test.out || format.Raw != test.raw {
+			t.Error(
+				"For", test.in,
+				"expected", test.out, test.raw,
+				"got", format, format.Raw,
+			)
+		}
+	}
+}
+
+func TestParenthesize(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"a + b * c < d", "((a + (b * c)) < d)"},
+		{"a - b - c", "((a - b) - c)"},
+		{"a / b * c", "((a / b) * c)"},
+		{"a == b != c < d", "((a == b) != (c < d))"},
+		{"-a * *p[1] + &x", "(((-a) * (*p[1])) + (&x))"},
+		{"(a + b) * -5", "((a + b) * -5)"},
+		{"a[i + 1] > 'c'", "(a[(i + 1)] > 'c')"},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr, err := ParseExpression(tokens)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out := ast.Parenthesize(expr); out != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", out,
+			)
+		}
+	}
+}
+
 func TestSubscript(t *testing.T) {
 	in := toks(
 		tok(token.TokIdentifier, "abc"),
@@ -129,7 +973,7 @@ func TestSubscript(t *testing.T) {
 		tok(token.TokRightSquare, "]"),
 	)
 	parser := makeParser(in)
-	subscript := parser.subscript()
+	subscript := parser.postfix()
 	if _, ok := subscript.(*ast.Subscript); !ok {
 		t.Error(
 			"For", "abc[123]",
@@ -139,16 +983,678 @@ func TestSubscript(t *testing.T) {
 	}
 }
 
+func TestPostfixChain(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"a[0][1]", "(index (index (var a) (int 0)) (int 1))"},
+		{"a[b[0]][1][2]", "(index (index (index (var a) (index (var b) (int 0))) (int 1)) (int 2))"},
+		{"*a[0][1]", "(unop deref (index (index (var a) (int 0)) (int 1)))"},
+		{"(*a)[0]", "(index (unop deref (var a)) (int 0))"},
+		{"a.b[0]", "(index (field b (var a)) (int 0))"},
+		{"a[0].b", "(field b (index (var a) (int 0)))"},
+		{"a.b[0].c", "(field c (index (field b (var a)) (int 0)))"},
+		{"*a.b", "(unop deref (field b (var a)))"},
+		{"(*a).b", "(field b (unop deref (var a)))"},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr, err := ParseExpression(tokens)
+		if err != nil || ast.ToSExpr(expr) != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", expr, err,
+			)
+		}
+	}
+}
+
+func TestNamedType(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"var p point;", "(decl p (named point))"},
+		{"var a array(2) of ptr to node;", "(decl a (array 2 (ptr (named node))))"},
+		{"var f func(a, int) b = g;", "(decl f (func (params (named a) int) (named b)) (var g))"},
+		{"var s struct { c char; n int; };", "(decl s (struct (field c char) (field n int)))"},
+		{"var e struct {};", "(decl e (struct))"},
+		{"var l ptr to struct { next ptr to node; };", "(decl l (ptr (struct (field next (ptr (named node))))))"},
+		{"type node struct { next ptr to node; };", "(type node (struct (field next (ptr (named node)))))"},
+		{"type byte char;", "(type byte char)"},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmts, err := Parse(tokens)
+		if err != nil || len(stmts) != 1 || ast.ToSExpr(stmts[0]) != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", stmts, err,
+			)
+		}
+	}
+}
+
+func TestParseType(t *testing.T) {
+	in := toks(
+		tok(token.TokArray, "array"),
+		tok(token.TokLeftBracket, "("),
+		tok(token.TokInteger, "3"),
+		tok(token.TokRightBracket, ")"),
+		tok(token.TokOf, "of"),
+		tok(token.TokPtr, "ptr"),
+		tok(token.TokTo, "to"),
+		tok(token.TokInt, "int"),
+	)
+	typ, err := ParseType(in)
+	if err != nil {
+		t.Error(
+			"For", "array(3) of ptr to int",
+			"expected", "no error",
+			"got", err,
+		)
+		return
+	}
+	arr, ok := typ.(*ast.ArrayType)
+	if !ok || arr.Length != 3 {
+		t.Error(
+			"For", "array(3) of ptr to int",
+			"expected", "array of length 3",
+			"got", typ,
+		)
+		return
+	}
+	ptr, ok := arr.Type.(*ast.PointerType)
+	if !ok {
+		t.Error(
+			"For", "array(3) of ptr to int",
+			"expected", "pointer element type",
+			"got", arr.Type,
+		)
+		return
+	}
+	if prim, ok := ptr.Type.(*ast.Primitive); !ok || prim.Type != ast.IntType {
+		t.Error(
+			"For", "array(3) of ptr to int",
+			"expected", "pointer to int",
+			"got", ptr,
+		)
+	}
+}
+
+func TestFunctionType(t *testing.T) {
+	tests := []struct {
+		source string
+		in     []*token.Token
+		out    string
+	}{
+		{
+			"func(int) int",
+			toks(
+				tok(token.TokFunc, "func"),
+				tok(token.TokLeftBracket, "("),
+				tok(token.TokInt, "int"),
+				tok(token.TokRightBracket, ")"),
+				tok(token.TokInt, "int"),
+			),
+			"Function[('int'), 'int']",
+		},
+		{
+			"func()",
+			toks(
+				tok(token.TokFunc, "func"),
+				tok(token.TokLeftBracket, "("),
+				tok(token.TokRightBracket, ")"),
+			),
+			"Function[(), void]",
+		},
+		{
+			"ptr to func(int, char) int",
+			toks(
+				tok(token.TokPtr, "ptr"),
+				tok(token.TokTo, "to"),
+				tok(token.TokFunc, "func"),
+				tok(token.TokLeftBracket, "("),
+				tok(token.TokInt, "int"),
+				tok(token.TokComma, ","),
+				tok(token.TokChar, "char"),
+				tok(token.TokRightBracket, ")"),
+				tok(token.TokInt, "int"),
+			),
+			"Pointer[Function[('int', 'char'), 'int']]",
+		},
+	}
+	for _, test := range tests {
+		typ, err := ParseType(test.in)
+		if err != nil {
+			t.Error(
+				"For", test.source,
+				"expected", test.out,
+				"got", err,
+			)
+		} else if typ.String() != test.out {
+			t.Error(
+				"For", test.source,
+				"expected", test.out,
+				"got", typ.String(),
+			)
+		} else if typ.Size() != 8 {
+			t.Error(
+				"For", test.source,
+				"expected", "size 8",
+				"got", typ.Size(),
+			)
+		}
+	}
+}
+
+func TestParseTypeTrailing(t *testing.T) {
+	in := toks(
+		tok(token.TokInt, "int"),
+		tok(token.TokSemiColon, ";"),
+	)
+	if typ, err := ParseType(in); err == nil {
+		t.Error(
+			"For", "int ;",
+			"expected", "error",
+			"got", typ,
+		)
+	}
+}
+
+func TestUnarySubscript(t *testing.T) {
+	in := toks(
+		tok(token.TokAmpersand, "&"),
+		tok(token.TokIdentifier, "abc"),
+		tok(token.TokLeftSquare, "["),
+		tok(token.TokInteger, "0"),
+		tok(token.TokRightSquare, "]"),
+	)
+	parser := makeParser(in)
+	expr := parser.unary()
+	unary, ok := expr.(*ast.UnaryOperator)
+	if !ok || unary.Type != ast.UnaryAddress {
+		t.Error(
+			"For", "&abc[0]",
+			"expected", "address of",
+			"got", expr,
+		)
+		return
+	}
+	if _, ok := unary.Value.(*ast.Subscript); !ok {
+		t.Error(
+			"For", "&abc[0]",
+			"expected", "address of subscript",
+			"got", expr,
+		)
+	}
+}
+
+func TestSignedInteger(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"a-5", "BinaryOperator['-', a, 5]"},
+		{"-5", "-5"},
+		{"a - -5", "BinaryOperator['-', a, -5]"},
+		{"a--5", "BinaryOperator['-', a, -5]"},
+		{"(-5)", "-5"},
+		{"-a", "UnaryOperator['-', a]"},
+		{"--5", "UnaryOperator['-', -5]"},
+		{"-9223372036854775808", "-9223372036854775808"},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr, err := ParseExpression(tokens)
+		if err != nil || expr.String() != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", expr, err,
+			)
+		}
+	}
+}
+
+func TestNegativeArraySize(t *testing.T) {
+	in := "array(-5) of int"
+	tokens, err := lexer.Lex("test", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParseType(tokens)
+	expected := "[test:1] invalid static array size '-5'"
+	if err == nil || err.Error() != expected {
+		t.Error(
+			"For", in,
+			"expected", expected,
+			"got", err,
+		)
+	}
+}
+
+func TestArraySize(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+		err string
+	}{
+		{"array(0x10) of int", "Array[16, 'int']", ""},
+		{"array('A') of int", "Array[65, 'int']", ""},
+		{"array(12) of char", "Array[12, 'char']", ""},
+		{"array(n) of int", "", "[test:1] array size must be an integer constant, got 'n'"},
+		{"array(nil) of int", "", "[test:1] array size must be an integer constant, got 'nil'"},
+		{"array(0x100000000) of int", "", "[test:1] invalid static array size '0x100000000'"},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		typ, err := ParseType(tokens)
+		out, errStr := "", ""
+		if typ != nil {
+			out = typ.String()
+		}
+		if err != nil {
+			errStr = err.Error()
+		}
+		if out != test.out || errStr != test.err {
+			t.Error(
+				"For", test.in,
+				"expected", test.out, test.err,
+				"got", out, errStr,
+			)
+		}
+	}
+}
+
+func TestSExpr(t *testing.T) {
+	tests := []struct {
+		in  string
+		out []string
+	}{
+		{
+			"var a int = 1;\na = a + 5 * -2;",
+			[]string{
+				"(decl a int (int 1))",
+				"(assign (var a) (binop add (var a) (binop mul (int 5) (int -2))))",
+			},
+		},
+		{
+			"var p ptr to array(2) of char = nil;\nvar f func(int, char) int;\nvar g func();",
+			[]string{
+				"(decl p (ptr (array 2 char)) (nil))",
+				"(decl f (func (params int char) int))",
+				"(decl g (func (params)))",
+			},
+		},
+		{
+			"if a < b { *p = 'x'; } else ;\nwhile a != 0 a = a - 1;\nassert &x[0] == p;",
+			[]string{
+				"(if (binop lt (var a) (var b)) (block (assign (unop deref (var p)) (char 'x'))) (empty))",
+				"(while (binop ne (var a) (int 0)) (assign (var a) (binop sub (var a) (int 1))))",
+				"(assert (binop eq (unop addr (index (var x) (int 0))) (var p)))",
+			},
+		},
+		{
+			"switch x { case 1: x; default: }\nvar a array(2) of int = {1, 2};",
+			[]string{
+				"(switch (var x) (case (int 1) (expr (var x))) (default))",
+				"(decl a (array 2 int) (list (int 1) (int 2)))",
+			},
+		},
+		{
+			"var a array of array of int = {{1}};",
+			[]string{"(decl a (array (array int)) (list (list (int 1))))"},
+		},
+		{
+			"defer x = 1;\ndefer { printf \"a\"; }",
+			[]string{
+				"(defer (assign (var x) (int 1)))",
+				"(defer (block (printf \"a\")))",
+			},
+		},
+		{
+			"printf \"%d%%\\n\";\nprintf \"%c=%d\", c, a + 1;",
+			[]string{
+				"(printf \"%d%%\\n\")",
+				"(printf \"%c=%d\" (var c) (binop add (var a) (int 1)))",
+			},
+		},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmts, err := Parse(tokens)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, stmt := range stmts {
+			out := ast.ToSExpr(stmt)
+			if i >= len(test.out) || out != test.out[i] || ast.ToSExpr(stmt) != out {
+				t.Error(
+					"For", test.in,
+					"expected", test.out,
+					"got", out,
+				)
+			}
+		}
+		if len(stmts) != len(test.out) {
+			t.Error(
+				"For", test.in,
+				"expected", len(test.out), "statements",
+				"got", len(stmts),
+			)
+		}
+	}
+}
+
+func TestNodeAt(t *testing.T) {
+	in := "var x int = a + bc[1];\n\nwhile x { x = -yy; }\ntype Foo int; var y Foo = 0x10;\n" +
+		"printf \"a\\tb\", '\\012';\nprintf `x\ny`;"
+	tokens, err := lexer.Lex("test", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := Parse(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		line, column int
+		out          string
+	}{
+		{1, 18, "(var bc)"},
+		{1, 20, "(int 1)"},
+		{1, 21, "(index (var bc) (int 1))"},
+		{1, 15, "(binop add (var a) (index (var bc) (int 1)))"},
+		{1, 8, "int"},
+		{1, 22, "(decl x int (binop add (var a) (index (var bc) (int 1))))"},
+		{1, 23, ""},
+		{2, 1, ""},
+		{3, 17, "(var yy)"},
+		{3, 15, "(unop neg (var yy))"},
+		{3, 10, "(block (assign (var x) (unop neg (var yy))))"},
+		{3, 3, "(while (var x) (block (assign (var x) (unop neg (var yy)))))"},
+		{4, 21, "(named Foo)"},
+		{4, 23, "(named Foo)"},
+		{4, 30, "(int 0x10)"},
+		{5, 10, "\"a\\tb\""},
+		{5, 13, "\"a\\tb\""},
+		{5, 15, "(printf \"a\\tb\" (char '\\n'))"},
+		{5, 16, "(char '\\n')"},
+		{5, 21, "(char '\\n')"},
+		{5, 22, "(printf \"a\\tb\" (char '\\n'))"},
+		{6, 8, "\"x\\ny\""},
+		{7, 2, "\"x\\ny\""},
+		{7, 3, "(printf \"x\\ny\")"},
+		{7, 4, ""},
+	}
+	for _, test := range tests {
+		pos := token.SourceInformation{FileName: "test", Line: test.line, Column: test.column}
+		node := ast.NodeAt(stmts, pos)
+		out := ""
+		if node != nil {
+			out = ast.ToSExpr(node)
+		}
+		if out != test.out {
+			t.Error(
+				"For", test.line, test.column,
+				"expected", test.out,
+				"got", out,
+			)
+		}
+	}
+}
+
+func TestBlockSpan(t *testing.T) {
+	in := toks(
+		tokAt(token.TokLeftCurly, "{", 1),
+		tokAt(token.TokIdentifier, "abc", 2),
+		tokAt(token.TokSemiColon, ";", 2),
+		tokAt(token.TokRightCurly, "}", 3),
+	)
+	parser := makeParser(in)
+	stmt := parser.statement()
+	block, ok := stmt.(*ast.BlockStatement)
+	if !ok {
+		t.Error(
+			"For", "{ abc; }",
+			"expected", "block",
+			"got", stmt,
+		)
+		return
+	}
+	span := block.Span()
+	if span.Start.Line != 1 || span.End.Line != 3 {
+		t.Error(
+			"For", "{ abc; }",
+			"expected", "span from line 1 to line 3",
+			"got", span.String(),
+		)
+	}
+}
+
+func TestUnarySpan(t *testing.T) {
+	tests := []struct {
+		in    string
+		start int
+	}{
+		{"x = -yy;", 5},
+		{"x = * &y;", 5},
+		{"x = 1 - -y;", 9},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmts, err := Parse(tokens)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr := stmts[0].(*ast.Assignment).Right
+		if bin, ok := expr.(*ast.BinaryOperator); ok {
+			expr = bin.Right
+		}
+		if span := expr.Span(); span.Start.Column != test.start || expr.SourceInfo().Column != test.start {
+			t.Error(
+				"For", test.in,
+				"expected", test.start,
+				"got", span.Start.Column, expr.SourceInfo().Column,
+			)
+		}
+	}
+}
+
+func TestUnclosedSpan(t *testing.T) {
+	tests := []struct {
+		in   string
+		err  string
+		diag string
+	}{
+		{
+			"var a int;\nif a {\n  a = 1;\n  a = 2;\n",
+			"[test:2-4] unexpected end of input after ';', expected '}'",
+			"if a {\n     ^\n  a = 1;\n  a = 2;\n       ^",
+		},
+		{
+			"x = (1 +\n  2;",
+			"[test:1-2] expected ')', got ';'",
+			"x = (1 +\n    ^\n  2;\n   ^",
+		},
+		{
+			"{\na;\nb;\nc;\nd;\ne;",
+			"[test:1-6] unexpected end of input after ';', expected '}'",
+			"{\n^\n...\ne;\n ^",
+		},
+	}
+	for _, test := range tests {
+		tokens, err := lexer.Lex("test", test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Parse(tokens)
+		derr, ok := err.(*diag.Error)
+		if !ok || err.Error() != test.err {
+			t.Error(
+				"For", test.in,
+				"expected", test.err,
+				"got", err,
+			)
+			continue
+		}
+		out := diag.CaretSpan(test.in, token.Span(derr.Source, derr.End), 8)
+		if out != test.diag {
+			t.Error(
+				"For", test.in,
+				"expected", test.diag,
+				"got", out,
+			)
+		}
+	}
+}
+
+func TestMismatchedBrackets(t *testing.T) {
+	tests := []struct {
+		source string
+		in     []*token.Token
+		err    string
+	}{
+		{
+			"(abc]",
+			toks(
+				tokAt(token.TokLeftBracket, "(", 1),
+				tokAt(token.TokIdentifier, "abc", 1),
+				tokAt(token.TokRightSquare, "]", 2),
+				tokAt(token.TokSemiColon, ";", 2),
+			),
+			"[:2] unmatched '(' opened at line 1, found ']' at line 2",
+		},
+		{
+			"{abc;)",
+			toks(
+				tokAt(token.TokLeftCurly, "{", 1),
+				tokAt(token.TokIdentifier, "abc", 1),
+				tokAt(token.TokSemiColon, ";", 1),
+				tokAt(token.TokRightBracket, ")", 3),
+			),
+			"[:3] unmatched '{' opened at line 1, found ')' at line 3",
+		},
+		{
+			"abc[1}",
+			toks(
+				tokAt(token.TokIdentifier, "abc", 1),
+				tokAt(token.TokLeftSquare, "[", 1),
+				tokAt(token.TokInteger, "1", 1),
+				tokAt(token.TokRightCurly, "}", 1),
+				tokAt(token.TokSemiColon, ";", 1),
+			),
+			"[:1] unmatched '[' opened at line 1, found '}' at line 1",
+		},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.in)
+		if err == nil || err.Error() != test.err {
+			t.Error(
+				"For", test.source,
+				"expected", test.err,
+				"got", err,
+			)
+		}
+	}
+}
+
 func tok(typ token.Type, val string) *token.Token {
 	return &token.Token{Type: typ, Value: val}
 }
 
+func tokAt(typ token.Type, val string, line int) *token.Token {
+	return &token.Token{
+		Type:   typ,
+		Value:  val,
+		Source: token.SourceInformation{Line: line},
+	}
+}
+
 func toks(tokens ...*token.Token) []*token.Token {
 	return tokens
 }
 
 func makeParser(input []*token.Token) *parser {
 	return &parser{
-		toks: input,
+		cursor: cursor{toks: input},
+	}
+}
+
+func TestArenaNodes(t *testing.T) {
+	tokens, err := lexer.Lex("test", generateProgram(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withArena := newParser(tokens).program()
+	plain := newParser(tokens)
+	plain.arena = nil
+	withoutArena := plain.program()
+	if len(withArena) != len(withoutArena) {
+		t.Fatal(
+			"For", "generated program",
+			"expected", len(withoutArena), "statements",
+			"got", len(withArena),
+		)
+	}
+	for i := range withArena {
+		if withArena[i].String() != withoutArena[i].String() ||
+			!reflect.DeepEqual(withArena[i], withoutArena[i]) {
+			t.Error(
+				"For", "generated program",
+				"expected", withoutArena[i],
+				"got", withArena[i],
+			)
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	tokens, err := lexer.Lex("bench", generateProgram(1000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(tokens); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// generateProgram generates a program made up of n copies of a loop, with
+// deeply nested expressions.
+func generateProgram(n int) string {
+	var buf strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&buf, "var a%d array(10) of int = {1, 2, 3, 4, 5, 6, 7, 8, 9, 10};\n", i)
+		fmt.Fprintf(&buf, "while i < %d {\n", i)
+		fmt.Fprintf(&buf, "\ta%d[i] = (i + 1) * 2 / 3 - *p + a%d[i - 1] * (x - y * (z + 4));\n", i, i)
+		buf.WriteString("\tif i == 0 { x = &y; } else if i != 1 { x = nil; } else { x = x + 1 + 2 + 3 + 4; }\n")
+		buf.WriteString("}\n")
 	}
+	return buf.String()
 }
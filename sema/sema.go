@@ -0,0 +1,1457 @@
+// Package sema implements semantic analysis on the syntax tree provided by
+// package ast, resolving variables and checking that the program is well
+// typed.
+package sema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cmgn/compiler/arith"
+	"github.com/cmgn/compiler/ast"
+	"github.com/cmgn/compiler/diag"
+	"github.com/cmgn/compiler/optimize"
+	"github.com/cmgn/compiler/token"
+)
+
+// Category identifies a kind of warning, so that warnings can be selected by
+// kind.
+type Category string
+
+// Definitions for the categories of warnings.
+const (
+	// Shadowing is the category of warnings about shadowed declarations.
+	Shadowing Category = "shadow"
+	// Unused is the category of warnings about variables that are never
+	// used.
+	Unused Category = "unused"
+	// SelfComparison is the category of warnings about comparing a value
+	// with itself.
+	SelfComparison Category = "selfcompare"
+	// ConstantCondition is the category of warnings about conditions that
+	// are always true or always false.
+	ConstantCondition Category = "constcond"
+	// MixedComparison is the category of warnings about comparing a char
+	// with an int.
+	MixedComparison Category = "mixedcompare"
+	// SelfAssignment is the category of warnings about assigning a value to
+	// itself.
+	SelfAssignment Category = "selfassign"
+	// NonTerminating is the category of warnings about loops that can
+	// never finish.
+	NonTerminating Category = "noexit"
+	// RedundantCondition is the category of warnings about branches of an
+	// if/else if chain whose condition was already tested earlier in it.
+	RedundantCondition Category = "redundant"
+	// Truncation is the category of warnings about values that are
+	// implicitly narrowed to a smaller type.
+	Truncation Category = "truncate"
+)
+
+// Categories lists every category of warning.
+var Categories = []Category{Shadowing, Unused, SelfComparison, ConstantCondition, MixedComparison, SelfAssignment, NonTerminating, RedundantCondition, Truncation}
+
+// Config holds the options that control which warnings are reported.
+type Config struct {
+	// WarnShadowing warns when a declaration shadows a variable of the same
+	// type declared in the immediately enclosing scope.
+	WarnShadowing bool
+	// WarnUnused warns when a variable is declared but never used.
+	WarnUnused bool
+	// WarnSelfComparison warns when both sides of a comparison are the same
+	// expression.
+	WarnSelfComparison bool
+	// WarnConstantCondition warns when the condition of an if or while
+	// statement is a constant, except for loops that are always entered.
+	WarnConstantCondition bool
+	// WarnInfiniteLoops also warns about while loops whose condition is a
+	// constant true value, if WarnConstantCondition is set.
+	WarnInfiniteLoops bool
+	// WarnMixedComparison warns when a char is compared with an int, other
+	// than a constant in the range of a char.
+	WarnMixedComparison bool
+	// WarnSelfAssignment warns when both sides of an assignment are the same
+	// expression.
+	WarnSelfAssignment bool
+	// WarnNonTerminating warns when a while loop's condition is always true
+	// and nothing in its body can end the loop.
+	WarnNonTerminating bool
+	// WarnRedundantCondition warns when a branch of an if/else if chain
+	// tests the same condition as an earlier branch, so can never be taken.
+	WarnRedundantCondition bool
+	// WarnTruncation warns when an int is assigned to a char, or used to
+	// initialize one, unless it is a constant that a char can hold or
+	// arithmetic on chars and constants. Unlike the other warnings it is
+	// enabled by DefaultConfig.
+	WarnTruncation bool
+	// Strict lists the categories of warnings that are reported as errors
+	// instead.
+	Strict []Category
+}
+
+// DefaultConfig is the configuration used by Check.
+var DefaultConfig = Config{WarnTruncation: true}
+
+// Warning describes something in a valid program that is likely to be a
+// mistake.
+type Warning struct {
+	Source   token.SourceInformation
+	Category Category
+	Message  string
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("[%s] %s", w.Source.String(), w.Message)
+}
+
+// Check checks a program, returning an error describing the first problem
+// encountered or nil if the program is valid.
+func Check(stmts []ast.Statement) error {
+	_, err := CheckWith(stmts, DefaultConfig)
+	return err
+}
+
+// CheckWith checks a program in the same way as Check, but using the options
+// given in cfg. It also returns any warnings found before the first error.
+func CheckWith(stmts []ast.Statement, cfg Config) ([]*Warning, error) {
+	info, err := Analyze(stmts, cfg)
+	return info.Warnings, err
+}
+
+// Info holds what was found out about a program while checking it.
+type Info struct {
+	// Warnings holds the warnings found before the first error.
+	Warnings []*Warning
+	// types maps each expression that was checked to its type.
+	types map[ast.Expression]ast.Type
+}
+
+// TypeOf gets the type of an expression in the checked program, or nil if
+// the expression wasn't checked.
+func (i *Info) TypeOf(expr ast.Expression) ast.Type {
+	return i.types[expr]
+}
+
+// Analyze checks a program in the same way as CheckWith, and also records the
+// type of every expression so that later passes don't have to work them out
+// again. The Info is returned even if the program is invalid, holding what
+// was found before the first error.
+func Analyze(stmts []ast.Statement, cfg Config) (*Info, error) {
+	checker := &checker{
+		config: cfg,
+		types:  make(map[ast.Expression]ast.Type),
+	}
+	checker.push()
+	if checker.defineTypes(stmts) {
+		for _, stmt := range stmts {
+			if !checker.statement(stmt) || checker.err != nil {
+				break
+			}
+		}
+	}
+	checker.pop()
+	return &Info{Warnings: checker.warnings, types: checker.types}, checker.err
+}
+
+// CheckExpression checks an expression on its own, with no variables in
+// scope, and returns its type.
+func CheckExpression(expr ast.Expression) (ast.Type, error) {
+	checker := &checker{}
+	checker.push()
+	typ := checker.expression(expr)
+	if checker.err != nil {
+		return nil, checker.err
+	}
+	return typ, nil
+}
+
+// checker holds the state of the semantic analysis.
+type checker struct {
+	// scopes holds the declarations of the variables in scope, innermost
+	// last.
+	scopes []map[string]*ast.Declaration
+	// used holds the declarations that have been referred to.
+	used map[*ast.Declaration]bool
+	// deferring is the deferred statement being checked, if there is one,
+	// and deferScope is the index of the scope it was deferred in.
+	deferring  *ast.DeferStatement
+	deferScope int
+	// deferredUses maps the names that deferred statements refer to from
+	// outside their scope to the statements, for each scope.
+	deferredUses []map[string]*ast.DeferStatement
+	// loops holds the loops whose bodies are being checked, innermost
+	// last, and labels holds the labeled statements being checked. A
+	// break or continue can only leave a loop in loops.
+	loops  []*ast.WhileStatement
+	labels []*ast.LabeledStatement
+	// typeDecls maps the names of the types declared by the program to
+	// their declarations.
+	typeDecls map[string]*ast.TypeDeclaration
+	// config holds the options the checker was created with.
+	config Config
+	// warnings holds the warnings found so far.
+	warnings []*Warning
+	// types holds the type of each expression checked so far, if they are
+	// being recorded.
+	types map[ast.Expression]ast.Type
+	// err is the error if one has been encountered, nil otherwise.
+	err error
+}
+
+// intType is the type given to integer literals and arithmetic results.
+var intType = &ast.Primitive{Type: ast.IntType}
+
+// charType is the type given to character literals.
+var charType = &ast.Primitive{Type: ast.CharType}
+
+// nilType is the type given to the nil literal. It is a pointer to nothing,
+// and can be assigned to or compared with any pointer.
+var nilType = &ast.PointerType{}
+
+// push enters a new scope.
+func (c *checker) push() {
+	c.scopes = append(c.scopes, make(map[string]*ast.Declaration))
+	c.deferredUses = append(c.deferredUses, nil)
+}
+
+// pop leaves the innermost scope, warning about any of its variables that
+// were never used.
+func (c *checker) pop() {
+	scope := c.scopes[len(c.scopes)-1]
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.deferredUses = c.deferredUses[:len(c.deferredUses)-1]
+	if !c.config.WarnUnused || c.err != nil {
+		return
+	}
+	var unused []*ast.Declaration
+	for _, decl := range scope {
+		if !c.used[decl] {
+			unused = append(unused, decl)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		a, b := unused[i].SourceInfo(), unused[j].SourceInfo()
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	for _, decl := range unused {
+		c.warn(decl.SourceInfo(), Unused, "%s declared but never used", decl.Name)
+	}
+}
+
+// defineTypes checks the type declarations at the top level of a program,
+// which can be used anywhere in the program, including before they are
+// declared. Every name is resolved before anything is sized, since a type
+// can refer to types declared after it.
+func (c *checker) defineTypes(stmts []ast.Statement) bool {
+	c.typeDecls = make(map[string]*ast.TypeDeclaration)
+	var decls []*ast.TypeDeclaration
+	for _, stmt := range stmts {
+		decl, ok := stmt.(*ast.TypeDeclaration)
+		if !ok {
+			continue
+		}
+		if prev, ok := c.typeDecls[decl.Name]; ok {
+			c.error(decl.SourceInfo(), "type %s already declared at %s",
+				decl.Name, prev.SourceInfo().String())
+			return false
+		}
+		c.typeDecls[decl.Name] = decl
+		decls = append(decls, decl)
+	}
+	for _, decl := range decls {
+		if !c.resolved(decl.Type) {
+			return false
+		}
+	}
+	for _, decl := range decls {
+		path := map[*ast.TypeDeclaration]bool{decl: true}
+		if !c.finite(decl.Type, path) {
+			return false
+		}
+	}
+	for _, decl := range decls {
+		if !c.inferLength(decl.Type, nil) || !c.sizedElements(decl.Type) {
+			return false
+		}
+	}
+	return true
+}
+
+// finite checks that a type doesn't contain a type declared in path by
+// value, following named types to their declarations, which are added to
+// path. A type that contained itself would take up infinite space, so a type
+// can only refer to itself through a pointer or a function, which are the
+// same size whatever they refer to.
+func (c *checker) finite(typ ast.Type, path map[*ast.TypeDeclaration]bool) bool {
+	switch typ := typ.(type) {
+	case *ast.NamedType:
+		decl := c.typeDecls[typ.Name]
+		if path[decl] {
+			c.error(typ.SourceInfo(), "recursive type must be through a pointer")
+			return false
+		}
+		path[decl] = true
+		defer delete(path, decl)
+		return c.finite(decl.Type, path)
+	case *ast.ArrayType:
+		return c.finite(typ.Type, path)
+	case *ast.StructType:
+		for _, field := range typ.Fields {
+			if !c.finite(field.Type, path) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// declare adds a variable to the innermost scope. Declarations may appear
+// anywhere in a block, and are visible from the statement after them to the
+// end of the block. Before that, including in its own initializer, the name
+// refers to any variable of the same name in an outer scope.
+func (c *checker) declare(decl *ast.Declaration) bool {
+	scope := c.scopes[len(c.scopes)-1]
+	if _, ok := scope[decl.Name]; ok {
+		c.error(decl.SourceInfo(), "redeclaration of %s", decl.Name)
+		return false
+	}
+	if deferred, ok := c.deferredUses[len(c.scopes)-1][decl.Name]; ok {
+		c.error(decl.SourceInfo(), "declaration of %s after the deferred statement at %s that uses it",
+			decl.Name, deferred.SourceInfo().String())
+		return false
+	}
+	if c.config.WarnShadowing && len(c.scopes) > 1 {
+		outer, ok := c.scopes[len(c.scopes)-2][decl.Name]
+		if ok && sameType(outer.Type, decl.Type) {
+			c.warn(decl.SourceInfo(), Shadowing, "declaration of %s shadows declaration at %s",
+				decl.Name, outer.SourceInfo().String())
+		}
+	}
+	scope[decl.Name] = decl
+	return true
+}
+
+// lookup finds the type of a variable, searching from the innermost scope
+// outwards.
+func (c *checker) lookup(name string) (ast.Type, bool) {
+	if c.deferring != nil {
+		c.useDeferred(name)
+	}
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if decl, ok := c.scopes[i][name]; ok {
+			if c.used == nil {
+				c.used = make(map[*ast.Declaration]bool)
+			}
+			c.used[decl] = true
+			return decl.Type, true
+		}
+	}
+	return nil, false
+}
+
+// useDeferred records that the statement being deferred refers to a name,
+// unless the name is declared within the deferred statement itself. The
+// statement runs at the end of its scope, so a later declaration of the name
+// in that scope must be prevented.
+func (c *checker) useDeferred(name string) {
+	for i := len(c.scopes) - 1; i > c.deferScope; i-- {
+		if _, ok := c.scopes[i][name]; ok {
+			return
+		}
+	}
+	uses := c.deferredUses[c.deferScope]
+	if uses == nil {
+		uses = make(map[string]*ast.DeferStatement)
+		c.deferredUses[c.deferScope] = uses
+	}
+	if _, ok := uses[name]; !ok {
+		uses[name] = c.deferring
+	}
+}
+
+// error sets the err field using a format string, prefixed by the source
+// information. Only the first error is kept.
+func (c *checker) error(source *token.SourceInformation, format string, args ...interface{}) {
+	if c.err == nil {
+		c.err = diag.Errorf(*source, format, args...)
+	}
+}
+
+// warn records a warning using a format string, or reports it as an error if
+// its category is strict.
+func (c *checker) warn(source *token.SourceInformation, category Category, format string, args ...interface{}) {
+	for _, strict := range c.config.Strict {
+		if strict == category {
+			c.error(source, format, args...)
+			return
+		}
+	}
+	c.warnings = append(c.warnings, &Warning{
+		Source:   *source,
+		Category: category,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// statement checks a statement, returning false if it is invalid.
+func (c *checker) statement(stmt ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.Empty:
+		return true
+	case *ast.ExpressionStatement:
+		return c.expression(stmt.Expression) != nil
+	case *ast.Declaration:
+		if !c.resolved(stmt.Type) || !c.inferLength(stmt.Type, stmt.Value) || !c.sizedElements(stmt.Type) {
+			return false
+		}
+		if stmt.Value != nil && !c.initializer(stmt.Type, stmt.Value) {
+			return false
+		}
+		return c.declare(stmt)
+	case *ast.TypeDeclaration:
+		// Type declarations are checked before anything else, so
+		// that types can be used before they are declared.
+		if len(c.scopes) > 1 {
+			c.error(stmt.SourceInfo(), "type %s must be declared at the top level", stmt.Name)
+			return false
+		}
+		return true
+	case *ast.Assignment:
+		left := c.expression(stmt.Left)
+		if left == nil {
+			return false
+		}
+		right := c.expression(stmt.Right)
+		if right == nil {
+			return false
+		}
+		if !isLvalue(stmt.Left) {
+			c.error(stmt.SourceInfo(), "cannot assign to non-lvalue")
+			return false
+		}
+		if !assignable(left, right) {
+			c.assignError(stmt.SourceInfo(), left, right)
+			return false
+		}
+		if c.config.WarnSelfAssignment {
+			c.selfAssignment(stmt)
+		}
+		if c.config.WarnTruncation {
+			c.truncation(stmt.Right, left, right)
+		}
+		return true
+	case *ast.IfStatement:
+		if !c.condition(stmt.Condition) {
+			return false
+		}
+		c.constantCondition(stmt.Condition, false)
+		if c.config.WarnRedundantCondition {
+			c.redundantCondition(stmt)
+		}
+		return c.body(stmt.Statement1) && c.body(stmt.Statement2)
+	case *ast.WhileStatement:
+		if !c.condition(stmt.Condition) {
+			return false
+		}
+		c.constantCondition(stmt.Condition, true)
+		c.loops = append(c.loops, stmt)
+		ok := c.body(stmt.Statement)
+		c.loops = c.loops[:len(c.loops)-1]
+		if !ok {
+			return false
+		}
+		if c.config.WarnNonTerminating {
+			c.nonTerminating(stmt)
+		}
+		return stmt.Else == nil || c.body(stmt.Else)
+	case *ast.AssertStatement:
+		return c.condition(stmt.Condition)
+	case *ast.PrintfStatement:
+		return c.printfStatement(stmt)
+	case *ast.DeferStatement:
+		// A deferred declaration would go out of scope as soon as it was
+		// made.
+		if _, ok := stmt.Statement.(*ast.Declaration); ok {
+			c.error(stmt.SourceInfo(), "cannot defer a declaration")
+			return false
+		}
+		// A deferred statement runs once its scope has been left, by
+		// which time it is too late to leave a loop.
+		outer, outerScope, loops := c.deferring, c.deferScope, c.loops
+		c.deferring, c.deferScope, c.loops = stmt, len(c.scopes)-1, nil
+		ok := c.statement(stmt.Statement)
+		c.deferring, c.deferScope, c.loops = outer, outerScope, loops
+		return ok
+	case *ast.SwitchStatement:
+		return c.switchStatement(stmt)
+	case *ast.LabeledStatement:
+		for _, outer := range c.labels {
+			if outer.Label == stmt.Label {
+				c.error(stmt.SourceInfo(), "label %s already defined at %s",
+					stmt.Label, outer.SourceInfo().String())
+				return false
+			}
+		}
+		c.labels = append(c.labels, stmt)
+		defer func() { c.labels = c.labels[:len(c.labels)-1] }()
+		return c.statement(stmt.Statement)
+	case *ast.BreakStatement:
+		return c.branch(stmt.SourceInfo(), "break", stmt.Label)
+	case *ast.ContinueStatement:
+		return c.branch(stmt.SourceInfo(), "continue", stmt.Label)
+	case *ast.BlockStatement:
+		c.push()
+		defer c.pop()
+		for _, inner := range stmt.Statements {
+			if !c.statement(inner) {
+				return false
+			}
+		}
+		return true
+	}
+	panic("unhandled statement type")
+}
+
+// body checks the body of an if or while statement. A body is always a scope
+// of its own, even without braces, so a variable declared by it can't be used
+// after the statement. A block already makes a scope, so isn't given another.
+func (c *checker) body(stmt ast.Statement) bool {
+	if _, ok := stmt.(*ast.BlockStatement); !ok {
+		c.push()
+		defer c.pop()
+	}
+	return c.statement(stmt)
+}
+
+// branch checks that a break or continue statement is inside the loop it
+// leaves, which is either the innermost loop or the loop with the given label.
+func (c *checker) branch(source *token.SourceInformation, keyword, label string) bool {
+	if label == "" {
+		if len(c.loops) == 0 {
+			c.error(source, "%s outside of a loop", keyword)
+			return false
+		}
+		return true
+	}
+	for i := len(c.labels) - 1; i >= 0; i-- {
+		if c.labels[i].Label != label {
+			continue
+		}
+		for _, loop := range c.loops {
+			if c.labels[i].Statement == loop {
+				return true
+			}
+		}
+		c.error(source, "label %s does not name an enclosing loop", label)
+		return false
+	}
+	c.error(source, "undefined label %s", label)
+	return false
+}
+
+// printfStatement checks that the arguments of a printf statement match the
+// verbs in its format string. Both %d and %c take an int or a char, and %%
+// takes no argument.
+func (c *checker) printfStatement(stmt *ast.PrintfStatement) bool {
+	var verbs []byte
+	for i := 0; i < len(stmt.Format.Value); i++ {
+		if stmt.Format.Value[i] != '%' {
+			continue
+		}
+		i++
+		if i == len(stmt.Format.Value) {
+			c.error(stmt.SourceInfo(), "printf format %q ends with %%", stmt.Format.Value)
+			return false
+		}
+		switch verb := stmt.Format.Value[i]; verb {
+		case '%':
+		case 'd', 'c':
+			verbs = append(verbs, verb)
+		default:
+			c.error(stmt.SourceInfo(), "unknown printf verb %%%c", verb)
+			return false
+		}
+	}
+	if len(verbs) != len(stmt.Arguments) {
+		c.error(stmt.SourceInfo(), "printf format %q needs %d arguments, got %d",
+			stmt.Format.Value, len(verbs), len(stmt.Arguments))
+		return false
+	}
+	for i, arg := range stmt.Arguments {
+		typ := c.expression(arg)
+		if typ == nil {
+			return false
+		}
+		if _, ok := typ.(*ast.Primitive); !ok {
+			c.error(arg.SourceInfo(), "printf verb %%%c needs int or char, not %s",
+				verbs[i], TypeName(typ))
+			return false
+		}
+	}
+	return true
+}
+
+// switchStatement checks a switch statement. The value being switched on must
+// be a primitive, and the cases must be distinct constants of the same type,
+// so a switch on a char has char cases.
+func (c *checker) switchStatement(stmt *ast.SwitchStatement) bool {
+	value := c.expression(stmt.Value)
+	if value == nil {
+		return false
+	}
+	if _, ok := value.(*ast.Primitive); !ok {
+		c.error(stmt.Value.SourceInfo(), "cannot switch on %s", TypeName(value))
+		return false
+	}
+	seen := make(map[int64]ast.Expression)
+	for _, sc := range stmt.Cases {
+		if sc.Value != nil {
+			caseType := c.expression(sc.Value)
+			if caseType == nil {
+				return false
+			}
+			if !sameType(caseType, value) {
+				c.error(sc.Value.SourceInfo(), "cannot use %s case %s in switch on %s",
+					TypeName(caseType), ast.FormatExpression(sc.Value), TypeName(value))
+				return false
+			}
+			folded := optimize.Fold(sc.Value)
+			val, ok := constantValue(folded)
+			if !ok {
+				c.error(sc.Value.SourceInfo(), "case %s is not constant", ast.FormatExpression(sc.Value))
+				return false
+			}
+			if prev, ok := seen[val]; ok {
+				c.error(sc.Value.SourceInfo(), "duplicate case %s in switch, previously at %s",
+					folded.String(), prev.SourceInfo().String())
+				return false
+			}
+			seen[val] = sc.Value
+		}
+		c.push()
+		for _, inner := range sc.Statements {
+			if !c.statement(inner) {
+				c.pop()
+				return false
+			}
+		}
+		c.pop()
+	}
+	return true
+}
+
+// constantValue gets the value of a folded expression if it is a constant.
+func constantValue(expr ast.Expression) (int64, bool) {
+	switch expr := expr.(type) {
+	case *ast.Integer:
+		val, err := expr.Int64()
+		return val, err == nil
+	case *ast.Character:
+		return int64(expr.Value), true
+	}
+	return 0, false
+}
+
+// initializer checks the initial value of a declaration of the given type.
+// An array literal must have one element for each element of the array, and
+// each element must be assignable to the array's element type. An empty
+// literal is allowed for any array.
+func (c *checker) initializer(typ ast.Type, value ast.Expression) bool {
+	lit, ok := value.(*ast.ArrayLiteral)
+	if !ok {
+		valueType := c.expression(value)
+		if valueType == nil {
+			return false
+		}
+		if !assignable(typ, valueType) {
+			c.assignError(value.SourceInfo(), typ, valueType)
+			return false
+		}
+		if c.config.WarnTruncation {
+			c.truncation(value, typ, valueType)
+		}
+		return true
+	}
+	arr, ok := ast.Underlying(typ).(*ast.ArrayType)
+	if !ok {
+		c.error(lit.SourceInfo(), "cannot use array literal as %s", TypeName(typ))
+		return false
+	}
+	if c.types != nil {
+		c.types[lit] = arr
+	}
+	if len(lit.Elements) != 0 && len(lit.Elements) != arr.Length {
+		c.error(lit.SourceInfo(), "array literal has %d elements, expected %d",
+			len(lit.Elements), arr.Length)
+		return false
+	}
+	for _, elem := range lit.Elements {
+		if !c.initializer(arr.Type, elem) {
+			return false
+		}
+	}
+	return true
+}
+
+// constantCondition warns if the condition of an if or while statement
+// always has the same value once folded. A loop whose condition is always
+// true is the usual way to loop forever, so it is only reported if
+// WarnInfiniteLoops is set.
+func (c *checker) constantCondition(cond ast.Expression, loop bool) {
+	if !c.config.WarnConstantCondition {
+		return
+	}
+	val, ok := constantValue(optimize.Fold(cond))
+	if !ok || (loop && val != 0 && !c.config.WarnInfiniteLoops) {
+		return
+	}
+	result := "true"
+	if val == 0 {
+		result = "false"
+	}
+	c.warn(cond.SourceInfo(), ConstantCondition, "condition %s is always %s", ast.FormatExpression(cond), result)
+}
+
+// nonTerminating warns if a while loop can never finish, because its condition
+// is always true and nothing in its body can end it. The only ways out of
+// such a loop are a break and an assertion failing, so a loop containing an
+// assertion that might fail is taken to end that way on purpose.
+func (c *checker) nonTerminating(stmt *ast.WhileStatement) {
+	if val, ok := constantValue(optimize.Fold(stmt.Condition)); !ok || val == 0 ||
+		mayExit(stmt.Statement, false, make(map[string]bool)) {
+		return
+	}
+	c.warn(stmt.SourceInfo(), NonTerminating, "loop with condition %s never terminates",
+		ast.FormatExpression(stmt.Condition))
+}
+
+// mayExit checks if running a statement could end the loop around it. nested
+// says whether the statement is inside another loop within that one, which
+// an unlabeled break would leave instead, and labels holds the labels within
+// the loop, which a labeled break can't name to leave it.
+func mayExit(stmt ast.Statement, nested bool, labels map[string]bool) bool {
+	switch stmt := stmt.(type) {
+	case *ast.AssertStatement:
+		val, ok := constantValue(optimize.Fold(stmt.Condition))
+		return !ok || val == 0
+	case *ast.BreakStatement:
+		if stmt.Label == "" {
+			return !nested
+		}
+		return !labels[stmt.Label]
+	case *ast.IfStatement:
+		return mayExit(stmt.Statement1, nested, labels) || mayExit(stmt.Statement2, nested, labels)
+	case *ast.WhileStatement:
+		return mayExit(stmt.Statement, true, labels) ||
+			(stmt.Else != nil && mayExit(stmt.Else, nested, labels))
+	case *ast.LabeledStatement:
+		// Labels can't be redefined inside themselves, so the label
+		// isn't already in labels.
+		labels[stmt.Label] = true
+		defer delete(labels, stmt.Label)
+		return mayExit(stmt.Statement, nested, labels)
+	case *ast.DeferStatement:
+		return mayExit(stmt.Statement, nested, labels)
+	case *ast.BlockStatement:
+		for _, inner := range stmt.Statements {
+			if mayExit(inner, nested, labels) {
+				return true
+			}
+		}
+	case *ast.SwitchStatement:
+		for _, sc := range stmt.Cases {
+			for _, inner := range sc.Statements {
+				if mayExit(inner, nested, labels) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// inferLength fills in the lengths left out of the array types in a
+// declared type from the array literal initializing it, which may be nil. The
+// length of a nested array is taken from the first element of the literal.
+func (c *checker) inferLength(typ ast.Type, value ast.Expression) bool {
+	switch typ := typ.(type) {
+	case *ast.ArrayType:
+		lit, ok := value.(*ast.ArrayLiteral)
+		if typ.Length == ast.UnknownLength {
+			if !ok || len(lit.Elements) == 0 {
+				c.error(typ.SourceInfo(), "cannot infer length of %s without a non-empty array literal",
+					TypeName(typ))
+				return false
+			}
+			typ.Length = len(lit.Elements)
+		}
+		var elem ast.Expression
+		if ok && len(lit.Elements) > 0 {
+			elem = lit.Elements[0]
+		}
+		return c.inferLength(typ.Type, elem)
+	case *ast.PointerType:
+		return c.inferLength(typ.Type, nil)
+	case *ast.FunctionType:
+		for _, param := range typ.Parameters {
+			if !c.inferLength(param, nil) {
+				return false
+			}
+		}
+		if typ.Return != nil {
+			return c.inferLength(typ.Return, nil)
+		}
+	case *ast.StructType:
+		for _, field := range typ.Fields {
+			if !c.inferLength(field.Type, nil) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// resolved checks that every part of a declared type is either a concrete
+// type or the name of a declared type, so that its size can be computed.
+// Names are linked to the types they are declared as. It must be called
+// before anything asks for the size of the type.
+func (c *checker) resolved(typ ast.Type) bool {
+	switch typ := typ.(type) {
+	case *ast.NamedType:
+		decl, ok := c.typeDecls[typ.Name]
+		if !ok {
+			c.error(typ.SourceInfo(), "undefined type %s", typ.Name)
+			return false
+		}
+		typ.Type = decl.Type
+		return true
+	case *ast.ArrayType:
+		if typ.Type == nil {
+			c.error(typ.SourceInfo(), "array element type does not resolve")
+			return false
+		}
+		return c.resolved(typ.Type)
+	case *ast.PointerType:
+		if typ.Type == nil {
+			c.error(typ.SourceInfo(), "pointed to type does not resolve")
+			return false
+		}
+		return c.resolved(typ.Type)
+	case *ast.FunctionType:
+		for _, param := range typ.Parameters {
+			if !c.resolved(param) {
+				return false
+			}
+		}
+		if typ.Return != nil {
+			return c.resolved(typ.Return)
+		}
+	case *ast.StructType:
+		seen := make(map[string]*ast.StructField)
+		for _, field := range typ.Fields {
+			if prev, ok := seen[field.Name]; ok {
+				c.error(&field.Source, "field %s already defined at %s",
+					field.Name, prev.Source.String())
+				return false
+			}
+			seen[field.Name] = field
+			if !c.resolved(field.Type) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sizedElements checks that the element type of every array in a declared
+// type, however deeply nested, has a positive size. An array of zero-sized
+// elements would take no space whatever its length. The type must have been
+// resolved and its lengths inferred.
+func (c *checker) sizedElements(typ ast.Type) bool {
+	switch typ := typ.(type) {
+	case *ast.ArrayType:
+		if typ.Type.Size() <= 0 {
+			c.error(typ.SourceInfo(), "array of zero-sized type %s", TypeName(typ.Type))
+			return false
+		}
+		return c.sizedElements(typ.Type)
+	case *ast.PointerType:
+		return c.sizedElements(typ.Type)
+	case *ast.FunctionType:
+		for _, param := range typ.Parameters {
+			if !c.sizedElements(param) {
+				return false
+			}
+		}
+		if typ.Return != nil {
+			return c.sizedElements(typ.Return)
+		}
+	case *ast.StructType:
+		for _, field := range typ.Fields {
+			if !c.sizedElements(field.Type) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// condition checks the condition of an if or while statement, which must be
+// a scalar.
+func (c *checker) condition(cond ast.Expression) bool {
+	typ := c.expression(cond)
+	if typ == nil {
+		return false
+	}
+	switch typ.(type) {
+	case *ast.ArrayType, *ast.StructType:
+		c.error(cond.SourceInfo(), "cannot use %s as condition", TypeName(typ))
+		return false
+	}
+	return true
+}
+
+// expression computes the type of an expression, returning nil if it
+// is invalid. A named type is replaced by the type it is declared as.
+func (c *checker) expression(expr ast.Expression) ast.Type {
+	typ := c.expressionType(expr)
+	if typ != nil {
+		typ = ast.Underlying(typ)
+	}
+	if typ != nil && c.types != nil {
+		c.types[expr] = typ
+	}
+	return typ
+}
+
+// expressionType computes the type of an expression for expression.
+func (c *checker) expressionType(expr ast.Expression) ast.Type {
+	switch expr := expr.(type) {
+	case *ast.Integer:
+		return intType
+	case *ast.Character:
+		return charType
+	case *ast.NilLiteral:
+		return nilType
+	case *ast.Variable:
+		typ, ok := c.lookup(expr.Value)
+		if !ok {
+			c.error(expr.SourceInfo(), "undeclared variable %s", expr.Value)
+			return nil
+		}
+		return typ
+	case *ast.BinaryOperator:
+		return c.binaryOperator(expr)
+	case *ast.UnaryOperator:
+		return c.unaryOperator(expr)
+	case *ast.Subscript:
+		value := c.expression(expr.Value)
+		if value == nil {
+			return nil
+		}
+		index := c.expression(expr.Index)
+		if index == nil {
+			return nil
+		}
+		arr, ok := value.(*ast.ArrayType)
+		if !ok {
+			c.error(expr.SourceInfo(), "cannot subscript non-array type %s",
+				TypeName(value))
+			return nil
+		}
+		// A char index widens to int, indexing by its unsigned value.
+		if _, ok := index.(*ast.Primitive); !ok {
+			c.error(expr.Index.SourceInfo(), "array index must be int, not %s",
+				TypeName(index))
+			return nil
+		}
+		// Indices that aren't constant are checked when the program
+		// runs.
+		if val, ok := constantValue(optimize.Fold(expr.Index)); ok && arr.Length != ast.UnknownLength &&
+			(val < 0 || val >= int64(arr.Length)) {
+			c.error(expr.Index.SourceInfo(), "index %d out of range for %s", val, TypeName(arr))
+			return nil
+		}
+		return arr.Type
+	case *ast.FieldAccess:
+		value := c.expression(expr.Value)
+		if value == nil {
+			return nil
+		}
+		st, ok := value.(*ast.StructType)
+		if !ok {
+			c.error(expr.SourceInfo(), "cannot access field %s of non-struct type %s",
+				expr.Field, TypeName(value))
+			return nil
+		}
+		for _, field := range st.Fields {
+			if field.Name == expr.Field {
+				return field.Type
+			}
+		}
+		c.error(expr.SourceInfo(), "%s has no field %s", TypeName(value), expr.Field)
+		return nil
+	case *ast.ArrayLiteral:
+		c.error(expr.SourceInfo(), "array literal can only initialize a declaration")
+		return nil
+	case *ast.StatementExpression:
+		// The statements are scoped like a block, with the value
+		// inside the scope. They can't leave a loop outside of the
+		// expression.
+		c.push()
+		loops := c.loops
+		c.loops = nil
+		defer func() {
+			c.loops = loops
+			c.pop()
+		}()
+		for _, stmt := range expr.Statements {
+			if !c.statement(stmt) {
+				return nil
+			}
+		}
+		return c.expression(expr.Value)
+	}
+	panic("unhandled expression type")
+}
+
+// binaryOperator computes the type of a binary operator expression. All of
+// the operators produce an int and require primitive operands, except that
+// pointers of the same type may be compared for equality.
+func (c *checker) binaryOperator(expr *ast.BinaryOperator) ast.Type {
+	left := c.expression(expr.Left)
+	if left == nil {
+		return nil
+	}
+	right := c.expression(expr.Right)
+	if right == nil {
+		return nil
+	}
+	if c.config.WarnSelfComparison {
+		c.selfComparison(expr)
+	}
+	if c.config.WarnMixedComparison {
+		c.mixedComparison(expr, left, right)
+	}
+	isEquality := expr.Type == ast.BinaryEqual || expr.Type == ast.BinaryNotEqual
+	if isEquality && isPointer(left) && (assignable(left, right) || assignable(right, left)) {
+		return intType
+	}
+	if typ := pointerArithmetic(expr.Type, left, right); typ != nil {
+		return typ
+	}
+	_, leftOk := left.(*ast.Primitive)
+	_, rightOk := right.(*ast.Primitive)
+	if !leftOk || !rightOk {
+		c.error(expr.SourceInfo(), "invalid operands to %s: %s and %s",
+			expr.Type.String(), TypeName(left), TypeName(right))
+		return nil
+	}
+	return intType
+}
+
+// pointerArithmetic computes the type of adding an integer to a pointer,
+// subtracting one from a pointer, or subtracting two pointers of the same type,
+// which gives the number of elements between them. It gives nil for any other
+// operator or operands. nil points to nothing, so it can't take part.
+func pointerArithmetic(op ast.BinaryOperatorType, left, right ast.Type) ast.Type {
+	if left == nilType || right == nilType {
+		return nil
+	}
+	_, leftInt := left.(*ast.Primitive)
+	_, rightInt := right.(*ast.Primitive)
+	switch {
+	case op == ast.BinaryAdd && isPointer(left) && rightInt:
+		return left
+	case op == ast.BinaryAdd && leftInt && isPointer(right):
+		return right
+	case op == ast.BinarySub && isPointer(left) && rightInt:
+		return left
+	case op == ast.BinarySub && isPointer(left) && sameType(left, right):
+		return intType
+	}
+	return nil
+}
+
+// selfComparison warns if a comparison has the same operand on both sides,
+// which makes its result constant. Operands that might have side effects are
+// not flagged, since evaluating them twice could give different values.
+func (c *checker) selfComparison(expr *ast.BinaryOperator) {
+	var result string
+	switch expr.Type {
+	case ast.BinaryEqual:
+		result = "true"
+	case ast.BinaryNotEqual, ast.BinaryLessThan, ast.BinaryGreaterThan:
+		result = "false"
+	default:
+		return
+	}
+	if pure(expr.Left) && ast.Equal(expr.Left, expr.Right) {
+		c.warn(expr.SourceInfo(), SelfComparison, "comparison of %s with itself is always %s",
+			ast.FormatExpression(expr.Left), result)
+	}
+}
+
+// selfAssignment warns if an assignment stores a value back where it was
+// read from, which does nothing. As with selfComparison, sides that might
+// have side effects are not flagged.
+func (c *checker) selfAssignment(stmt *ast.Assignment) {
+	if pure(stmt.Left) && ast.Equal(stmt.Left, stmt.Right) {
+		c.warn(stmt.SourceInfo(), SelfAssignment, "assignment of %s to itself",
+			ast.FormatExpression(stmt.Left))
+	}
+}
+
+// redundantCondition warns if a later branch of the if/else if chain starting
+// at stmt tests the same condition as stmt does, since that branch can only
+// be reached when the condition is false. Only the first such branch is
+// flagged, as it is compared with the later ones in turn. Chains where a
+// condition might have side effects are not flagged.
+func (c *checker) redundantCondition(stmt *ast.IfStatement) {
+	if !pure(stmt.Condition) {
+		return
+	}
+	for next := elseIf(stmt); next != nil && pure(next.Condition); next = elseIf(next) {
+		if ast.Equal(stmt.Condition, next.Condition) {
+			c.warn(next.SourceInfo(), RedundantCondition,
+				"condition %s was already tested at line %d", ast.FormatExpression(next.Condition),
+				stmt.SourceInfo().Line)
+			return
+		}
+	}
+}
+
+// elseIf finds the if statement that continues an if/else if chain, which is
+// the else branch, or the only statement of an else block.
+func elseIf(stmt *ast.IfStatement) *ast.IfStatement {
+	next := stmt.Statement2
+	if block, ok := next.(*ast.BlockStatement); ok && len(block.Statements) == 1 {
+		next = block.Statements[0]
+	}
+	ifStmt, _ := next.(*ast.IfStatement)
+	return ifStmt
+}
+
+// truncation warns if a value of type src is stored in a variable of the
+// narrower type dst, which keeps only its low bits. As with mixedComparison,
+// constants that a char can hold are allowed, so that c = 10 isn't flagged.
+// Arithmetic on chars gives an int, but storing it back in a char is the
+// usual way of working with them, so c = c + 1 isn't flagged either.
+func (c *checker) truncation(value ast.Expression, dst, src ast.Type) {
+	if !isPrimitive(dst, ast.CharType) || !isPrimitive(src, ast.IntType) {
+		return
+	}
+	if val, ok := constantValue(optimize.Fold(value)); ok {
+		if val >= 0 && val <= arith.MaxChar {
+			return
+		}
+	} else if c.charArithmetic(value) {
+		return
+	}
+	c.warn(value.SourceInfo(), Truncation,
+		"int %s is truncated to char, keeping only its low 8 bits", ast.FormatExpression(value))
+}
+
+// charArithmetic checks if an expression is arithmetic whose operands are
+// each a char, a constant or more such arithmetic.
+func (c *checker) charArithmetic(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.BinaryOperator:
+		switch expr.Type {
+		case ast.BinaryAdd, ast.BinarySub, ast.BinaryMul, ast.BinaryDiv:
+			return c.charOperand(expr.Left) && c.charOperand(expr.Right)
+		}
+	case *ast.UnaryOperator:
+		return expr.Type == ast.UnaryMinus && c.charOperand(expr.Value)
+	}
+	return false
+}
+
+// charOperand checks if an operand of charArithmetic is a char, a constant or
+// more such arithmetic.
+func (c *checker) charOperand(expr ast.Expression) bool {
+	if _, ok := constantValue(optimize.Fold(expr)); ok {
+		return true
+	}
+	return isPrimitive(c.types[expr], ast.CharType) || c.charArithmetic(expr)
+}
+
+// mixedComparison warns if a comparison has a char on one side and an int on
+// the other, since the char is widened to an int before they are compared.
+// Constants that a char can hold are allowed, so that c == 0 isn't flagged.
+func (c *checker) mixedComparison(expr *ast.BinaryOperator, left, right ast.Type) {
+	switch expr.Type {
+	case ast.BinaryEqual, ast.BinaryNotEqual, ast.BinaryLessThan, ast.BinaryGreaterThan:
+	default:
+		return
+	}
+	char, other := expr.Left, expr.Right
+	if isPrimitive(right, ast.CharType) {
+		char, other = other, char
+		left, right = right, left
+	}
+	if !isPrimitive(left, ast.CharType) || !isPrimitive(right, ast.IntType) {
+		return
+	}
+	if val, ok := constantValue(optimize.Fold(other)); ok && val >= 0 && val <= arith.MaxChar {
+		return
+	}
+	c.warn(expr.SourceInfo(), MixedComparison,
+		"comparison of char %s with int %s widens %s to int",
+		ast.FormatExpression(char), ast.FormatExpression(other), ast.FormatExpression(char))
+}
+
+// pure checks if evaluating an expression can't have side effects. Only the
+// kinds of expression known to be pure are accepted.
+func pure(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.Integer, *ast.Character, *ast.NilLiteral, *ast.Variable:
+		return true
+	case *ast.BinaryOperator:
+		return pure(expr.Left) && pure(expr.Right)
+	case *ast.UnaryOperator:
+		return pure(expr.Value)
+	case *ast.Subscript:
+		return pure(expr.Value) && pure(expr.Index)
+	case *ast.FieldAccess:
+		return pure(expr.Value)
+	}
+	return false
+}
+
+// unaryOperator computes the type of a unary operator expression.
+func (c *checker) unaryOperator(expr *ast.UnaryOperator) ast.Type {
+	value := c.expression(expr.Value)
+	if value == nil {
+		return nil
+	}
+	switch expr.Type {
+	case ast.UnaryDereference:
+		ptr, ok := value.(*ast.PointerType)
+		if !ok {
+			c.error(expr.SourceInfo(), "cannot dereference non-pointer type %s",
+				TypeName(value))
+			return nil
+		} else if value == nilType {
+			c.error(expr.SourceInfo(), "cannot dereference nil")
+			return nil
+		}
+		return ptr.Type
+	case ast.UnaryAddress:
+		if !isLvalue(expr.Value) {
+			c.error(expr.SourceInfo(), "cannot take address of non-lvalue")
+			return nil
+		}
+		return &ast.PointerType{
+			Source: *expr.SourceInfo(),
+			Type:   value,
+		}
+	case ast.UnaryMinus:
+		if _, ok := value.(*ast.Primitive); !ok {
+			c.error(expr.SourceInfo(), "invalid operand to %s: %s",
+				expr.Type.String(), TypeName(value))
+			return nil
+		}
+		return intType
+	}
+	panic("unhandled unary operator type")
+}
+
+// isLvalue checks if an expression refers to a location in memory, meaning
+// it can be assigned to and have its address taken.
+func isLvalue(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.Variable, *ast.Subscript, *ast.FieldAccess:
+		return true
+	case *ast.UnaryOperator:
+		return expr.Type == ast.UnaryDereference
+	}
+	return false
+}
+
+// isPrimitive checks if a type is the given primitive type, or a name for it.
+func isPrimitive(typ ast.Type, prim ast.PrimitiveType) bool {
+	p, ok := ast.Underlying(typ).(*ast.Primitive)
+	return ok && p.Type == prim
+}
+
+// isPointer checks if a type is a pointer type, including the type of nil.
+func isPointer(typ ast.Type) bool {
+	_, ok := typ.(*ast.PointerType)
+	return ok
+}
+
+// assignError reports that a value of type src can't be assigned to a
+// location of type dst, saying where the types differ if they have the same
+// shape.
+func (c *checker) assignError(source *token.SourceInformation, dst, src ast.Type) {
+	if why := mismatch(dst, src); why != "" {
+		c.error(source, "cannot assign %s to %s: %s", TypeName(src), TypeName(dst), why)
+		return
+	}
+	c.error(source, "cannot assign %s to %s", TypeName(src), TypeName(dst))
+}
+
+// mismatch explains the innermost difference between two array or pointer
+// types of the same shape, or returns the empty string if the types differ at
+// the top level.
+func mismatch(dst, src ast.Type) string {
+	switch dst := dst.(type) {
+	case *ast.ArrayType:
+		src, ok := src.(*ast.ArrayType)
+		if !ok {
+			return ""
+		}
+		if dst.Length != src.Length {
+			return fmt.Sprintf("array lengths %d and %d differ", src.Length, dst.Length)
+		}
+		if why := mismatch(dst.Type, src.Type); why != "" {
+			return why
+		}
+		return fmt.Sprintf("element types %s and %s differ",
+			TypeName(src.Type), TypeName(dst.Type))
+	case *ast.PointerType:
+		src, ok := src.(*ast.PointerType)
+		if !ok || src == nilType {
+			return ""
+		}
+		if why := mismatch(dst.Type, src.Type); why != "" {
+			return why
+		}
+		return fmt.Sprintf("pointed to types %s and %s differ",
+			TypeName(src.Type), TypeName(dst.Type))
+	}
+	return ""
+}
+
+// assignable checks if a value of type src can be assigned to a location of
+// type dst. The types must be the same, except that nil can be assigned to
+// any pointer and ints and chars can be assigned to each other; a char widens
+// to an int, and an int is narrowed to a char when it is stored. Arrays never
+// decay to pointers, so an array can only be assigned to an array of the same
+// length and element type, and a pointer to its first element must be taken
+// explicitly with &a[0].
+func assignable(dst, src ast.Type) bool {
+	dst = ast.Underlying(dst)
+	if src == nilType {
+		return isPointer(dst)
+	}
+	_, dstPrim := dst.(*ast.Primitive)
+	_, srcPrim := src.(*ast.Primitive)
+	if dstPrim && srcPrim {
+		return true
+	}
+	return sameType(dst, src)
+}
+
+// sameType checks if two types are the same. A named type is the same as the
+// type it is declared as, and structs are the same if their fields have the
+// same names and types in the same order.
+func sameType(a, b ast.Type) bool {
+	return sameTypes(a, b, make(map[[2]ast.Type]bool))
+}
+
+// sameTypes compares two types for sameType. compared holds the pairs of
+// named types already being compared further up, which are taken to be the
+// same so that comparing types that refer to themselves comes to an end.
+func sameTypes(a, b ast.Type, compared map[[2]ast.Type]bool) bool {
+	_, aNamed := a.(*ast.NamedType)
+	_, bNamed := b.(*ast.NamedType)
+	if aNamed || bNamed {
+		pair := [2]ast.Type{a, b}
+		if compared[pair] {
+			return true
+		}
+		compared[pair] = true
+		a, b = ast.Underlying(a), ast.Underlying(b)
+	}
+	switch a := a.(type) {
+	case *ast.Primitive:
+		b, ok := b.(*ast.Primitive)
+		return ok && a.Type == b.Type
+	case *ast.PointerType:
+		b, ok := b.(*ast.PointerType)
+		return ok && sameTypes(a.Type, b.Type, compared)
+	case *ast.ArrayType:
+		b, ok := b.(*ast.ArrayType)
+		return ok && a.Length == b.Length && sameTypes(a.Type, b.Type, compared)
+	case *ast.FunctionType:
+		b, ok := b.(*ast.FunctionType)
+		if !ok || len(a.Parameters) != len(b.Parameters) {
+			return false
+		}
+		for i := range a.Parameters {
+			if !sameTypes(a.Parameters[i], b.Parameters[i], compared) {
+				return false
+			}
+		}
+		if a.Return == nil || b.Return == nil {
+			return a.Return == nil && b.Return == nil
+		}
+		return sameTypes(a.Return, b.Return, compared)
+	case *ast.StructType:
+		b, ok := b.(*ast.StructType)
+		if !ok || len(a.Fields) != len(b.Fields) {
+			return false
+		}
+		for i := range a.Fields {
+			af, bf := a.Fields[i], b.Fields[i]
+			if af.Name != bf.Name || !sameTypes(af.Type, bf.Type, compared) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// TypeName gets the name of a type as it would be written in the source,
+// for use in error messages.
+func TypeName(typ ast.Type) string {
+	switch typ := typ.(type) {
+	case *ast.Primitive:
+		if name, ok := token.ConstantTokens[primitiveTokens[typ.Type]]; ok {
+			return name
+		}
+		return typ.Type.String()
+	case *ast.PointerType:
+		if typ == nilType {
+			return "nil"
+		}
+		return "ptr to " + TypeName(typ.Type)
+	case *ast.ArrayType:
+		if typ.Length == ast.UnknownLength {
+			return "array of " + TypeName(typ.Type)
+		}
+		return fmt.Sprintf("array(%d) of %s", typ.Length, TypeName(typ.Type))
+	case *ast.NamedType:
+		return typ.Name
+	case *ast.FunctionType:
+		params := make([]string, len(typ.Parameters))
+		for i, param := range typ.Parameters {
+			params[i] = TypeName(param)
+		}
+		name := "func(" + strings.Join(params, ", ") + ")"
+		if typ.Return != nil {
+			name += " " + TypeName(typ.Return)
+		}
+		return name
+	case *ast.StructType:
+		if len(typ.Fields) == 0 {
+			return "struct {}"
+		}
+		name := "struct {"
+		for _, field := range typ.Fields {
+			name += " " + field.Name + " " + TypeName(field.Type) + ";"
+		}
+		return name + " }"
+	}
+	return typ.String()
+}
+
+// primitiveTokens maps primitive types to the keyword used to write them.
+var primitiveTokens = map[ast.PrimitiveType]token.Type{
+	ast.IntType:  token.TokInt,
+	ast.CharType: token.TokChar,
+}
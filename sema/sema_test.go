@@ -0,0 +1,843 @@
+package sema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cmgn/compiler/ast"
+	"github.com/cmgn/compiler/lexer"
+	"github.com/cmgn/compiler/parser"
+	"github.com/cmgn/compiler/token"
+)
+
+func TestDereferencePointer(t *testing.T) {
+	in := "var p ptr to int; var x int; x = *p;"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+}
+
+func TestDereferenceNonPointer(t *testing.T) {
+	in := "var x int; *x;"
+	expectError(t, in, "[test:1] cannot dereference non-pointer type int")
+}
+
+func TestAddressOfElement(t *testing.T) {
+	in := "var a array(3) of int; var p ptr to int; p = &a[0];"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+}
+
+func TestAddressOfLvalue(t *testing.T) {
+	decls := "var x int; var a array(2) of int; var p ptr to int; var b int; var q ptr to int;"
+	for _, in := range []string{"q = &x;", "q = &a[0];", "q = &*p;", "q = &(x);"} {
+		if err := check(decls + in); err != nil {
+			t.Error(
+				"For", in,
+				"expected", "no error",
+				"got", err,
+			)
+		}
+	}
+	for _, in := range []string{"q = &5;", "q = &(x + b);", "q = &-x;", "q = &&x;"} {
+		expectError(t, decls+in, "[test:1] cannot take address of non-lvalue")
+	}
+}
+
+func TestNilPointer(t *testing.T) {
+	in := "var p ptr to int = nil; var q ptr to char; q = nil; if p == nil p = nil;"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+}
+
+func TestPointerArithmetic(t *testing.T) {
+	in := "var a array(4) of int; var p ptr to int = &a[0]; var c char = 'a';\n" +
+		"p = p + 1; p = 2 + p; p = p - c; var n int = p - &a[1];\n" +
+		"var q ptr to array(4) of int = &a; q = q + 1;"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+	stmts := parse(t, "var p ptr to int; var q ptr to int; p - q;")
+	info, err := Analyze(stmts, DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := info.TypeOf(stmts[2].(*ast.ExpressionStatement).Expression); typ == nil || TypeName(typ) != "int" {
+		t.Error(
+			"For", "p - q",
+			"expected", "int",
+			"got", typ,
+		)
+	}
+	expectError(t, "var p ptr to int; var q ptr to int; p + q;", "[test:1] invalid operands to '+': ptr to int and ptr to int")
+	expectError(t, "var p ptr to int; var q ptr to char; p - q;", "[test:1] invalid operands to '-': ptr to int and ptr to char")
+	expectError(t, "var p ptr to int; 1 - p;", "[test:1] invalid operands to '-': int and ptr to int")
+	expectError(t, "var p ptr to int; p * 2;", "[test:1] invalid operands to '*': ptr to int and int")
+	expectError(t, "var p ptr to int; p - nil;", "[test:1] invalid operands to '-': ptr to int and nil")
+	expectError(t, "nil + 1;", "[test:1] invalid operands to '+': nil and int")
+}
+
+func TestCharIntConversion(t *testing.T) {
+	in := "var c char = 'a'; var x int = c; c = x + 1;"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+	expectError(t, "var a array(2) of char; var b array(2) of int; a = b;",
+		"[test:1] cannot assign array(2) of int to array(2) of char: element types int and char differ")
+}
+
+func TestCharIndex(t *testing.T) {
+	in := "var a array(3) of int; var c char = 'a'; var x int = a[c - 'a'];"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+	expectError(t, "var a array(3) of int; var p ptr to int; var x int = a[p];",
+		"[test:1] array index must be int, not ptr to int")
+}
+
+func TestConstantIndex(t *testing.T) {
+	expectError(t, "var a array(10) of int; a[-1] = 1;", "[test:1] index -1 out of range for array(10) of int")
+	expectError(t, "var a array(10) of int; a[10] = 1;", "[test:1] index 10 out of range for array(10) of int")
+	expectError(t, "var a array(10) of int;\nvar x int = a[2 * 5 - 11];", "[test:2] index -1 out of range for array(10) of int")
+	expectError(t, "var a array(2) of array(3) of char; a[1][3] = 'a';", "[test:1] index 3 out of range for array(3) of char")
+	for _, in := range []string{
+		"var a array(10) of int; a[9] = 1; a[0] = a[9];",
+		"var a array(10) of int; var i int = 10; a[i] = 1; a[i - 20] = 1;",
+		"var a array(200) of int; a['a'] = 1;",
+		"var a array of int = {1, 2}; a[1] = 1;",
+	} {
+		if err := check(in); err != nil {
+			t.Error(
+				"For", in,
+				"expected", "no error",
+				"got", err,
+			)
+		}
+	}
+}
+
+func TestSizedElements(t *testing.T) {
+	in := "var a array(2) of array(3) of char; var p ptr to array(4) of array(2) of int; a[1][2] = 'x';"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+	expectError(t, "var a array(2) of array(0) of int;",
+		"[test:1] array of zero-sized type array(0) of int")
+	expectError(t, "var p ptr to array(2) of array(0) of int;",
+		"[test:1] array of zero-sized type array(0) of int")
+	at := token.SourceInformation{FileName: "test", Line: 1, Column: 1}
+	tests := []struct {
+		elem ast.Type
+		err  string
+	}{
+		{&ast.Primitive{Source: at, Type: ast.PrimitiveType(99)}, "[test:1] array of zero-sized type PrimitiveType(99)"},
+		{nil, "[test:1] array element type does not resolve"},
+		{&ast.PointerType{Source: at}, "[test:1] pointed to type does not resolve"},
+	}
+	for _, test := range tests {
+		decl := &ast.Declaration{
+			Source: at,
+			Name:   "a",
+			Type:   &ast.ArrayType{Source: at, Length: 2, Type: test.elem},
+		}
+		err := Check([]ast.Statement{decl})
+		if err == nil || err.Error() != test.err {
+			t.Error(
+				"For", test.elem,
+				"expected", test.err,
+				"got", err,
+			)
+		}
+	}
+}
+
+func TestResolvedTypes(t *testing.T) {
+	in := "var a array of ptr to func(int, char) array(2) of int = {nil}; var b array(2) of char;"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+	expectError(t, "var x point;", "[test:1] undefined type point")
+	expectError(t, "var a array(2) of\nnode;", "[test:2] undefined type node")
+	expectError(t, "var a array of node = {1, 2};", "[test:1] undefined type node")
+	expectError(t, "var p ptr to func(int) node;", "[test:1] undefined type node")
+}
+
+func TestStructTypes(t *testing.T) {
+	in := "var a struct { c char; n int; }; var b struct { c char; n int; }; a = b;" +
+		"var p ptr to struct { c char; n int; } = &a; *p = b;" +
+		"var s array(2) of struct { inner struct { c char; }; };" +
+		"s[0].inner.c = 'a'; var x int = a.n + s[1].inner.c; var q ptr to int = &(*p).n;"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+	expectError(t, "var a struct { c char; n int; }; var b struct { n int; c char; }; a = b;",
+		"[test:1] cannot assign struct { n int; c char; } to struct { c char; n int; }")
+	expectError(t, "var a struct { n int; }; var b struct { n char; }; a = b;",
+		"[test:1] cannot assign struct { n char; } to struct { n int; }")
+	expectError(t, "var s struct { n int;\nn char; };", "[test:2] field n already defined at test:1")
+	expectError(t, "var s struct { p point; };", "[test:1] undefined type point")
+	expectError(t, "var s struct { a array of int; };",
+		"[test:1] cannot infer length of array of int without a non-empty array literal")
+	expectError(t, "var s struct {}; if s {}", "[test:1] cannot use struct {} as condition")
+	expectError(t, "var s struct { n int; }; var x int = s + 1;",
+		"[test:1] invalid operands to '+': struct { n int; } and int")
+	expectError(t, "var s struct { n int; }; s.m = 1;", "[test:1] struct { n int; } has no field m")
+	expectError(t, "var x int; x.n = 1;", "[test:1] cannot access field n of non-struct type int")
+	expectError(t, "var s struct { c char; }; var p ptr to int = s.c;", "[test:1] cannot assign char to ptr to int")
+}
+
+func TestTypeDeclarations(t *testing.T) {
+	in := "var l list; type list ptr to node; type node struct { value int; next list; };" +
+		"var n node; l = &n; var m ptr to node = l;" +
+		"type pair array(2) of int; var p pair = {1, 2}; var q array(2) of int = p; p[0] = q[1] + 1;" +
+		"type byte char; var b byte = 'a'; b = b + 1; var c char = b;" +
+		"type callback func(ptr to node) list; var f callback; var g func(list) ptr to node = f;"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+	expectError(t, "type t int;\ntype t char;", "[test:2] type t already declared at test:1")
+	expectError(t, "{ type t int; }", "[test:1] type t must be declared at the top level")
+	expectError(t, "type t ptr to u;", "[test:1] undefined type u")
+	expectError(t, "type a array of int;",
+		"[test:1] cannot infer length of array of int without a non-empty array literal")
+	expectError(t, "type e struct {}; type es array(2) of e;", "[test:1] array of zero-sized type e")
+	expectError(t, "type pair array(2) of int; var p pair = {1, 2, 3};",
+		"[test:1] array literal has 3 elements, expected 2")
+	expectError(t, "type a struct { n int; }; type b struct { n char; }; var x a; var y b; x = y;",
+		"[test:1] cannot assign struct { n char; } to struct { n int; }")
+}
+
+func TestRecursiveTypes(t *testing.T) {
+	valid := []string{
+		"type node struct { value int; next ptr to node; };",
+		"type a struct { b ptr to b; }; type b struct { a a; };",
+		"type tree struct { children array(2) of ptr to tree; };",
+		"type p ptr to p; var x p; x = &x;",
+		"type f func(f) f;",
+		"type a struct { b b; c b; }; type b struct { n int; };",
+	}
+	for _, in := range valid {
+		if err := check(in); err != nil {
+			t.Error(
+				"For", in,
+				"expected", "no error",
+				"got", err,
+			)
+		}
+	}
+	expectError(t, "type node struct {\nvalue int;\nnext node;\n};",
+		"[test:3] recursive type must be through a pointer")
+	expectError(t, "type a struct { b b; };\ntype b struct { n int; a array(2) of a; };",
+		"[test:2] recursive type must be through a pointer")
+	expectError(t, "type a b; type b a;", "[test:1] recursive type must be through a pointer")
+	expectError(t, "type a array(2) of a;", "[test:1] recursive type must be through a pointer")
+	expectError(t, "type a struct { n int; }; type b struct { c c; }; type c struct { b b; };",
+		"[test:1] recursive type must be through a pointer")
+}
+
+func TestPrintf(t *testing.T) {
+	in := "var c char = 'a'; var x int; printf \"%c=%d 100%%\", c, x + 1;"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+	expectError(t, "var x int; printf \"%d, %d\", x;",
+		"[test:1] printf format \"%d, %d\" needs 2 arguments, got 1")
+	expectError(t, "var p ptr to int; printf \"%c\", p;",
+		"[test:1] printf verb %c needs int or char, not ptr to int")
+	expectError(t, "printf \"%s\";", "[test:1] unknown printf verb %s")
+	expectError(t, "printf \"5%\";", "[test:1] printf format \"5%\" ends with %")
+}
+
+func TestDefer(t *testing.T) {
+	in := "var x int; { defer x = 1; defer { var y int = x; x = y; } var z int = x; }"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+	expectError(t, "defer var x int;", "[test:1] cannot defer a declaration")
+	expectError(t, "defer x = 1;", "[test:1] undeclared variable x")
+	expectError(t, "var x int;\n{ defer x = 1;\nvar x char; }",
+		"[test:3] declaration of x after the deferred statement at test:2 that uses it")
+}
+
+func TestNilNonPointer(t *testing.T) {
+	expectError(t, "var x int = nil;", "[test:1] cannot assign nil to int")
+	expectError(t, "var x int; x == nil;", "[test:1] invalid operands to '==': int and nil")
+	expectError(t, "*nil;", "[test:1] cannot dereference nil")
+}
+
+func TestBlockScope(t *testing.T) {
+	in := "var x int; { var y int; y = x; { x = y; } } x = y;"
+	expectError(t, in, "[test:1] undeclared variable y")
+}
+
+func TestBodyScope(t *testing.T) {
+	expectError(t, "var c int; if c var y int; y = 1;", "[test:1] undeclared variable y")
+	expectError(t, "var c int; if c { var y int; } y = 1;", "[test:1] undeclared variable y")
+	expectError(t, "var c int; if c {} else var y int; y = 1;", "[test:1] undeclared variable y")
+	expectError(t, "var c int; while c var y int; y = 1;", "[test:1] undeclared variable y")
+	in := "var y int = 1; if y var y int = 2; while y var y char; y = 2;"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+}
+
+func TestLoopDeclarations(t *testing.T) {
+	in := "var i int; while i < 3 { var j int = i; while j < 3 { var i int = j; j = j + 1; } i = i + 1; }"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+	expectError(t, "var c int; while c { var i int; var i char; }", "[test:1] redeclaration of i")
+}
+
+func TestDeclarationVisibility(t *testing.T) {
+	in := "{ var x int = 1; x = x + 1; var y int = x; { y = x; var x char = 'a'; x = 'b'; } }"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+	expectError(t, "var x int;\n{ x = 1;\ny = 2;\nvar y int; }", "[test:3] undeclared variable y")
+	expectError(t, "{ var y int = y; }", "[test:1] undeclared variable y")
+	expectError(t, "var x int; { x = nil; var x ptr to int; x = nil; }",
+		"[test:1] cannot assign nil to int")
+}
+
+func TestBlockShadowing(t *testing.T) {
+	in := "var x int; { var x char; x = 'a'; } x = 1;"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+}
+
+func TestShadowingWarning(t *testing.T) {
+	in := "var x int;\n{ var x int; { var x int; } }\n{ var x char; }"
+	stmts := parse(t, in)
+	warnings, err := CheckWith(stmts, DefaultConfig)
+	if err != nil || len(warnings) != 0 {
+		t.Error(
+			"For", in,
+			"expected", "no warnings",
+			"got", warnings, err,
+		)
+	}
+	cfg := DefaultConfig
+	cfg.WarnShadowing = true
+	warnings, err = CheckWith(stmts, cfg)
+	expected := []string{
+		"[test:2] declaration of x shadows declaration at test:1",
+		"[test:2] declaration of x shadows declaration at test:2",
+	}
+	if err != nil || len(warnings) != len(expected) {
+		t.Error(
+			"For", in,
+			"expected", expected,
+			"got", warnings, err,
+		)
+		return
+	}
+	for i, warning := range warnings {
+		if warning.String() != expected[i] {
+			t.Error(
+				"For", in,
+				"expected", expected[i],
+				"got", warning.String(),
+			)
+		}
+	}
+}
+
+func TestUnusedWarning(t *testing.T) {
+	in := "var y int;\nvar x int;\n{ var z int; x = 1; }"
+	cfg := DefaultConfig
+	cfg.WarnUnused = true
+	warnings, err := CheckWith(parse(t, in), cfg)
+	expected := []string{
+		"[test:3] z declared but never used",
+		"[test:1] y declared but never used",
+	}
+	if err != nil || len(warnings) != len(expected) {
+		t.Error(
+			"For", in,
+			"expected", expected,
+			"got", warnings, err,
+		)
+		return
+	}
+	for i, warning := range warnings {
+		if warning.String() != expected[i] || warning.Category != Unused {
+			t.Error(
+				"For", in,
+				"expected", expected[i],
+				"got", warning.String(), warning.Category,
+			)
+		}
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	enable := func(set func(cfg *Config)) Config {
+		cfg := DefaultConfig
+		set(&cfg)
+		return cfg
+	}
+	selfComparison := enable(func(cfg *Config) { cfg.WarnSelfComparison = true })
+	mixedComparison := enable(func(cfg *Config) { cfg.WarnMixedComparison = true })
+	selfAssignment := enable(func(cfg *Config) { cfg.WarnSelfAssignment = true })
+	noTruncation := enable(func(cfg *Config) { cfg.WarnTruncation = false })
+	nonTerminating := enable(func(cfg *Config) { cfg.WarnNonTerminating = true })
+	redundantCondition := enable(func(cfg *Config) { cfg.WarnRedundantCondition = true })
+	constantCondition := enable(func(cfg *Config) { cfg.WarnConstantCondition = true })
+	infiniteLoops := enable(func(cfg *Config) {
+		cfg.WarnConstantCondition = true
+		cfg.WarnInfiniteLoops = true
+	})
+	tests := []struct {
+		cfg Config
+		in  string
+		out []string
+	}{
+		{selfComparison, "var x int; x == x;", []string{"[test:1] comparison of x with itself is always true"}},
+		{selfComparison, "var p ptr to int; p != p;", []string{"[test:1] comparison of p with itself is always false"}},
+		{selfComparison, "var a array(2) of int; a[1] < a[1];", []string{"[test:1] comparison of a[1] with itself is always false"}},
+		{selfComparison, "var x int; var y int; x == y;", nil},
+		{selfComparison, "var x int; x + x;", nil},
+		{selfComparison, "var x int; x == -x;", nil},
+		{mixedComparison, "var c char; var x int; c < x;", []string{"[test:1] comparison of char c with int x widens c to int"}},
+		{mixedComparison, "var c char; var x int; x != c;", []string{"[test:1] comparison of char c with int x widens c to int"}},
+		{mixedComparison, "var c char; c == 256;", []string{"[test:1] comparison of char c with int 256 widens c to int"}},
+		{mixedComparison, "var x int; var y int; x == y;", nil},
+		{mixedComparison, "var c char; var d char; c > d;", nil},
+		{mixedComparison, "var c char; c == 0; c < 'a'; c > 255;", nil},
+		{mixedComparison, "var c char; var x int; c + x;", nil},
+		{DefaultConfig, "var c char; var x int; c < x;", nil},
+		{selfAssignment, "var x int; x = x;", []string{"[test:1] assignment of x to itself"}},
+		{selfAssignment, "var a array(2) of int; a[0] = a[0];", []string{"[test:1] assignment of a[0] to itself"}},
+		{selfAssignment, "var p ptr to int; *p = *p;", []string{"[test:1] assignment of *p to itself"}},
+		{selfAssignment, "var x int; var y int; x = y;", nil},
+		{selfAssignment, "var a array(2) of int; var i int; var j int; a[i] = a[j];", nil},
+		{selfAssignment, "var a array(2) of int; a[0] = a[1];", nil},
+		{DefaultConfig, "var x int; x = x;", nil},
+		{DefaultConfig, "var x int; var c char; c = x;", []string{"[test:1] int x is truncated to char, keeping only its low 8 bits"}},
+		{DefaultConfig, "var x int; var c char = x + 1;", []string{"[test:1] int x + 1 is truncated to char, keeping only its low 8 bits"}},
+		{DefaultConfig, "var x int; var a array(2) of char = {'a', x};", []string{"[test:1] int x is truncated to char, keeping only its low 8 bits"}},
+		{DefaultConfig, "var c char; c = 256;", []string{"[test:1] int 256 is truncated to char, keeping only its low 8 bits"}},
+		{DefaultConfig, "var c char; c = 'a';", nil},
+		{DefaultConfig, "var c char = 10; c = 200 + 55; c = c;", nil},
+		{DefaultConfig, "var c char; var d char; c = c + 1; c = -c * (d - 'a') / 2; var e char = c - d;", nil},
+		{DefaultConfig, "type byte char; var c byte; var d char; c = d + c;", nil},
+		{DefaultConfig, "var c char; var x int; c = c + x;", []string{"[test:1] int c + x is truncated to char, keeping only its low 8 bits"}},
+		{DefaultConfig, "var c char; var a array(2) of int; c = a[0] - c;", []string{"[test:1] int a[0] - c is truncated to char, keeping only its low 8 bits"}},
+		{DefaultConfig, "var c char; c = c == c;", []string{"[test:1] int c == c is truncated to char, keeping only its low 8 bits"}},
+		{DefaultConfig, "var c char; var x int = c; x = c;", nil},
+		{DefaultConfig, "type byte char; var x int; var c byte = x;", []string{"[test:1] int x is truncated to char, keeping only its low 8 bits"}},
+		{DefaultConfig, "type byte char; var x int; var c byte; c = x;", []string{"[test:1] int x is truncated to char, keeping only its low 8 bits"}},
+		{DefaultConfig, "type byte char; var x int; var a array(2) of byte = {'a', x};", []string{"[test:1] int x is truncated to char, keeping only its low 8 bits"}},
+		{DefaultConfig, "type num int; var x num; var c char = x;", []string{"[test:1] int x is truncated to char, keeping only its low 8 bits"}},
+		{noTruncation, "var x int; var c char; c = x;", nil},
+		{nonTerminating, "var x int; while 1 { x = x + 1; }", []string{"[test:1] loop with condition 1 never terminates"}},
+		{nonTerminating, "var x int; while 2 - 1 { if x x = 0; }", []string{"[test:1] loop with condition 2 - 1 never terminates"}},
+		{nonTerminating, "var x int; while 1 { assert 1; }", []string{"[test:1] loop with condition 1 never terminates"}},
+		{nonTerminating, "var x int; while 1 { x = x + 1; if x > 10 assert 0; }", nil},
+		{nonTerminating, "var x int; while 1 { x = x + 1; assert x < 10; }", nil},
+		{nonTerminating, "var x int; while 1 { switch x { default: assert x; } }", nil},
+		{nonTerminating, "var x int; while x { x = x - 1; }", nil},
+		{nonTerminating, "while 0 ;", nil},
+		{nonTerminating, "while 1 { break; }", nil},
+		{nonTerminating, "var x int; while 1 { if x continue; }", []string{"[test:1] loop with condition 1 never terminates"}},
+		{nonTerminating, "while 1 { while 1 break; }", []string{"[test:1] loop with condition 1 never terminates"}},
+		{nonTerminating, "a: while 1 { while 1 break a; }", nil},
+		{nonTerminating, "while 1 { a: while 1 break a; }", []string{"[test:1] loop with condition 1 never terminates"}},
+		{DefaultConfig, "while 1 ;", nil},
+		{redundantCondition, "var a int; if a a = 1; else if a a = 2;", []string{"[test:1] condition a was already tested at line 1"}},
+		{
+			redundantCondition,
+			"var a int;\nif a < 1 { a = 1; }\nelse if a > 2 { a = 2; }\nelse { if a < 1 a = 3; }",
+			[]string{"[test:4] condition a < 1 was already tested at line 2"},
+		},
+		{
+			redundantCondition,
+			"var a int; if a a = 1; else if a a = 2; else if a a = 3;",
+			[]string{"[test:1] condition a was already tested at line 1", "[test:1] condition a was already tested at line 1"},
+		},
+		{redundantCondition, "var a int; var b int; if a a = 1; else if b a = 2; else if a + b a = 3;", nil},
+		{redundantCondition, "var a int; if a { if a a = 1; }", nil},
+		{redundantCondition, "var a int; if a a = 1; else { a = 2; if a a = 3; }", nil},
+		{redundantCondition, "var a array(2) of int; if a[0] a[0] = 1; else if a[0] a[1] = 1;", []string{"[test:1] condition a[0] was already tested at line 1"}},
+		{DefaultConfig, "var a int; if a a = 1; else if a a = 2;", nil},
+		{constantCondition, "if 0 ;", []string{"[test:1] condition 0 is always false"}},
+		{constantCondition, "if (5) ;", []string{"[test:1] condition 5 is always true"}},
+		{constantCondition, "if 2 - 2 ;", []string{"[test:1] condition 2 - 2 is always false"}},
+		{constantCondition, "while 1 ;", nil},
+		{infiniteLoops, "while 1 ;", []string{"[test:1] condition 1 is always true"}},
+		{constantCondition, "while 0 ;", []string{"[test:1] condition 0 is always false"}},
+		{infiniteLoops, "var x int; if x ; while x < 1 ;", nil},
+	}
+	for _, test := range tests {
+		expectWarnings(t, test.cfg, test.in, test.out)
+	}
+}
+
+func TestPure(t *testing.T) {
+	// There are no calls yet, but any expression not known to be pure must be
+	// treated as if it could have side effects.
+	if lit := (&ast.ArrayLiteral{}); pure(lit) {
+		t.Error(
+			"For", lit,
+			"expected", "impure",
+			"got", "pure",
+		)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	in := "var x int;\n{ var x int; x = 1; }"
+	tests := []struct {
+		strict   []Category
+		warnings int
+		err      string
+	}{
+		{nil, 2, ""},
+		{[]Category{Shadowing}, 0, "[test:2] declaration of x shadows declaration at test:1"},
+		{[]Category{Unused}, 1, "[test:1] x declared but never used"},
+		{Categories, 0, "[test:2] declaration of x shadows declaration at test:1"},
+	}
+	for _, test := range tests {
+		cfg := Config{WarnShadowing: true, WarnUnused: true, Strict: test.strict}
+		warnings, err := CheckWith(parse(t, in), cfg)
+		errStr := ""
+		if err != nil {
+			errStr = err.Error()
+		}
+		if len(warnings) != test.warnings || errStr != test.err {
+			t.Error(
+				"For", in, test.strict,
+				"expected", test.warnings, test.err,
+				"got", warnings, errStr,
+			)
+		}
+	}
+}
+
+func TestArrayLiteral(t *testing.T) {
+	in := "var a array(3) of int = {1, 2, 3}; var b array(2) of array(2) of char = {{'a', 'b'}, {}};"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+}
+
+func TestArrayLiteralMismatch(t *testing.T) {
+	expectError(t, "var a array(3) of int = {1, 2};",
+		"[test:1] array literal has 2 elements, expected 3")
+	expectError(t, "var a array(2) of array(2) of int = {{1, 2}, {3}};",
+		"[test:1] array literal has 1 elements, expected 2")
+	expectError(t, "var a array(1) of ptr to int = {1};",
+		"[test:1] cannot assign int to ptr to int")
+	expectError(t, "var a int = {1};",
+		"[test:1] cannot use array literal as int")
+}
+
+func TestArrayLengthInference(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"var a array of int = {1, 2, 3};", "array(3) of int"},
+		{"var a array(3) of int = {1, 2, 3};", "array(3) of int"},
+		{"var a array of array of char = {{'a', 'b'}, {'c', 'd'}};", "array(2) of array(2) of char"},
+	}
+	for _, test := range tests {
+		stmts := parse(t, test.in)
+		if err := Check(stmts); err != nil {
+			t.Error(
+				"For", test.in,
+				"expected", "no error",
+				"got", err,
+			)
+			continue
+		}
+		typ := stmts[0].(*ast.Declaration).Type
+		if TypeName(typ) != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", TypeName(typ),
+			)
+		}
+	}
+	expectError(t, "var a array(2) of int = {1, 2, 3};",
+		"[test:1] array literal has 3 elements, expected 2")
+	expectError(t, "var a array of array of int = {{1, 2}, {3}};",
+		"[test:1] array literal has 1 elements, expected 2")
+	expectError(t, "var a array of int;",
+		"[test:1] cannot infer length of array of int without a non-empty array literal")
+	expectError(t, "var a array of int = {};",
+		"[test:1] cannot infer length of array of int without a non-empty array literal")
+	expectError(t, "var p ptr to array of int;",
+		"[test:1] cannot infer length of array of int without a non-empty array literal")
+}
+
+func TestTypeOf(t *testing.T) {
+	in := "var a array(2) of char; var x int; var p ptr to int;\nx + 1;\n&x;\na[0];\np = nil;"
+	stmts := parse(t, in)
+	info, err := Analyze(stmts, DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assign := stmts[6].(*ast.Assignment)
+	tests := []struct {
+		expr ast.Expression
+		out  string
+	}{
+		{stmts[3].(*ast.ExpressionStatement).Expression, "int"},
+		{stmts[4].(*ast.ExpressionStatement).Expression, "ptr to int"},
+		{stmts[5].(*ast.ExpressionStatement).Expression, "char"},
+		{stmts[5].(*ast.ExpressionStatement).Expression.(*ast.Subscript).Value, "array(2) of char"},
+		{assign.Left, "ptr to int"},
+		{assign.Right, "nil"},
+	}
+	for _, test := range tests {
+		typ := info.TypeOf(test.expr)
+		if typ == nil || TypeName(typ) != test.out {
+			t.Error(
+				"For", test.expr,
+				"expected", test.out,
+				"got", typ,
+			)
+		}
+	}
+	if typ := info.TypeOf(&ast.Variable{Value: "x"}); typ != nil {
+		t.Error(
+			"For", "an expression that wasn't checked",
+			"expected", nil,
+			"got", typ,
+		)
+	}
+}
+
+func TestStatementExpression(t *testing.T) {
+	in := "var x int = ({ var y char = 'a'; y = y + 1; y });\nvar z int = ({ var y int = 2; y * x });"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+	stmts := parse(t, "var p ptr to int = ({ var c char; c });")
+	if err := Check(stmts); err == nil || err.Error() != "[test:1] cannot assign char to ptr to int" {
+		t.Error(
+			"For", "a statement expression of the wrong type",
+			"expected", "[test:1] cannot assign char to ptr to int",
+			"got", err,
+		)
+	}
+	expectError(t, "var x int = ({ var y int; y }); x = y;", "[test:1] undeclared variable y")
+	expectError(t, "var x int = ({ y = 1; x });", "[test:1] undeclared variable y")
+}
+
+func TestArrayAssignment(t *testing.T) {
+	in := "var a array(3) of int; var b array(3) of int; a = b;"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+	expectError(t, "var a array(3) of int; var b array(4) of int; a = b;",
+		"[test:1] cannot assign array(4) of int to array(3) of int: array lengths 4 and 3 differ")
+	expectError(t, "var a array(3) of int; var b array(3) of char; a = b;",
+		"[test:1] cannot assign array(3) of char to array(3) of int: element types char and int differ")
+	expectError(t, "var a array(2) of array(3) of int; var b array(2) of array(4) of int; a = b;",
+		"[test:1] cannot assign array(2) of array(4) of int to array(2) of array(3) of int: array lengths 4 and 3 differ")
+	expectError(t, "var p ptr to array(3) of int; var q ptr to array(2) of int; p = q;",
+		"[test:1] cannot assign ptr to array(2) of int to ptr to array(3) of int: array lengths 2 and 3 differ")
+	expectError(t, "var p ptr to int; var a array(3) of int; p = a;",
+		"[test:1] cannot assign array(3) of int to ptr to int")
+	expectError(t, "var p ptr to int = 1;",
+		"[test:1] cannot assign int to ptr to int")
+}
+
+func TestBranchStatements(t *testing.T) {
+	valid := []string{
+		"var x int; while x { x = x - 1; if x == 2 break; continue; }",
+		"var x int; a: while x { while 1 { if x break a; continue a; } }",
+		"var x int; while x { switch x { case 1: break; } }",
+		"var x int; while x { x = ({ while 1 break; 1 }); }",
+		"a: ; a: ;",
+	}
+	for _, in := range valid {
+		if err := check(in); err != nil {
+			t.Error(
+				"For", in,
+				"expected", "no error",
+				"got", err,
+			)
+		}
+	}
+	expectError(t, "break;", "[test:1] break outside of a loop")
+	expectError(t, "if 1 continue;", "[test:1] continue outside of a loop")
+	expectError(t, "a: if 1 {\nwhile 1 break a;\n}", "[test:2] label a does not name an enclosing loop")
+	expectError(t, "a: {\nwhile 1 continue a;\n}", "[test:2] label a does not name an enclosing loop")
+	expectError(t, "while 1 break b;", "[test:1] undefined label b")
+	expectError(t, "a: while 1 ;\nwhile 1 break a;", "[test:2] undefined label a")
+	expectError(t, "a: while 1 {\na: while 1 ;\n}", "[test:2] label a already defined at test:1")
+	expectError(t, "while 1 { defer break; }", "[test:1] break outside of a loop")
+	expectError(t, "var x int; while 1 x = ({ break; 1 });", "[test:1] break outside of a loop")
+}
+
+func TestSwitchDistinctCases(t *testing.T) {
+	in := "var x int; switch x { case 1: x = 2; case 1 + 1: var y int; default: var y char; }"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+}
+
+func TestSwitchDuplicateCases(t *testing.T) {
+	expectError(t, "var x int;\nswitch x {\ncase 2:\ncase 1 + 1:\n}",
+		"[test:4] duplicate case 2 in switch, previously at test:3")
+	expectError(t, "var c char;\nswitch c {\ncase 'a': case 'b':\ncase 'a':\n}",
+		"[test:4] duplicate case 'a' in switch, previously at test:3")
+}
+
+func TestSwitchCaseTypes(t *testing.T) {
+	in := "var c char; switch c { case 'a': c = 'b'; case '\\n': default: }"
+	if err := check(in); err != nil {
+		t.Error(
+			"For", in,
+			"expected", "no error",
+			"got", err,
+		)
+	}
+	expectError(t, "var c char;\nswitch c {\ncase 'a':\ncase 98:\n}",
+		"[test:4] cannot use int case 98 in switch on char")
+	expectError(t, "var x int; switch x { case 'a': }",
+		"[test:1] cannot use char case 'a' in switch on int")
+}
+
+func TestSwitchNonConstantCase(t *testing.T) {
+	expectError(t, "var x int; var y int; switch x { case y: }",
+		"[test:1] case y is not constant")
+}
+
+func check(src string) error {
+	toks, err := lexer.Lex("test", src)
+	if err != nil {
+		return err
+	}
+	stmts, err := parser.Parse(toks)
+	if err != nil {
+		return err
+	}
+	return Check(stmts)
+}
+
+func parse(t *testing.T, src string) []ast.Statement {
+	toks, err := lexer.Lex("test", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := parser.Parse(toks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stmts
+}
+
+func expectError(t *testing.T, in, expected string) {
+	err := check(in)
+	if err == nil || err.Error() != expected {
+		t.Error(
+			"For", in,
+			"expected", expected,
+			"got", err,
+		)
+	}
+}
+
+func expectWarnings(t *testing.T, cfg Config, in string, expected []string) {
+	warnings, err := CheckWith(parse(t, in), cfg)
+	strs := make([]string, len(warnings))
+	for i, warning := range warnings {
+		strs[i] = warning.String()
+	}
+	if err != nil || strings.Join(strs, "\n") != strings.Join(expected, "\n") {
+		t.Error(
+			"For", in,
+			"expected", expected,
+			"got", strs, err,
+		)
+	}
+}
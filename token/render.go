@@ -0,0 +1,128 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Render turns a stream of tokens back into source that lexes to the same
+// stream. Tokens are only separated where they would otherwise run together:
+// a space goes between two words, such as an identifier followed by an
+// integer, and between two operators that would join into another, such as
+// '=' followed by '='. A comment runs to the end of its line, so is followed
+// by a newline.
+func Render(tokens []*Token) string {
+	var buf strings.Builder
+	prev := ""
+	for i, tok := range tokens {
+		text := tok.Text()
+		if i > 0 {
+			if tokens[i-1].Type == TokComment {
+				buf.WriteByte('\n')
+			} else if joins(prev, text) {
+				buf.WriteByte(' ')
+			}
+		}
+		buf.WriteString(text)
+		prev = text
+	}
+	return buf.String()
+}
+
+// Text gives the source of a token, quoting literals so that they decode to
+// the token's value. A literal may have been written differently, with other
+// escape sequences, but lexes to the same token.
+func (t *Token) Text() string {
+	switch t.Type {
+	case TokCharacter:
+		return Quote(t.Value, '\'')
+	case TokString:
+		return Quote(t.Value, '"')
+	case TokRawString:
+		return "`" + t.Value + "`"
+	}
+	if str, ok := ConstantTokens[t.Type]; ok {
+		return str
+	}
+	return t.Value
+}
+
+// EndOf gives the position just after the last byte of a token's source. A
+// token that wasn't lexed from source is taken to have been written as given
+// by Text. Only raw strings can span lines, and their source is always the
+// same as their Text.
+func EndOf(t *Token) SourceInformation {
+	text := t.Text()
+	length := t.Length
+	if length == 0 {
+		length = len(text)
+	}
+	end := t.Source
+	end.Offset += length
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		end.Line += strings.Count(text, "\n")
+		end.Column = len(text) - i
+	} else {
+		end.Column += length
+	}
+	return end
+}
+
+// joins checks if two pieces of source would lex differently written next to
+// each other than they would with a space between them.
+func joins(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	last, first := a[len(a)-1], b[0]
+	if isWordByte(last) && isWordByte(first) {
+		return true
+	}
+	if last == '/' && first == '/' {
+		return true
+	}
+	_, ok := operators[a+string(first)]
+	return ok
+}
+
+// isWordByte checks if a byte can be part of an identifier, keyword or
+// integer.
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '_'
+}
+
+// quoteEscapes maps the bytes that have their own escape sequences to the
+// letter that follows the backslash.
+var quoteEscapes = map[byte]byte{
+	'\n': 'n',
+	'\t': 't',
+	'\r': 'r',
+	0:    '0',
+	'\\': '\\',
+}
+
+// Quote puts a string between quotes, escaping the quote and any bytes that
+// aren't printable ASCII so that the lexer decodes the same string.
+func Quote(s string, q byte) string {
+	var buf strings.Builder
+	buf.WriteByte(q)
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if b == 0 && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '7' {
+			// \0 followed by octal digits would be an octal escape.
+			buf.WriteString("\\x00")
+		} else if esc, ok := quoteEscapes[b]; ok {
+			buf.WriteByte('\\')
+			buf.WriteByte(esc)
+		} else if b == q {
+			buf.WriteByte('\\')
+			buf.WriteByte(q)
+		} else if b < ' ' || b > '~' {
+			fmt.Fprintf(&buf, "\\x%02x", b)
+		} else {
+			buf.WriteByte(b)
+		}
+	}
+	buf.WriteByte(q)
+	return buf.String()
+}
@@ -32,7 +32,7 @@ const (
 	TokRightBracket             // ')'
 	TokLeftCurly                // '{'
 	TokRightCurly               // '}'
-	TokLeftSquare               // ']'
+	TokLeftSquare               // '['
 	TokRightSquare              // ']'
 	TokSemiColon                // ';'
 	TokVar                      // 'var'
@@ -44,18 +44,61 @@ const (
 	TokChar                     // 'char'
 	TokNotEqual                 // '!='
 	TokNot                      // '!'
+	TokCharacter                // character
+	TokString                   // string
+	TokNil                      // 'nil'
+	TokFunc                     // 'func'
+	TokComma                    // ','
+	TokAssert                   // 'assert'
+	TokSwitch                   // 'switch'
+	TokCase                     // 'case'
+	TokDefault                  // 'default'
+	TokColon                    // ':'
+	TokComment                  // comment
+	TokPrintf                   // 'printf'
+	TokDefer                    // 'defer'
+	TokRawString                // raw string
+	TokBreak                    // 'break'
+	TokContinue                 // 'continue'
+	TokElif                     // 'elif'
+	TokStruct                   // 'struct'
+	TokType                     // 'type'
+	TokDot                      // '.'
 )
 
 // SourceInformation holds the source information for a token.
 type SourceInformation struct {
 	FileName string
 	Line     int
+	// Column is the column of the token within its line, counting from one.
+	Column int
+	// Offset is the position of the token's first byte in the source.
+	Offset int
 }
 
 func (si *SourceInformation) String() string {
 	return si.FileName + ":" + strconv.Itoa(si.Line)
 }
 
+// SourceSpan holds the source information for a range of tokens, from
+// the first token of a construct to its last.
+type SourceSpan struct {
+	Start SourceInformation
+	End   SourceInformation
+}
+
+// Span creates a source span running from start to end.
+func Span(start, end SourceInformation) SourceSpan {
+	return SourceSpan{Start: start, End: end}
+}
+
+func (ss *SourceSpan) String() string {
+	if ss.Start.Line == ss.End.Line {
+		return ss.Start.String()
+	}
+	return ss.Start.String() + "-" + strconv.Itoa(ss.End.Line)
+}
+
 // Token represents a token.
 type Token struct {
 	// Type holds the type of the token.
@@ -64,6 +107,10 @@ type Token struct {
 	Value string
 	// Source holds the source information for the token.
 	Source SourceInformation
+	// Length is the number of bytes of source the token was lexed from.
+	// It is zero for a ';' inserted by the lexer, and for a token that
+	// wasn't lexed.
+	Length int
 }
 
 func (t *Token) String() string {
@@ -105,18 +152,80 @@ var ConstantTokens = map[Type]string{
 	TokChar:         "char",
 	TokNotEqual:     "!=",
 	TokNot:          "!",
+	TokNil:          "nil",
+	TokFunc:         "func",
+	TokComma:        ",",
+	TokAssert:       "assert",
+	TokSwitch:       "switch",
+	TokCase:         "case",
+	TokDefault:      "default",
+	TokColon:        ":",
+	TokPrintf:       "printf",
+	TokDefer:        "defer",
+	TokBreak:        "break",
+	TokContinue:     "continue",
+	TokElif:         "elif",
+	TokStruct:       "struct",
+	TokType:         "type",
+	TokDot:          ".",
 }
 
 // Keywords contains identifiers that are language-level keywords.
 var Keywords = map[string]Type{
-	"if":    TokIf,
-	"while": TokWhile,
-	"else":  TokElse,
-	"var":   TokVar,
-	"int":   TokInt,
-	"array": TokArray,
-	"of":    TokOf,
-	"ptr":   TokPtr,
-	"to":    TokTo,
-	"char":  TokChar,
+	"if":       TokIf,
+	"while":    TokWhile,
+	"else":     TokElse,
+	"var":      TokVar,
+	"int":      TokInt,
+	"array":    TokArray,
+	"of":       TokOf,
+	"ptr":      TokPtr,
+	"to":       TokTo,
+	"char":     TokChar,
+	"nil":      TokNil,
+	"func":     TokFunc,
+	"assert":   TokAssert,
+	"switch":   TokSwitch,
+	"case":     TokCase,
+	"default":  TokDefault,
+	"printf":   TokPrintf,
+	"defer":    TokDefer,
+	"break":    TokBreak,
+	"continue": TokContinue,
+	"elif":     TokElif,
+	"struct":   TokStruct,
+	"type":     TokType,
+}
+
+// Reserved contains identifiers that are set aside for keywords that haven't
+// been implemented yet. Lexers can be configured to reject them, so that
+// programs don't start using them as names before they become keywords.
+var Reserved = map[string]bool{
+	"for":    true,
+	"return": true,
+}
+
+// operators maps the string of each constant token that isn't a keyword to
+// its type.
+var operators = make(map[string]Type)
+
+func init() {
+	for typ, str := range ConstantTokens {
+		if _, ok := Keywords[str]; !ok {
+			operators[str] = typ
+		}
+	}
+}
+
+// LookupOperator finds the type of the operator or punctuation token with the
+// given string, e.g. "==" or "{".
+func LookupOperator(s string) (Type, bool) {
+	typ, ok := operators[s]
+	return typ, ok
+}
+
+// LookupKeyword finds the type of the keyword with the given string.
+func LookupKeyword(s string) (Type, bool) {
+	typ, ok := Keywords[s]
+	return typ, ok
 }
@@ -0,0 +1,103 @@
+package token
+
+import "testing"
+
+func TestLookupOperator(t *testing.T) {
+	tests := []struct {
+		in  string
+		out Type
+		ok  bool
+	}{
+		{"==", TokEquals, true},
+		{"{", TokLeftCurly, true},
+		{":", TokColon, true},
+		{"while", 0, false},
+		{"<=", 0, false},
+	}
+	for _, test := range tests {
+		typ, ok := LookupOperator(test.in)
+		if typ != test.out || ok != test.ok {
+			t.Error(
+				"For", test.in,
+				"expected", test.out, test.ok,
+				"got", typ, ok,
+			)
+		}
+	}
+}
+
+func TestLookupKeyword(t *testing.T) {
+	tests := []struct {
+		in  string
+		out Type
+		ok  bool
+	}{
+		{"while", TokWhile, true},
+		{"default", TokDefault, true},
+		{"==", 0, false},
+		{"loop", 0, false},
+	}
+	for _, test := range tests {
+		typ, ok := LookupKeyword(test.in)
+		if typ != test.out || ok != test.ok {
+			t.Error(
+				"For", test.in,
+				"expected", test.out, test.ok,
+				"got", typ, ok,
+			)
+		}
+	}
+}
+
+// TestReservedNotKeywords checks that a word is removed from Reserved once it
+// becomes a keyword.
+func TestReservedNotKeywords(t *testing.T) {
+	for word := range Reserved {
+		if typ, ok := Keywords[word]; ok {
+			t.Error(
+				"For", word,
+				"expected", "not a keyword",
+				"got", typ,
+			)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		in  []*Token
+		out string
+	}{
+		{
+			[]*Token{
+				{Type: TokVar}, {Type: TokIdentifier, Value: "a"}, {Type: TokInt},
+				{Type: TokAssign}, {Type: TokInteger, Value: "1"}, {Type: TokSemiColon},
+			},
+			"var a int=1;",
+		},
+		{
+			[]*Token{
+				{Type: TokIdentifier, Value: "a"}, {Type: TokAssign}, {Type: TokAssign},
+				{Type: TokNot}, {Type: TokEquals}, {Type: TokFwdSlash}, {Type: TokFwdSlash},
+			},
+			"a= =! ==/ /",
+		},
+		{
+			[]*Token{
+				{Type: TokComment, Value: "// note"}, {Type: TokPrintf},
+				{Type: TokString, Value: "\"%d\"\n"}, {Type: TokComma},
+				{Type: TokCharacter, Value: "'"}, {Type: TokRawString, Value: "a\\b"},
+			},
+			"// note\nprintf\"\\\"%d\\\"\\n\",'\\''`a\\b`",
+		},
+	}
+	for _, test := range tests {
+		if out := Render(test.in); out != test.out {
+			t.Error(
+				"For", test.in,
+				"expected", test.out,
+				"got", out,
+			)
+		}
+	}
+}
@@ -38,11 +38,30 @@ func _() {
 	_ = x[TokChar-27]
 	_ = x[TokNotEqual-28]
 	_ = x[TokNot-29]
+	_ = x[TokCharacter-30]
+	_ = x[TokString-31]
+	_ = x[TokNil-32]
+	_ = x[TokFunc-33]
+	_ = x[TokComma-34]
+	_ = x[TokAssert-35]
+	_ = x[TokSwitch-36]
+	_ = x[TokCase-37]
+	_ = x[TokDefault-38]
+	_ = x[TokColon-39]
+	_ = x[TokComment-40]
+	_ = x[TokPrintf-41]
+	_ = x[TokDefer-42]
+	_ = x[TokRawString-43]
+	_ = x[TokBreak-44]
+	_ = x[TokContinue-45]
+	_ = x[TokElif-46]
+	_ = x[TokStruct-47]
+	_ = x[TokType-48]
 }
 
-const _Type_name = "integeridentifier'=''==''<''>''+''-''*''/''&''if''else''while''('')''{''}'']'']'';''var''int''array''of''ptr''to''char''!=''!'"
+const _Type_name = "integeridentifier'=''==''<''>''+''-''*''/''&''if''else''while''('')''{''}''['']'';''var''int''array''of''ptr''to''char''!=''!'characterstring'nil''func'',''assert''switch''case''default'':'comment'printf''defer'raw string'break''continue''elif''struct''type'"
 
-var _Type_index = [...]uint8{0, 7, 17, 20, 24, 27, 30, 33, 36, 39, 42, 45, 49, 55, 62, 65, 68, 71, 74, 77, 80, 83, 88, 93, 100, 104, 109, 113, 119, 123, 126}
+var _Type_index = [...]uint16{0, 7, 17, 20, 24, 27, 30, 33, 36, 39, 42, 45, 49, 55, 62, 65, 68, 71, 74, 77, 80, 83, 88, 93, 100, 104, 109, 113, 119, 123, 126, 135, 141, 146, 152, 155, 163, 171, 177, 186, 189, 196, 204, 211, 221, 228, 238, 244, 252, 258}
 
 func (i Type) String() string {
 	if i < 0 || i >= Type(len(_Type_index)-1) {